@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/relay"
+)
+
+// the streams of the synthetic publisher, the probes carry the sequence
+// number and the send time of each frame
+const (
+	benchVideoPID  = 0x100
+	benchProbePID  = 0x101
+	benchFrameRate = 25
+	benchGOP       = benchFrameRate
+)
+
+var benchMagic = []byte("JSMB")
+
+// BenchReport describes a load test, durations are in milliseconds.
+type BenchReport struct {
+	URL      string  `json:"url"`
+	Duration float64 `json:"duration"` // of the measurement, after the ramp up
+
+	Bitrate      int    `json:"bitrate"`
+	Frames       uint64 `json:"frames"`
+	PublishError string `json:"publish_error,omitempty"`
+
+	Viewers      int      `json:"viewers"`
+	Connected    int      `json:"connected"`
+	Failed       int      `json:"failed"`
+	Disconnected int      `json:"disconnected"`
+	Errors       []string `json:"errors,omitempty"` // the first errors of the viewers
+
+	Throughput float64 `json:"throughput"` // bits/s received by all viewers
+	Messages   float64 `json:"messages"`   // per second received by all viewers
+	Received   uint64  `json:"received"`   // frames
+	Dropped    uint64  `json:"dropped"`    // frames
+	Late       uint64  `json:"late"`       // frames
+
+	Latency LatencyReport `json:"latency"`
+	Server  *ServerReport `json:"server,omitempty"`
+}
+
+// LatencyReport holds percentiles of the end-to-end latency.
+type LatencyReport struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// ServerReport describes the resource usage of the relay during the
+// measurement.
+type ServerReport struct {
+	CPU            float64 `json:"cpu"` // cores, -1 when unknown
+	MaxGoroutines  int     `json:"max_goroutines"`
+	MaxHeapBytes   uint64  `json:"max_heap_bytes"`
+	SysBytes       uint64  `json:"sys_bytes"`
+	GCCycles       uint32  `json:"gc_cycles"`
+	BrokerDropped  uint64  `json:"broker_dropped"`
+	BrokerQueued   int     `json:"broker_queued"`
+	SamplingErrors int     `json:"sampling_errors"`
+}
+
+// benchCommand runs the bench subcommand, which publishes a synthetic stream
+// to a relay and plays it with many viewers.
+func benchCommand(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsmpeg-relay bench [-url URL] [-viewers N] [-bitrate BITS] [-d DURATION] [-ramp DURATION]")
+		fs.PrintDefaults()
+	}
+	url := fs.String("url", envOr("JSMPEG_RELAY_URL", "http://127.0.0.1:8080"), "the address of the relay")
+	token := fs.String("token", os.Getenv("JSMPEG_RELAY_TOKEN"), "the admin token of the relay, to report its resource usage")
+	viewers := fs.Int("viewers", 100, "the number of websocket viewers")
+	bitrate := fs.Int("bitrate", 1000000, "the bitrate of the synthetic stream in bits/s")
+	duration := fs.Duration("d", 30*time.Second, "the duration of the measurement")
+	ramp := fs.Duration("ramp", 5*time.Second, "the duration over which the viewers connect")
+	late := fs.Duration("late", time.Second, "the latency above which a frame is late")
+	topic := fs.String("topic", fmt.Sprintf("bench/%d", os.Getpid()), "the topic to publish to")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *viewers < 0 || *bitrate <= 0 || *duration <= 0 || !strings.Contains(*topic, "/") {
+		fs.Usage()
+		return 2
+	}
+
+	b := &bench{
+		url:      strings.TrimRight(*url, "/"),
+		token:    *token,
+		topic:    *topic,
+		bitrate:  *bitrate,
+		late:     *late,
+		start:    time.Now(),
+		client:   &http.Client{Timeout: 5 * time.Second},
+		stopping: make(chan struct{}),
+	}
+	report := b.run(*viewers, *ramp, *duration)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printBenchReport(report)
+	}
+	if report.PublishError != "" || report.Connected == 0 && *viewers > 0 {
+		return 1
+	}
+	return 0
+}
+
+type bench struct {
+	url     string
+	token   string
+	topic   string
+	bitrate int
+	late    time.Duration
+	start   time.Time
+	client  *http.Client
+
+	frames    uint64      // sent so far
+	measuring atomic.Bool // after the ramp up
+	stopping  chan struct{}
+}
+
+// benchViewer holds what a viewer received during the measurement.
+type benchViewer struct {
+	connected    bool
+	disconnected bool
+	err          error
+	bytes        uint64
+	messages     uint64
+	received     uint64
+	dropped      uint64
+	late         uint64
+	latencies    []time.Duration
+}
+
+func (b *bench) run(viewers int, ramp, duration time.Duration) *BenchReport {
+	report := &BenchReport{URL: b.url, Bitrate: b.bitrate, Viewers: viewers}
+
+	published := make(chan error, 1)
+	go func() { published <- b.publish() }()
+	// let the relay receive a keyframe before the viewers join
+	select {
+	case err := <-published:
+		// to stop the muxer of the stream refused
+		close(b.stopping)
+		report.PublishError = fmt.Sprint(err)
+		return report
+	case <-time.After(time.Second):
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*benchViewer, viewers)
+	for i := range results {
+		results[i] = &benchViewer{}
+		wg.Add(1)
+		go func(v *benchViewer, delay time.Duration) {
+			defer wg.Done()
+			select {
+			case <-time.After(delay):
+				b.play(v)
+			case <-b.stopping:
+			}
+		}(results[i], time.Duration(int64(ramp)*int64(i)/int64(viewers)))
+	}
+
+	time.Sleep(ramp)
+	b.measuring.Store(true)
+	sampler := b.sampleServer()
+	measured := time.Now()
+	select {
+	case err := <-published:
+		report.PublishError = fmt.Sprint(err)
+	case <-time.After(duration):
+	}
+	b.measuring.Store(false)
+	elapsed := time.Since(measured)
+	close(b.stopping)
+	wg.Wait()
+
+	report.Duration = float64(elapsed) / float64(time.Millisecond)
+	report.Frames = atomic.LoadUint64(&b.frames)
+	report.Server = <-sampler
+
+	var latencies []time.Duration
+	var bytes, messages uint64
+	for _, v := range results {
+		switch {
+		case v.connected && v.disconnected:
+			report.Connected++
+			report.Disconnected++
+		case v.connected:
+			report.Connected++
+		default:
+			report.Failed++
+		}
+		if v.err != nil && len(report.Errors) < 5 {
+			report.Errors = append(report.Errors, v.err.Error())
+		}
+		bytes += v.bytes
+		messages += v.messages
+		report.Received += v.received
+		report.Dropped += v.dropped
+		report.Late += v.late
+		latencies = append(latencies, v.latencies...)
+	}
+	report.Throughput = float64(bytes*8) / elapsed.Seconds()
+	report.Messages = float64(messages) / elapsed.Seconds()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return float64(latencies[int(p*float64(len(latencies)-1))]) / float64(time.Millisecond)
+	}
+	report.Latency = LatencyReport{P50: percentile(0.5), P90: percentile(0.9), P99: percentile(0.99), Max: percentile(1)}
+	return report
+}
+
+// publish sends the synthetic stream until the bench stops, a frame every
+// 1/25s made of a probe and a video picture sized for the bitrate.
+func (b *bench) publish() error {
+	pr, pw := io.Pipe()
+	go func() {
+		mux := mpegts.NewMuxer(pw,
+			mpegts.ElementaryStream{PID: benchVideoPID, StreamType: mpegts.StreamTypeMPEG1Video},
+			mpegts.ElementaryStream{PID: benchProbePID, StreamType: mpegts.StreamTypePrivate})
+		size := b.bitrate / 8 / benchFrameRate
+		ticker := time.NewTicker(time.Second / benchFrameRate)
+		defer ticker.Stop()
+		for seq := uint64(0); ; seq++ {
+			sent := time.Since(b.start)
+			pts := int64(sent / (time.Second / 90000))
+
+			probe := make([]byte, 0, 20)
+			probe = append(probe, benchMagic...)
+			probe = binary.BigEndian.AppendUint64(probe, seq)
+			probe = binary.BigEndian.AppendUint64(probe, uint64(sent))
+
+			var err error
+			if seq%benchGOP == 0 {
+				err = mux.WriteTables()
+			}
+			if err == nil {
+				err = mux.WritePES(benchProbePID, 0xbd, pts, -1, probe)
+			}
+			if err == nil {
+				err = mux.WritePES(benchVideoPID, mpegts.StreamIDVideoFirst, pts, pts*300, benchPicture(seq, size))
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			atomic.StoreUint64(&b.frames, seq+1)
+
+			select {
+			case <-b.stopping:
+				pw.Close()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	defer pr.Close() // fails the writes of the muxer once the relay is gone
+	resp, err := http.Post(b.url+"/publish/"+b.topic, "video/mp2t", pr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	select {
+	case <-b.stopping:
+		return nil
+	default:
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("the relay ended the stream")
+}
+
+// benchPicture returns an MPEG-1 picture of a size, intra coded with a
+// sequence header at the start of each GOP. Its data changes every frame
+// so that the relay does not take it for a frozen picture.
+func benchPicture(seq uint64, size int) []byte {
+	es := make([]byte, 0, size)
+	picture := mpegts.PictureP
+	if seq%benchGOP == 0 {
+		picture = mpegts.PictureI
+		// 320x240, square pixels, 25 fps, variable bitrate
+		es = append(es, 0, 0, 1, mpegts.StartCodeSequence, 0x14, 0x00, 0xf0, 0x13, 0xff, 0xff, 0xe0, 0x18)
+	}
+	ref := seq % benchGOP
+	es = append(es, 0, 0, 1, mpegts.StartCodePicture, byte(ref>>2), byte(ref<<6)|byte(picture<<3)|0x07, 0xff, 0xf8)
+	fill := byte(seq) | 0x80
+	for len(es) < size {
+		es = append(es, fill)
+	}
+	return es
+}
+
+// play plays the topic until the bench stops.
+func (b *bench) play(v *benchViewer) {
+	wsURL := "ws" + strings.TrimPrefix(b.url, "http") + "/play/" + b.topic
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = 10 * time.Second
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		v.err = err
+		return
+	}
+	v.connected = true
+	defer conn.Close()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-b.stopping:
+			conn.SetReadDeadline(time.Now())
+		case <-stopped:
+		}
+	}()
+
+	// the frames replayed from the GOP cache are older than the viewer
+	joined := atomic.LoadUint64(&b.frames)
+	var last uint64
+	first := true
+	aligner := &mpegts.Aligner{}
+	demuxer := mpegts.NewDemuxer()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-b.stopping:
+			default:
+				v.disconnected, v.err = true, err
+			}
+			return
+		}
+		now := time.Since(b.start)
+		measuring := b.measuring.Load()
+		if measuring {
+			v.bytes += uint64(len(data))
+			v.messages++
+		}
+
+		for _, pkt := range mpegts.Packets(aligner.Push(data)) {
+			if pkt.PID() != benchProbePID {
+				continue
+			}
+			for _, pes := range demuxer.Push(pkt) {
+				if len(pes.Data) < 20 || string(pes.Data[:4]) != string(benchMagic) {
+					continue
+				}
+				seq := binary.BigEndian.Uint64(pes.Data[4:])
+				sent := time.Duration(binary.BigEndian.Uint64(pes.Data[12:]))
+				if !first && seq > last+1 && measuring {
+					v.dropped += seq - last - 1
+				}
+				first, last = false, seq
+				if seq < joined || !measuring {
+					continue
+				}
+				latency := now - sent
+				v.received++
+				v.latencies = append(v.latencies, latency)
+				if latency > b.late {
+					v.late++
+				}
+			}
+		}
+	}
+}
+
+// sampleServer samples the resource usage of the relay every second during
+// the measurement, the report is sent when the bench stops.
+func (b *bench) sampleServer() <-chan *ServerReport {
+	done := make(chan *ServerReport, 1)
+	if b.token == "" {
+		done <- nil
+		return done
+	}
+	go func() {
+		report := &ServerReport{CPU: -1}
+		var first, last *relay.RuntimeStats
+		sample := func() {
+			stats := &relay.RuntimeStats{}
+			if err := b.admin("/api/admin/runtime", stats); err != nil {
+				report.SamplingErrors++
+				return
+			}
+			if first == nil {
+				first = stats
+			}
+			last = stats
+			if stats.Goroutines > report.MaxGoroutines {
+				report.MaxGoroutines = stats.Goroutines
+			}
+			if stats.HeapBytes > report.MaxHeapBytes {
+				report.MaxHeapBytes = stats.HeapBytes
+			}
+		}
+
+		sample()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				sample()
+			case <-b.stopping:
+				break loop
+			}
+		}
+		sample()
+
+		if first != nil && last != first {
+			report.SysBytes = last.SysBytes
+			report.GCCycles = last.GCCycles - first.GCCycles
+			if first.CPUSeconds >= 0 && last.Uptime > first.Uptime {
+				report.CPU = (last.CPUSeconds - first.CPUSeconds) / (last.Uptime - first.Uptime)
+			}
+		}
+		var stats pubsub.Stats
+		if err := b.admin("/api/admin/broker", &stats); err == nil {
+			for _, t := range stats.Topics {
+				if t.Topic == b.topic {
+					report.BrokerDropped, report.BrokerQueued = t.Dropped, t.Queued
+				}
+			}
+		} else {
+			report.SamplingErrors++
+		}
+		done <- report
+	}()
+	return done
+}
+
+// admin calls a route of the admin API.
+func (b *bench) admin(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", b.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func printBenchReport(r *BenchReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "relay\t%v\n", r.URL)
+	fmt.Fprintf(w, "publisher\t%.1f kbit/s, %d frames\n", float64(r.Bitrate)/1000, r.Frames)
+	if r.PublishError != "" {
+		fmt.Fprintf(w, "publish error\t%v\n", r.PublishError)
+	}
+	fmt.Fprintf(w, "viewers\t%d connected, %d failed, %d disconnected of %d\n", r.Connected, r.Failed, r.Disconnected, r.Viewers)
+	for _, err := range r.Errors {
+		fmt.Fprintf(w, "viewer error\t%v\n", err)
+	}
+	fmt.Fprintf(w, "measured\t%.1fs\n", r.Duration/1000)
+	fmt.Fprintf(w, "throughput\t%.1f Mbit/s, %.0f messages/s\n", r.Throughput/1e6, r.Messages)
+	fmt.Fprintf(w, "frames\t%d received, %d dropped, %d late\n", r.Received, r.Dropped, r.Late)
+	fmt.Fprintf(w, "latency\tp50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	if s := r.Server; s != nil {
+		cpu := "unknown"
+		if s.CPU >= 0 {
+			cpu = fmt.Sprintf("%.2f cores", s.CPU)
+		}
+		fmt.Fprintf(w, "server cpu\t%v\n", cpu)
+		fmt.Fprintf(w, "server memory\t%.1f MB heap at most, %.1f MB from the system, %d GC cycles\n",
+			float64(s.MaxHeapBytes)/1e6, float64(s.SysBytes)/1e6, s.GCCycles)
+		fmt.Fprintf(w, "server goroutines\t%d at most\n", s.MaxGoroutines)
+		fmt.Fprintf(w, "broker\t%d dropped, %d queued\n", s.BrokerDropped, s.BrokerQueued)
+	} else {
+		fmt.Fprintf(w, "server\tunknown without -token\n")
+	}
+}
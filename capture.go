@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// captureCommand runs the capture subcommand, which records a play session
+// of a relay to a TS file.
+func captureCommand(args []string) int {
+	fs := flag.NewFlagSet("capture", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsmpeg-relay capture ws://relay/play/app/key -o out.ts [-d DURATION]")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "the file to write the stream to")
+	duration := fs.Duration("d", 0, "the duration to capture, 0 until the stream ends")
+
+	url, err := parseURLArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if url == "" || *output == "" {
+		fs.Usage()
+		return 2
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer conn.Close()
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+
+	// closing the connection ends the capture
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupt:
+		case <-timeout:
+		case <-done:
+			return
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	aligner := &mpegts.Aligner{}
+	var packets, keyframes int
+	start := time.Now()
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		data = aligner.Push(data)
+		if _, err := w.Write(data); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, pkt := range mpegts.Packets(data) {
+			packets++
+			if mpegts.IsKeyframe(pkt) {
+				keyframes++
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "captured %d packets, %d keyframes in %v to %v\n",
+		packets, keyframes, time.Since(start).Truncate(time.Millisecond), *output)
+	if packets == 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseURLArgs parses the flags of a subcommand taking a url, which may come
+// before, after or between the flags.
+func parseURLArgs(fs *flag.FlagSet, args []string) (string, error) {
+	var url string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+		if fs.NArg() == 0 || url != "" {
+			return url, nil
+		}
+		url, args = fs.Arg(0), fs.Args()[1:]
+	}
+}
@@ -0,0 +1,126 @@
+// Package client publishes streams to a jsmpeg-relay and plays them, over
+// the /publish and /play routes of the relay.
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// the close codes of the relay are this base plus an HTTP status
+const closeStatusBase = 4000
+
+var (
+	ErrClosed = errors.New("client: closed")
+	ErrEnded  = errors.New("client: the relay ended the stream")
+)
+
+// Signer adds the credentials of the relay, or of a proxy in front of it,
+// to a request before it is sent.
+type Signer func(r *http.Request) error
+
+// BearerToken signs the requests with a bearer token.
+func BearerToken(token string) Signer {
+	return func(r *http.Request) error {
+		r.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// StatusError is an error status of the relay, like 410 when an
+// administrator terminated a stream or 403 for a banned address.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("relay: %d %v", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("relay: %d %v: %v", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// Temporary tells whether trying again may succeed, the client errors
+// like a rejected or terminated stream are final.
+func (e *StatusError) Temporary() bool {
+	return e.Code < 400 || e.Code >= 500
+}
+
+// to get the URL of a route of the relay at a base URL like
+// http://relay:8080, with the scheme of websockets when asked
+func routeURL(baseURL, path string, query url.Values, ws bool) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + path)
+	if err != nil {
+		return "", err
+	}
+	if ws {
+		switch u.Scheme {
+		case "http":
+			u.Scheme = "ws"
+		case "https":
+			u.Scheme = "wss"
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// topicPath returns the path of a route for a topic, escaping its parts.
+func topicPath(route, app, key string) string {
+	return "/" + route + "/" + url.PathEscape(app) + "/" + url.PathEscape(key)
+}
+
+// responseError returns the error of an HTTP response, nil on success.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
+// closeError returns the error of a websocket closed by the relay, io.EOF
+// when it closed normally.
+func closeError(err error) error {
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		return err
+	}
+	switch {
+	case ce.Code >= closeStatusBase+100 && ce.Code < closeStatusBase+600:
+		return &StatusError{Code: ce.Code - closeStatusBase, Message: ce.Text}
+	case ce.Code == websocket.CloseNormalClosure || ce.Code == websocket.CloseGoingAway:
+		return io.EOF
+	}
+	return err
+}
+
+// dialWebsocket signs and dials a websocket of the relay.
+func dialWebsocket(dialer *websocket.Dialer, u string, sign Signer) (*websocket.Conn, error) {
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if sign != nil {
+		if err := sign(req); err != nil {
+			return nil, err
+		}
+	}
+	conn, resp, err := dialer.Dial(u, req.Header)
+	if err != nil && resp != nil {
+		if e := responseError(resp); e != nil {
+			return nil, e
+		}
+	}
+	return conn, err
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRouteURL(t *testing.T) {
+	tests := []struct {
+		base  string
+		path  string
+		query url.Values
+		ws    bool
+		want  string
+	}{
+		{"http://relay:8080", topicPath("publish", "live", "news"), nil, false, "http://relay:8080/publish/live/news"},
+		{"http://relay:8080/", topicPath("play", "live", "news"), nil, true, "ws://relay:8080/play/live/news"},
+		{"https://relay", topicPath("play", "live", "a/b c"), url.Values{"offset": {"-10s"}}, true, "wss://relay/play/live/a%2Fb%20c?offset=-10s"},
+	}
+	for _, tt := range tests {
+		got, err := routeURL(tt.base, tt.path, tt.query, tt.ws)
+		if err != nil {
+			t.Errorf("%v%v: %v", tt.base, tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v%v: got %v, want %v", tt.base, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCloseError(t *testing.T) {
+	other := errors.New("connection reset")
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{&websocket.CloseError{Code: closeStatusBase + 410, Text: "terminated"}, &StatusError{Code: 410, Message: "terminated"}},
+		{&websocket.CloseError{Code: websocket.CloseNormalClosure}, io.EOF},
+		{&websocket.CloseError{Code: websocket.CloseGoingAway}, io.EOF},
+		{other, other},
+	}
+	for _, tt := range tests {
+		got := closeError(tt.err)
+		if se, ok := got.(*StatusError); ok {
+			if want, ok := tt.want.(*StatusError); !ok || *se != *want {
+				t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+			}
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	// an abnormal closure is not a status of the relay
+	abnormal := &websocket.CloseError{Code: websocket.CloseAbnormalClosure}
+	if got := closeError(abnormal); got != abnormal {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		err       *StatusError
+		message   string
+		temporary bool
+	}{
+		{&StatusError{Code: 403, Message: "banned"}, "relay: 403 Forbidden: banned", false},
+		{&StatusError{Code: 410}, "relay: 410 Gone", false},
+		{&StatusError{Code: 503}, "relay: 503 Service Unavailable", true},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.message {
+			t.Errorf("got %q, want %q", got, tt.message)
+		}
+		if got := tt.err.Temporary(); got != tt.temporary {
+			t.Errorf("%v: got temporary %v", tt.err, got)
+		}
+	}
+}
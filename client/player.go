@@ -0,0 +1,127 @@
+package client
+
+import (
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	relayws "github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+// PlayerOptions describes how a player connects to the relay.
+type PlayerOptions struct {
+	// Offset starts a live stream behind the live edge when negative, from
+	// the timeshift buffer of the relay.
+	Offset time.Duration
+	Sign   Signer
+	Dialer *websocket.Dialer // websocket.DefaultDialer by default
+}
+
+// Player reads the transport stream of a topic or a recording from the
+// relay, and steers its playback with control messages.
+type Player struct {
+	conn   *websocket.Conn
+	reader io.Reader // of the current message
+
+	mu sync.Mutex // serializes the control messages
+}
+
+// Play plays a topic of the relay at a base URL like http://relay:8080.
+func Play(baseURL, app, key string, opts PlayerOptions) (*Player, error) {
+	query := url.Values{}
+	if opts.Offset < 0 {
+		query.Set("offset", opts.Offset.String())
+	}
+	u, err := routeURL(baseURL, topicPath("play", app, key), query, true)
+	if err != nil {
+		return nil, err
+	}
+	return dialPlayer(u, opts)
+}
+
+// PlayRecording plays a recording of the relay from its start.
+func PlayRecording(baseURL, id string, opts PlayerOptions) (*Player, error) {
+	u, err := routeURL(baseURL, "/vod/"+url.PathEscape(id), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return dialPlayer(u, opts)
+}
+
+func dialPlayer(u string, opts PlayerOptions) (*Player, error) {
+	conn, err := dialWebsocket(opts.Dialer, u, opts.Sign)
+	if err != nil {
+		return nil, err
+	}
+	return &Player{conn: conn}, nil
+}
+
+// Read reads the stream, the messages of the relay are whole packets. It
+// returns io.EOF once the relay closed the stream normally.
+func (p *Player) Read(b []byte) (int, error) {
+	for {
+		if p.reader == nil {
+			kind, r, err := p.conn.NextReader()
+			if err != nil {
+				return 0, closeError(err)
+			}
+			if kind != websocket.BinaryMessage {
+				continue
+			}
+			p.reader = r
+		}
+		n, err := p.reader.Read(b)
+		if err == io.EOF {
+			p.reader, err = nil, nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Seek moves a live stream behind the live edge by a negative offset.
+func (p *Player) Seek(offset time.Duration) error {
+	return p.control(relayws.Control{Cmd: relayws.ControlSeek, Offset: offset.String()})
+}
+
+// SeekPosition moves a recording to a position from its start.
+func (p *Player) SeekPosition(position time.Duration) error {
+	return p.control(relayws.Control{Cmd: relayws.ControlSeek, Position: position.String()})
+}
+
+// SeekMarker moves to a marker of the stream.
+func (p *Player) SeekMarker(name string) error {
+	return p.control(relayws.Control{Cmd: relayws.ControlSeek, Marker: name})
+}
+
+// Live moves back to the live edge of a live stream.
+func (p *Player) Live() error {
+	return p.control(relayws.Control{Cmd: relayws.ControlLive})
+}
+
+// Pause stops the relay sending a recording until Resume.
+func (p *Player) Pause() error {
+	return p.control(relayws.Control{Cmd: relayws.ControlPause})
+}
+
+// Resume continues a paused recording.
+func (p *Player) Resume() error {
+	return p.control(relayws.Control{Cmd: relayws.ControlResume})
+}
+
+func (p *Player) control(ctl relayws.Control) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn.WriteJSON(ctl)
+}
+
+// Close leaves the stream.
+func (p *Player) Close() error {
+	p.mu.Lock()
+	p.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeWait))
+	p.mu.Unlock()
+	return p.conn.Close()
+}
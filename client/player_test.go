@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	relayws "github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+// playRelay sends packets to a player, then ends the stream with a close
+// code once it received a control message.
+func playRelay(t *testing.T, data []byte, code int, text string) (string, chan relayws.Control) {
+	controls := make(chan relayws.Control, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"event": "ignored"}`))
+		for i := 0; i < len(data); i += 2 * 188 {
+			conn.WriteMessage(websocket.BinaryMessage, data[i:min(i+2*188, len(data))])
+		}
+		var ctl relayws.Control
+		if err := conn.ReadJSON(&ctl); err != nil {
+			return
+		}
+		controls <- ctl
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+		conn.ReadMessage() // until the player closes
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, controls
+}
+
+func TestPlayer(t *testing.T) {
+	data := packets(5)
+	tests := []struct {
+		code int
+		text string
+		err  error
+	}{
+		{websocket.CloseNormalClosure, "", io.EOF},
+		{closeStatusBase + http.StatusGone, "terminated", &StatusError{Code: http.StatusGone, Message: "terminated"}},
+	}
+	for _, tt := range tests {
+		url, controls := playRelay(t, data, tt.code, tt.text)
+		p, err := Play(url, "live", "news", PlayerOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(p, got); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("code %v: got %v bytes: %v", tt.code, len(got), err)
+		}
+		if err := p.Seek(-10 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if ctl := <-controls; ctl.Cmd != relayws.ControlSeek || ctl.Offset != "-10s" {
+			t.Errorf("got control %+v", ctl)
+		}
+		_, err = p.Read(got)
+		if se, ok := err.(*StatusError); ok {
+			if want, ok := tt.err.(*StatusError); !ok || *se != *want {
+				t.Errorf("code %v: got %v, want %v", tt.code, err, tt.err)
+			}
+		} else if err != tt.err {
+			t.Errorf("code %v: got %v, want %v", tt.code, err, tt.err)
+		}
+		p.Close()
+	}
+}
+
+func TestPlayRefused(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "play secret required", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	_, err := Play(ts.URL, "live", "news", PlayerOptions{Offset: -time.Second})
+	if se, ok := err.(*StatusError); !ok || se.Code != http.StatusUnauthorized || se.Message != "play secret required" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// Transport is the way a publisher sends its stream.
+type Transport int
+
+const (
+	HTTP      Transport = iota // a chunked POST request
+	WebSocket                  // binary messages of a websocket
+)
+
+const (
+	defaultRetryDelay = time.Second
+	maxRetryDelay     = 30 * time.Second
+	closeWait         = time.Second // for the close message of the relay
+)
+
+// PublisherOptions describes how a publisher connects to the relay.
+type PublisherOptions struct {
+	Transport Transport
+	Private   bool // left out of the stream directory
+	Sign      Signer
+
+	// Retries is the number of reconnections a write tries before it fails,
+	// 0 for none and negative for no limit. The final errors of the relay,
+	// like a rejected or terminated stream, are not retried.
+	Retries    int
+	RetryDelay time.Duration // before the first retry, doubled up to 30s
+	OnRetry    func(attempt int, err error)
+
+	HTTPClient *http.Client      // http.DefaultClient by default
+	Dialer     *websocket.Dialer // websocket.DefaultDialer by default
+}
+
+// Publisher sends a transport stream to a topic of the relay. It reconnects
+// when the connection fails, each connection starting on a packet.
+type Publisher struct {
+	url     string
+	opts    PublisherOptions
+	aligner mpegts.Aligner
+
+	mu        sync.Mutex // of the fields below
+	conn      publisherConn
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// publisherConn is a connection carrying a stream to the relay.
+type publisherConn interface {
+	Write(b []byte) error
+	// Close ends the stream and returns the error the relay ended it with.
+	Close() error
+}
+
+// create a publisher of a topic of the relay at a base URL like
+// http://relay:8080, which connects on the first write
+func NewPublisher(baseURL, app, key string, opts PublisherOptions) (*Publisher, error) {
+	query := url.Values{}
+	if opts.Private {
+		query.Set("private", "true")
+	}
+	u, err := routeURL(baseURL, topicPath("publish", app, key), query, opts.Transport == WebSocket)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	return &Publisher{url: u, opts: opts, closing: make(chan struct{})}, nil
+}
+
+// Write sends the complete packets of b, keeping the rest for the next
+// write, and reconnects as the options allow when the connection fails.
+func (p *Publisher) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, ErrClosed
+	}
+	data := p.aligner.Push(b)
+	if len(data) == 0 {
+		return len(b), nil
+	}
+	for attempt := 0; ; attempt++ {
+		var err error
+		if p.conn == nil {
+			p.conn, err = p.dial()
+		}
+		if err == nil {
+			if err = p.conn.Write(data); err == nil {
+				return len(b), nil
+			}
+			p.conn = nil
+		}
+		if !p.retry(attempt, err) {
+			return 0, err
+		}
+	}
+}
+
+// Close ends the stream, it returns the error of the relay if it rejected
+// the stream.
+func (p *Publisher) Close() error {
+	p.closeOnce.Do(func() { close(p.closing) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+func (p *Publisher) dial() (publisherConn, error) {
+	// the connections are returned as interfaces only on success
+	if p.opts.Transport == WebSocket {
+		c, err := dialWebsocketPublisher(p.opts.Dialer, p.url, p.opts.Sign)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	c, err := dialHTTPPublisher(p.opts.HTTPClient, p.url, p.opts.Sign)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// retry waits before the next attempt after an error, false when the error
+// is final, the retries are exhausted or the publisher is closed.
+func (p *Publisher) retry(attempt int, err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) && !se.Temporary() {
+		return false
+	}
+	if p.opts.Retries >= 0 && attempt >= p.opts.Retries {
+		return false
+	}
+	if p.opts.OnRetry != nil {
+		p.opts.OnRetry(attempt+1, err)
+	}
+	delay := p.opts.RetryDelay
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	select {
+	case <-time.After(min(delay, maxRetryDelay)):
+		return true
+	case <-p.closing:
+		return false
+	}
+}
+
+// httpPublisher streams the body of a POST request.
+type httpPublisher struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error // of the request, once done
+}
+
+func dialHTTPPublisher(client *http.Client, u string, sign Signer) (*httpPublisher, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, u, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "video/mp2t")
+	if sign != nil {
+		if err := sign(req); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &httpPublisher{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		resp, err := client.Do(req)
+		if err != nil {
+			c.err = err
+		} else {
+			c.err = responseError(resp)
+			resp.Body.Close()
+		}
+		pr.CloseWithError(c.err)
+	}()
+	return c, nil
+}
+
+func (c *httpPublisher) Write(b []byte) error {
+	if _, err := c.pw.Write(b); err != nil {
+		<-c.done
+		if c.err != nil {
+			return c.err
+		}
+		return ErrEnded
+	}
+	return nil
+}
+
+func (c *httpPublisher) Close() error {
+	c.pw.Close()
+	<-c.done
+	return c.err
+}
+
+// websocketPublisher sends binary messages, and reads the close message
+// of the relay.
+type websocketPublisher struct {
+	conn *websocket.Conn
+	done chan struct{}
+	err  error // of the close message, once done
+}
+
+func dialWebsocketPublisher(dialer *websocket.Dialer, u string, sign Signer) (*websocketPublisher, error) {
+	conn, err := dialWebsocket(dialer, u, sign)
+	if err != nil {
+		return nil, err
+	}
+	c := &websocketPublisher{conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				c.err = closeError(err)
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (c *websocketPublisher) Write(b []byte) error {
+	err := c.conn.WriteMessage(websocket.BinaryMessage, b)
+	if err == nil {
+		return nil
+	}
+	// the relay may have told why before closing
+	c.conn.SetReadDeadline(time.Now().Add(closeWait))
+	<-c.done
+	c.conn.Close()
+	var se *StatusError
+	if errors.As(c.err, &se) {
+		return se
+	}
+	return err
+}
+
+func (c *websocketPublisher) Close() error {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeWait))
+	c.conn.SetReadDeadline(time.Now().Add(closeWait))
+	<-c.done
+	c.conn.Close()
+	var se *StatusError
+	if errors.As(c.err, &se) {
+		return se
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// packets returns n packets numbered by their first payload byte.
+func packets(n int) []byte {
+	data := make([]byte, n*mpegts.PacketSize)
+	for i := 0; i < n; i++ {
+		data[i*mpegts.PacketSize] = mpegts.SyncByte
+		data[i*mpegts.PacketSize+4] = byte(i)
+	}
+	return data
+}
+
+// fakeRelay records what the publishers send to it.
+type fakeRelay struct {
+	sync.Mutex
+	requests int
+	refuse   int // the first requests refused with 503
+	auth     string
+	query    string
+	data     []byte
+}
+
+func (f *fakeRelay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	f.requests++
+	refused := f.requests <= f.refuse
+	f.auth, f.query = r.Header.Get("Authorization"), r.URL.RawQuery
+	f.Unlock()
+	if refused {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		data, _ := io.ReadAll(r.Body)
+		f.Lock()
+		f.data = append(f.data, data...)
+		f.Unlock()
+		return
+	}
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		f.Lock()
+		f.data = append(f.data, data...)
+		f.Unlock()
+	}
+}
+
+func (f *fakeRelay) received() []byte {
+	f.Lock()
+	defer f.Unlock()
+	return append([]byte{}, f.data...)
+}
+
+func TestPublisher(t *testing.T) {
+	data := packets(3)
+	for _, transport := range []Transport{HTTP, WebSocket} {
+		relay := &fakeRelay{}
+		ts := httptest.NewServer(relay)
+		p, err := NewPublisher(ts.URL, "live", "news", PublisherOptions{Transport: transport, Private: true, Sign: BearerToken("s3cret")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the packets split across the writes are sent whole
+		for _, b := range [][]byte{data[:100], data[100:400], data[400:]} {
+			if n, err := p.Write(b); err != nil || n != len(b) {
+				t.Fatalf("transport %v: wrote %v: %v", transport, n, err)
+			}
+		}
+		if err := p.Close(); err != nil {
+			t.Errorf("transport %v: %v", transport, err)
+		}
+		if _, err := p.Write(data); err != ErrClosed {
+			t.Errorf("transport %v: got %v once closed", transport, err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !bytes.Equal(relay.received(), data) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := relay.received(); !bytes.Equal(got, data) {
+			t.Errorf("transport %v: got %v bytes, want %v", transport, len(got), len(data))
+		}
+		relay.Lock()
+		if relay.auth != "Bearer s3cret" || relay.query != "private=true" {
+			t.Errorf("transport %v: got auth %q, query %q", transport, relay.auth, relay.query)
+		}
+		relay.Unlock()
+		ts.Close()
+	}
+}
+
+func TestPublisherRetry(t *testing.T) {
+	relay := &fakeRelay{refuse: 2}
+	ts := httptest.NewServer(relay)
+	defer ts.Close()
+
+	var attempts []int
+	opts := PublisherOptions{
+		Transport:  WebSocket,
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+		OnRetry:    func(attempt int, err error) { attempts = append(attempts, attempt) },
+	}
+	p, err := NewPublisher(ts.URL, "live", "news", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err := p.Write(packets(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("got attempts %v", attempts)
+	}
+
+	// without retries left, the error of the relay is returned
+	relay.Lock()
+	relay.requests, relay.refuse = 0, 1
+	relay.Unlock()
+	once, err := NewPublisher(ts.URL, "live", "news", PublisherOptions{Transport: WebSocket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var se *StatusError
+	if _, err := once.Write(packets(1)); !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPublisherRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "banned", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	// the final errors are not retried
+	retried := false
+	opts := PublisherOptions{Retries: -1, RetryDelay: time.Millisecond, OnRetry: func(int, error) { retried = true }}
+	p, err := NewPublisher(ts.URL, "live", "news", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// the writes go on until the relay answered
+	for deadline := time.Now().Add(5 * time.Second); err == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		_, err = p.Write(packets(64))
+	}
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusForbidden || se.Message != "banned" || retried {
+		t.Errorf("got %v, retried %v", err, retried)
+	}
+}
+
+func TestPublisherCloseRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		http.Error(w, "width 64 exceeds the limit of 32", http.StatusUnprocessableEntity)
+	}))
+	defer ts.Close()
+	p, err := NewPublisher(ts.URL, "live", "news", PublisherOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Write(packets(1)); err != nil {
+		t.Fatal(err)
+	}
+	var se *StatusError
+	if err := p.Close(); !errors.As(err, &se) || se.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package clip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/record"
+	"github.com/numb3r3/jsmpeg-relay/timeshift"
+)
+
+// the number of packets scanned at the start of a recording for its tables
+const maxTablesScan = 10000
+
+var (
+	ErrEmpty    = errors.New("clip: nothing captured in the requested range")
+	ErrNoTables = errors.New("clip: no PAT and PMT found")
+)
+
+// part is a piece of a clip, read from memory or from a recording file.
+type part struct {
+	tables []byte
+	data   [][]byte
+	path   string
+	offset int64
+	length int64 // -1 up to the end of the file
+}
+
+// Clip is a cut of a stream on keyframe boundaries, every piece cut from
+// a different source starts with its own PAT and PMT.
+type Clip struct {
+	parts []part
+}
+
+// Live cuts a clip out of the rolling buffer of a live topic.
+func Live(buf *timeshift.Buffer, from, to time.Time) (*Clip, error) {
+	entries := buf.Entries(from, to)
+	if len(entries) == 0 {
+		return nil, ErrEmpty
+	}
+
+	tables := buf.Tables()
+	if tables == nil {
+		return nil, ErrNoTables
+	}
+	p := part{}
+	for _, e := range entries {
+		p.data = append(p.data, e.Data)
+	}
+	var next []mpegts.Packet
+	for _, data := range p.data {
+		next = append(next, mpegts.Packets(data)...)
+	}
+	p.tables = continueTables(tables, next)
+	return &Clip{parts: []part{p}}, nil
+}
+
+// FromRecordings cuts a clip out of the recordings overlapping the range.
+// When recordings overlap, like a scheduled one and one started by hand,
+// every span of the range is cut from the recording which started first.
+func FromRecordings(recs []record.Recording, from, to time.Time) (*Clip, error) {
+	recs = append([]record.Recording{}, recs...)
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].StartedAt.Before(recs[j].StartedAt) })
+
+	c := &Clip{}
+	covered := from // the end of what the parts cut so far
+	for _, rec := range recs {
+		if rec.StartedAt.IsZero() || rec.StartedAt.After(to) || (!rec.EndedAt.IsZero() && !rec.EndedAt.After(covered)) {
+			continue
+		}
+
+		index, err := record.LoadIndex(rec)
+		if err != nil {
+			return nil, err
+		}
+		// the first keyframe is after from when the recording started later,
+		// a recording following another one starts after what was cut
+		start, ok := index.Seek(from)
+		if len(c.parts) > 0 {
+			start, ok = firstAfter(index, covered)
+		}
+		if !ok || !start.At.Before(to) {
+			continue
+		}
+		p := part{path: rec.Path, offset: start.Offset, length: -1}
+		end := rec.EndedAt
+		if end.IsZero() {
+			end = to // still recording
+		}
+		for _, e := range index {
+			if e.Offset > start.Offset && !e.At.Before(to) {
+				p.length = e.Offset - start.Offset
+				end = e.At
+				break
+			}
+		}
+		tables, err := readTables(rec.Path)
+		if err != nil {
+			return nil, err
+		}
+		next, err := readPackets(rec.Path, start.Offset)
+		if err != nil {
+			return nil, err
+		}
+		p.tables = continueTables(tables, next)
+		c.parts = append(c.parts, p)
+		if end.After(covered) {
+			covered = end
+		}
+		if !covered.Before(to) {
+			break
+		}
+	}
+
+	if len(c.parts) == 0 {
+		return nil, ErrEmpty
+	}
+	return c, nil
+}
+
+// firstAfter returns the first keyframe of an index at or after a time.
+func firstAfter(index record.Index, at time.Time) (record.IndexEntry, bool) {
+	for _, e := range index {
+		if !e.At.Before(at) {
+			return e, true
+		}
+	}
+	return record.IndexEntry{}, false
+}
+
+// readTables finds the first PAT and PMT of a recording, or fails with
+// ErrNoTables.
+func readTables(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	tables := &mpegts.Tables{}
+	pkt := make(mpegts.Packet, mpegts.PacketSize)
+	for i := 0; i < maxTablesScan; i++ {
+		if _, err := io.ReadFull(r, pkt); err != nil {
+			break
+		}
+		tables.Update(pkt)
+		if data := tables.Packets(); data != nil {
+			return data, nil
+		}
+	}
+	return nil, ErrNoTables
+}
+
+// readPackets reads the packets of a recording following an offset, as
+// many as scanned for the tables.
+func readPackets(path string, offset int64) ([]mpegts.Packet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxTablesScan*mpegts.PacketSize))
+	if err != nil {
+		return nil, err
+	}
+	return mpegts.Packets(data), nil
+}
+
+// continueTables returns a copy of the table packets inserted before the
+// packets of a cut, numbered so that the continuity counter of every PID
+// goes on without a break into the packets which follow.
+func continueTables(tables []byte, next []mpegts.Packet) []byte {
+	tables = append([]byte{}, tables...)
+	counters := map[uint16]uint8{} // of the first following packet by PID
+	for _, pkt := range next {
+		if _, ok := counters[pkt.PID()]; !ok {
+			counters[pkt.PID()] = pkt.ContinuityCounter()
+		}
+	}
+	packets := mpegts.Packets(tables)
+	for i := len(packets) - 1; i >= 0; i-- {
+		pkt := packets[i]
+		if cc, ok := counters[pkt.PID()]; ok {
+			cc = (cc - 1) & 0x0f
+			pkt[3] = pkt[3]&0xf0 | cc
+			counters[pkt.PID()] = cc
+		}
+	}
+	return tables
+}
+
+// WriteTo streams the clip out, recordings are copied without being
+// loaded in memory.
+func (c *Clip) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, p := range c.parts {
+		n, err := w.Write(p.tables)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+
+		for _, data := range p.data {
+			n, err := w.Write(data)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+
+		if p.path != "" {
+			written, err := copySection(w, p.path, p.offset, p.length)
+			total += written
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func copySection(w io.Writer, path string, offset, length int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var r io.Reader = f
+	if length >= 0 {
+		r = io.LimitReader(f, length)
+	}
+	return io.Copy(w, r)
+}
@@ -0,0 +1,189 @@
+package clip
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/record"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+	"github.com/numb3r3/jsmpeg-relay/timeshift"
+)
+
+var start = time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+
+func at(s int) time.Time {
+	return start.Add(time.Duration(s) * time.Second)
+}
+
+// stream returns a test stream with a keyframe every second and the
+// offsets of its keyframes.
+func stream(t *testing.T, seconds int) ([]byte, []int) {
+	t.Helper()
+	var buf bytes.Buffer
+	gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < seconds*25; i++ {
+		if err := gen.WriteFrame(start.Add(time.Duration(i) * gen.FrameDuration())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keyframes []int
+	for i, p := range mpegts.Packets(buf.Bytes()) {
+		if mpegts.IsKeyframe(p) {
+			keyframes = append(keyframes, i*mpegts.PacketSize)
+		}
+	}
+	if len(keyframes) != seconds {
+		t.Fatalf("got %v keyframes", len(keyframes))
+	}
+	return buf.Bytes(), keyframes
+}
+
+// recording stores data as a recording started at a time.
+func recording(t *testing.T, id string, data []byte, started, ended time.Time) record.Recording {
+	t.Helper()
+	rec := record.Recording{ID: id, App: "live", Key: "news", Path: filepath.Join(t.TempDir(), id+".ts"), StartedAt: started, EndedAt: ended}
+	if err := os.WriteFile(rec.Path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func clipBytes(t *testing.T, c *Clip) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withTables returns data following the tables numbered to continue into it.
+func withTables(tables, data []byte) []byte {
+	return append(continueTables(tables, mpegts.Packets(data)), data...)
+}
+
+func TestLive(t *testing.T) {
+	data, keyframes := stream(t, 5)
+	b := timeshift.NewBuffer(time.Minute)
+	if _, err := Live(b, at(0), at(1)); err != ErrEmpty {
+		t.Errorf("empty buffer: got %v, want %v", err, ErrEmpty)
+	}
+	for i, k := range keyframes {
+		end := len(data)
+		if i+1 < len(keyframes) {
+			end = keyframes[i+1]
+		}
+		b.Write(at(i), data[k:end])
+	}
+	tables := b.Tables()
+
+	c, err := Live(b, at(1).Add(500*time.Millisecond), at(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := withTables(tables, data[keyframes[1]:keyframes[3]])
+	if got := clipBytes(t, c); !bytes.Equal(got, want) {
+		t.Errorf("got %v bytes, want %v", len(got), len(want))
+	}
+}
+
+func TestLiveNoTables(t *testing.T) {
+	data, keyframes := stream(t, 2)
+	b := timeshift.NewBuffer(time.Minute)
+	// the keyframe alone, without the tables written before it
+	b.Write(at(0), mpegts.Packets(data[keyframes[0]:])[0])
+	if _, err := Live(b, at(0), at(1)); err != ErrNoTables {
+		t.Errorf("got %v, want %v", err, ErrNoTables)
+	}
+}
+
+func TestFromRecordings(t *testing.T) {
+	data, keyframes := stream(t, 6)
+	tables, err := readTables(recording(t, "tables", data, start, time.Time{}).Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first recording covers 0s to 3s, the second one 2s to the end
+	first := recording(t, "first", data[:keyframes[3]], at(0), at(3))
+	second := recording(t, "second", data[keyframes[2]:], at(2), time.Time{})
+	overlapping := append(withTables(tables, data[keyframes[1]:keyframes[3]]), withTables(tables, data[keyframes[3]:keyframes[4]])...)
+
+	tests := []struct {
+		name     string
+		recs     []record.Recording
+		from, to time.Time
+		want     []byte
+		err      error
+	}{
+		{"single", []record.Recording{first}, at(1), at(2), withTables(tables, data[keyframes[1]:keyframes[2]]), nil},
+		{"up to the end", []record.Recording{first}, at(1), at(10), withTables(tables, data[keyframes[1]:keyframes[3]]), nil},
+		{"overlapping", []record.Recording{first, second}, at(1), at(4), overlapping, nil},
+		{"overlapping unsorted", []record.Recording{second, first}, at(1), at(4), overlapping, nil},
+		{"covered by the first", []record.Recording{first, second}, at(0), at(2), withTables(tables, data[keyframes[0]:keyframes[2]]), nil},
+		{"before", []record.Recording{second}, at(0), at(1), nil, ErrEmpty},
+		{"after", []record.Recording{first}, at(4), at(5), nil, ErrEmpty},
+	}
+	for _, tt := range tests {
+		c, err := FromRecordings(tt.recs, tt.from, tt.to)
+		if err != tt.err {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := clipBytes(t, c); !bytes.Equal(got, tt.want) {
+			t.Errorf("%v: got %v bytes, want %v", tt.name, len(got), len(tt.want))
+		}
+	}
+}
+
+func TestFromRecordingsNoTables(t *testing.T) {
+	data, keyframes := stream(t, 2)
+	// the first picture group, without the tables written at its start and
+	// before the next one
+	tables := keyframes[0]
+	rec := recording(t, "rec", data[tables:keyframes[1]-tables], at(0), at(1))
+	if _, err := FromRecordings([]record.Recording{rec}, at(0), at(1)); err != ErrNoTables {
+		t.Errorf("got %v, want %v", err, ErrNoTables)
+	}
+}
+
+func TestContinueTables(t *testing.T) {
+	data, keyframes := stream(t, 2)
+	tables := mpegts.Packets(data[:keyframes[0]])
+	var pat []byte
+	for _, p := range tables {
+		if p.PID() == 0 {
+			pat = p
+		}
+	}
+	if pat == nil {
+		t.Fatal("no PAT before the keyframe")
+	}
+
+	orig := append([]byte{}, pat...)
+	next := append([]byte{}, pat...)
+	next[3] &= 0xf0 // the table following has counter 0
+	got := mpegts.Packets(continueTables(pat, mpegts.Packets(next)))
+	if cc := got[0].ContinuityCounter(); cc != 0x0f {
+		t.Errorf("got counter %v, want 15", cc)
+	}
+	if !bytes.Equal(pat, orig) {
+		t.Error("the tables given were modified")
+	}
+
+	// the counters of PIDs missing from the packets which follow are kept
+	got = mpegts.Packets(continueTables(pat, nil))
+	if !bytes.Equal(got[0], orig) {
+		t.Errorf("got %x, want %x", got[0], orig)
+	}
+}
@@ -0,0 +1,331 @@
+// Package config loads the configuration file of the relay server, a YAML
+// file of global settings and per-app blocks, overridden by environment
+// variables like JSMPEG_RELAY_ADMIN_TOKEN or
+// JSMPEG_RELAY_APPS_LIVE_PUBLISH_SECRET.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/egress"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/relay"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding the file, named
+// after the upper-cased path of their setting.
+const EnvPrefix = "JSMPEG_RELAY_"
+
+// Config is the content of a configuration file.
+type Config struct {
+	Listen          []string      `yaml:"listen"`
+	RecordDir       string        `yaml:"record_dir"`
+	Timeshift       time.Duration `yaml:"timeshift"`
+	HLSDuration     time.Duration `yaml:"hls_duration"`
+	HLSWindow       int           `yaml:"hls_window"`
+	AdminToken      string        `yaml:"admin_token"`
+	GracefulTimeout time.Duration `yaml:"graceful_timeout"`
+	Debug           bool          `yaml:"debug"`
+	Broker          Broker        `yaml:"broker"`
+	UDPOutputs      []string      `yaml:"udp_outputs"` // like live/news=udp://239.0.0.1:1234
+	Policy          string        `yaml:"policy"`      // of the apps without their own
+
+	// Strict refuses the publishers and viewers of the apps not declared.
+	Strict bool            `yaml:"strict"`
+	Apps   map[string]*App `yaml:"apps"`
+}
+
+// Broker is the broker block of a configuration file.
+type Broker struct {
+	QueueSize    int `yaml:"queue_size"`
+	GOPCacheSize int `yaml:"gop_cache_size"`
+}
+
+// App is the block of an app in a configuration file.
+type App struct {
+	PublishSecret  string   `yaml:"publish_secret"`
+	PlaySecret     string   `yaml:"play_secret"`
+	MaxPublishers  int      `yaml:"max_publishers"`
+	MaxViewers     int      `yaml:"max_viewers"`
+	Record         bool     `yaml:"record"`
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	QueueSize      int      `yaml:"queue_size"`
+	Overflow       string   `yaml:"overflow"` // skip or disconnect
+	Slate          string   `yaml:"slate"`
+	Policy         string   `yaml:"policy"` // like codecs=reject,max-width=1280
+}
+
+// create a new config with the defaults of the relay command
+func Default() *Config {
+	opts := relay.DefaultOptions
+	return &Config{
+		Listen:          opts.Addrs,
+		RecordDir:       opts.RecordDir,
+		Timeshift:       opts.Timeshift,
+		HLSDuration:     opts.HLSDuration,
+		HLSWindow:       opts.HLSWindow,
+		GracefulTimeout: 15 * time.Second,
+		Debug:           opts.Debug,
+		Broker:          Broker{QueueSize: opts.Broker.QueueSize, GOPCacheSize: opts.Broker.GOPCacheSize},
+	}
+}
+
+// Load reads a configuration file over the defaults, applies the
+// environment variables and validates the result into the options of the
+// relay, the error lists all the problems found.
+func Load(path string) (*Config, relay.Options, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, relay.Options{}, err
+	}
+	defer f.Close()
+
+	c := Default()
+	var errs []error
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			return nil, relay.Options{}, err
+		}
+		// the decoder goes on after the fields of a wrong type
+		for _, e := range te.Errors {
+			errs = append(errs, errors.New(e))
+		}
+	}
+	errs = append(errs, c.applyEnv(os.LookupEnv)...)
+	opts, err := c.Options()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return c, opts, errors.Join(errs...)
+}
+
+// applyEnv overrides the settings with the environment variables, the lists
+// are separated by commas. The apps must be declared in the file.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) []error {
+	errs := applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+	for name, app := range c.Apps {
+		if app == nil {
+			continue
+		}
+		prefix := EnvPrefix + "APPS_" + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name)) + "_"
+		errs = append(errs, applyEnv(reflect.ValueOf(app).Elem(), prefix, lookup)...)
+	}
+	return errs
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) []error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + strings.ToUpper(v.Type().Field(i).Tag.Get("yaml"))
+		switch field.Kind() {
+		case reflect.Struct:
+			errs = append(errs, applyEnv(field, name+"_", lookup)...)
+			continue
+		case reflect.Map:
+			continue
+		}
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", name, err))
+		}
+	}
+	return errs
+}
+
+// setValue parses the value of an environment variable into a setting.
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var values []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	}
+	return nil
+}
+
+// Options validates the config and converts it to the options of a relay
+// server, the error lists all the invalid settings.
+func (c *Config) Options() (relay.Options, error) {
+	opts := relay.Options{
+		Addrs:       c.Listen,
+		Broker:      pubsub.Config{QueueSize: c.Broker.QueueSize, GOPCacheSize: c.Broker.GOPCacheSize},
+		RecordDir:   c.RecordDir,
+		Timeshift:   c.Timeshift,
+		HLSDuration: c.HLSDuration,
+		HLSWindow:   c.HLSWindow,
+		Policies:    map[string]streams.Policy{},
+		AdminToken:  c.AdminToken,
+		Apps:        map[string]relay.AppOptions{},
+		Strict:      c.Strict,
+		Debug:       c.Debug,
+	}
+
+	var errs []error
+	invalid := func(path string, format string, v ...interface{}) {
+		errs = append(errs, fmt.Errorf("%v: %v", path, fmt.Sprintf(format, v...)))
+	}
+	if len(c.Listen) == 0 {
+		invalid("listen", "no address to listen on")
+	}
+	for i, addr := range c.Listen {
+		if _, port, err := net.SplitHostPort(addr); err != nil {
+			invalid(fmt.Sprintf("listen[%d]", i), "%v", err)
+		} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			invalid(fmt.Sprintf("listen[%d]", i), "invalid port %q", port)
+		}
+	}
+	if c.RecordDir == "" {
+		invalid("record_dir", "must not be empty")
+	}
+	if c.Timeshift < 0 {
+		invalid("timeshift", "must not be negative")
+	}
+	if c.HLSWindow < 0 {
+		invalid("hls_window", "must not be negative")
+	}
+	if c.HLSWindow > 0 && c.HLSDuration <= 0 {
+		invalid("hls_duration", "must be positive when hls_window is")
+	}
+	if c.GracefulTimeout < 0 {
+		invalid("graceful_timeout", "must not be negative")
+	}
+	if c.Broker.QueueSize < 0 {
+		invalid("broker.queue_size", "must not be negative")
+	}
+	if c.Broker.GOPCacheSize < 0 {
+		invalid("broker.gop_cache_size", "must not be negative")
+	}
+	for i, output := range c.UDPOutputs {
+		path := fmt.Sprintf("udp_outputs[%d]", i)
+		topic, rawurl, ok := strings.Cut(output, "=")
+		if !ok {
+			invalid(path, "expecting app/key=udp://host:port, got %q", output)
+			continue
+		}
+		cfg, err := egress.ParseURL(topic, rawurl)
+		if err != nil {
+			invalid(path, "%v", err)
+			continue
+		}
+		opts.Outputs = append(opts.Outputs, cfg)
+	}
+	if c.Policy != "" {
+		if _, policy, err := streams.ParsePolicy("*:" + c.Policy); err != nil {
+			invalid("policy", "%v", err)
+		} else {
+			opts.Policies["*"] = policy
+		}
+	}
+	if c.Strict && len(c.Apps) == 0 {
+		invalid("strict", "no app declared")
+	}
+
+	names := make([]string, 0, len(c.Apps))
+	for name := range c.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		app, path := c.Apps[name], "apps."+name
+		if name == "" || strings.ContainsAny(name, "/:* ") {
+			invalid(path, "invalid app name %q", name)
+		}
+		if app == nil {
+			opts.Apps[name] = relay.AppOptions{}
+			continue
+		}
+		if app.MaxPublishers < 0 {
+			invalid(path+".max_publishers", "must not be negative")
+		}
+		if app.MaxViewers < 0 {
+			invalid(path+".max_viewers", "must not be negative")
+		}
+		if app.QueueSize < 0 {
+			invalid(path+".queue_size", "must not be negative")
+		}
+		switch app.Overflow {
+		case "", pubsub.OverflowSkip, pubsub.OverflowDisconnect:
+		default:
+			invalid(path+".overflow", "invalid policy %q, expecting skip or disconnect", app.Overflow)
+		}
+		for i, origin := range app.AllowedOrigins {
+			if origin == "*" {
+				continue
+			}
+			if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+				invalid(fmt.Sprintf("%v.allowed_origins[%d]", path, i), "invalid origin %q, expecting like https://example.com", origin)
+			}
+		}
+		if app.Slate != "" {
+			if info, err := os.Stat(app.Slate); err != nil {
+				invalid(path+".slate", "%v", err)
+			} else if info.IsDir() {
+				invalid(path+".slate", "%v is a directory", app.Slate)
+			}
+		}
+		if app.Policy != "" {
+			if _, policy, err := streams.ParsePolicy(name + ":" + app.Policy); err != nil {
+				invalid(path+".policy", "%v", err)
+			} else {
+				opts.Policies[name] = policy
+			}
+		}
+		opts.Apps[name] = relay.AppOptions{
+			PublishSecret:  app.PublishSecret,
+			PlaySecret:     app.PlaySecret,
+			MaxPublishers:  app.MaxPublishers,
+			MaxViewers:     app.MaxViewers,
+			Record:         app.Record,
+			AllowedOrigins: app.AllowedOrigins,
+			QueueSize:      app.QueueSize,
+			Overflow:       app.Overflow,
+			Slate:          app.Slate,
+		}
+	}
+	return opts, errors.Join(errs...)
+}
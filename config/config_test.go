@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// write writes a configuration file in a temporary directory.
+func write(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "relay.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	slate := write(t, "")
+	tests := []struct {
+		name    string
+		content string
+		errors  []string // the settings or lines reported, nil when valid
+	}{
+		{name: "empty", content: ""},
+		{
+			name: "apps",
+			content: `
+listen: [":8080", "127.0.0.1:8081"]
+strict: true
+policy: codecs=reject
+apps:
+  live:
+    publish_secret: pub
+    max_viewers: 10
+    allowed_origins: ["https://example.com", "*"]
+    overflow: disconnect
+    slate: ` + slate + `
+    policy: max-width=1280
+  open:
+`,
+		},
+		{
+			name: "invalid settings",
+			content: `
+listen: ["nowhere"]
+record_dir: ""
+timeshift: -1s
+hls_window: 3
+hls_duration: 0s
+broker:
+  queue_size: -1
+udp_outputs: ["live/news", "live/news=tcp://1.2.3.4:5"]
+apps:
+  "a/b":
+  live:
+    max_viewers: -1
+    overflow: drop
+    allowed_origins: ["example.com"]
+    slate: /nonexistent/slate.ts
+`,
+			errors: []string{
+				"listen[0]", "record_dir", "timeshift", "hls_duration", "broker.queue_size",
+				"udp_outputs[0]", "udp_outputs[1]", "apps.a/b", "apps.live.max_viewers",
+				"apps.live.overflow", "apps.live.allowed_origins[0]", "apps.live.slate",
+			},
+		},
+		{name: "strict without apps", content: "strict: true\n", errors: []string{"strict"}},
+		{name: "wrong types", content: "hls_window: many\ndebug: maybe\n", errors: []string{"line 1", "line 2"}},
+	}
+	for _, tt := range tests {
+		_, _, err := Load(write(t, tt.content))
+		if tt.errors == nil {
+			if err != nil {
+				t.Errorf("%v: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: no error", tt.name)
+			continue
+		}
+		for _, setting := range tt.errors {
+			if !strings.Contains(err.Error(), setting) {
+				t.Errorf("%v: %v is not reported in %q", tt.name, setting, err)
+			}
+		}
+		if got := len(strings.Split(err.Error(), "\n")); got != len(tt.errors) {
+			t.Errorf("%v: got %d errors, want %d: %v", tt.name, got, len(tt.errors), err)
+		}
+	}
+
+	// the options are validated once, by Load
+	_, opts, err := Load(write(t, "strict: true\napps:\n  live:\n    publish_secret: pub\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Strict || opts.Apps["live"].PublishSecret != "pub" {
+		t.Errorf("got options %+v", opts)
+	}
+
+	if _, _, err := Load(write(t, "unknown: 1\n")); err == nil {
+		t.Error("an unknown setting was accepted")
+	}
+	if _, _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("a missing file was accepted")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"JSMPEG_RELAY_ADMIN_TOKEN":                 "secret",
+		"JSMPEG_RELAY_LISTEN":                      ":9000, :9001,",
+		"JSMPEG_RELAY_TIMESHIFT":                   "90s",
+		"JSMPEG_RELAY_DEBUG":                       "true",
+		"JSMPEG_RELAY_BROKER_QUEUE_SIZE":           "64",
+		"JSMPEG_RELAY_APPS_LIVE_PUBLISH_SECRET":    "pub",
+		"JSMPEG_RELAY_APPS_NEWS_HD_MAX_VIEWERS":    "5",
+		"JSMPEG_RELAY_APPS_UNDECLARED_PLAY_SECRET": "ignored",
+	}
+	c := Default()
+	c.Apps = map[string]*App{"live": {PlaySecret: "view"}, "news.hd": {}, "empty": nil}
+	errs := c.applyEnv(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	want := Default()
+	want.AdminToken = "secret"
+	want.Listen = []string{":9000", ":9001"}
+	want.Timeshift = 90 * time.Second
+	want.Debug = true
+	want.Broker.QueueSize = 64
+	want.Apps = map[string]*App{"live": {PublishSecret: "pub", PlaySecret: "view"}, "news.hd": {MaxViewers: 5}, "empty": nil}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	tests := []struct {
+		name, value string
+	}{
+		{"JSMPEG_RELAY_TIMESHIFT", "90"},
+		{"JSMPEG_RELAY_HLS_WINDOW", "many"},
+		{"JSMPEG_RELAY_STRICT", "maybe"},
+	}
+	for _, tt := range tests {
+		errs := Default().applyEnv(func(name string) (string, bool) {
+			return tt.value, name == tt.name
+		})
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.name) {
+			t.Errorf("%v=%v: got %v", tt.name, tt.value, errs)
+		}
+	}
+}
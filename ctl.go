@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/record"
+	"github.com/numb3r3/jsmpeg-relay/relay"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+const ctlUsage = `usage: jsmpeg-relay ctl [-url URL] [-token TOKEN] [-json] COMMAND
+
+commands:
+  streams ls [-app APP]                 list the topics and their publishers
+  viewers ls [APP/KEY]                  list the viewers, of a topic or all
+  kick ID...                            disconnect viewers by id or id prefix
+  terminate APP/KEY                     disconnect the publisher of a topic
+  record ls                             list the recording schedules
+  record start APP/KEY [-for DURATION]  record a topic from now on
+  record stop APP/KEY|SCHEDULE_ID       stop recording a topic, cron schedules by id
+  ban ls                                list the banned addresses
+  ban add IP [-for DURATION] [-reason REASON]
+  ban rm IP
+
+the url and token default to $JSMPEG_RELAY_URL and $JSMPEG_RELAY_TOKEN.
+`
+
+// ctlClient calls the admin API of a relay.
+type ctlClient struct {
+	url    string
+	token  string
+	json   bool
+	out    io.Writer
+	client *http.Client
+}
+
+// ctlCommand runs the ctl subcommand, returning the exit code.
+func ctlCommand(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, ctlUsage) }
+	url := fs.String("url", envOr("JSMPEG_RELAY_URL", "http://127.0.0.1:8080"), "the address of the relay")
+	token := fs.String("token", os.Getenv("JSMPEG_RELAY_TOKEN"), "the admin token of the relay")
+	asJSON := fs.Bool("json", false, "print JSON instead of tables")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	c := &ctlClient{
+		url:    strings.TrimRight(*url, "/"),
+		token:  *token,
+		json:   *asJSON,
+		out:    os.Stdout,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := c.run(fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		if err == errUsage {
+			fmt.Fprint(os.Stderr, ctlUsage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+var errUsage = errors.New("invalid command")
+
+func envOr(name, value string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return value
+}
+
+func (c *ctlClient) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	if len(args) > 0 && (cmd == "streams" || cmd == "viewers" || cmd == "record" || cmd == "ban") {
+		cmd, args = cmd+" "+args[0], args[1:]
+	}
+
+	switch cmd {
+	case "streams ls":
+		fs := flag.NewFlagSet("streams ls", flag.ContinueOnError)
+		app := fs.String("app", "", "only the topics of an app")
+		if err := fs.Parse(args); err != nil {
+			return errUsage
+		}
+		return c.listStreams(*app)
+	case "viewers ls":
+		if len(args) > 1 {
+			return errUsage
+		}
+		return c.listViewers(args)
+	case "kick":
+		if len(args) == 0 {
+			return errUsage
+		}
+		return c.kick(args)
+	case "terminate":
+		if len(args) != 1 || !strings.Contains(args[0], "/") {
+			return errUsage
+		}
+		return c.call("DELETE", "/api/admin/streams/"+args[0], nil, nil)
+	case "record ls":
+		return c.listSchedules()
+	case "record start":
+		fs := flag.NewFlagSet("record start", flag.ContinueOnError)
+		duration := fs.Duration("for", 24*time.Hour, "how long to record")
+		if len(args) == 0 || fs.Parse(args[1:]) != nil || !strings.Contains(args[0], "/") {
+			return errUsage
+		}
+		return c.startRecording(args[0], *duration)
+	case "record stop":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.stopRecording(args[0])
+	case "ban ls":
+		return c.listBans()
+	case "ban add":
+		fs := flag.NewFlagSet("ban add", flag.ContinueOnError)
+		duration := fs.Duration("for", 0, "how long to ban, forever by default")
+		reason := fs.String("reason", "", "why the address is banned")
+		if len(args) == 0 || fs.Parse(args[1:]) != nil {
+			return errUsage
+		}
+		req := map[string]string{"addr": args[0], "reason": *reason}
+		if *duration > 0 {
+			req["duration"] = duration.String()
+		}
+		var b relay.Ban
+		if err := c.call("POST", "/api/admin/bans", req, &b); err != nil {
+			return err
+		}
+		return c.printBans([]relay.Ban{b})
+	case "ban rm":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.call("DELETE", "/api/admin/bans/"+args[0], nil, nil)
+	}
+	return errUsage
+}
+
+// call sends a request with body as JSON and decodes the response into
+// out.
+func (c *ctlClient) call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%v %v: %v", method, path, e.Error)
+		}
+		return fmt.Errorf("%v %v: %v", method, path, resp.Status)
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// print prints v as JSON with -json, or the rows aligned in columns.
+func (c *ctlClient) print(v interface{}, header string, rows [][]interface{}) {
+	if c.json {
+		data, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Fprintln(c.out, string(data))
+		return
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprint(cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+}
+
+func since(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return time.Since(t).Truncate(time.Second).String()
+}
+
+func (c *ctlClient) listStreams(app string) error {
+	var topics []relay.TopicStatus
+	if err := c.call("GET", "/api/admin/topics", nil, &topics); err != nil {
+		return err
+	}
+	rows := [][]interface{}{}
+	for _, t := range topics {
+		if app != "" && !strings.HasPrefix(t.Topic, app+"/") {
+			continue
+		}
+		publisher, state := "-", "-"
+		if t.Live {
+			publisher, state = t.RemoteAddr, t.State
+		}
+		rows = append(rows, []interface{}{t.Topic, publisher, since(t.StartedAt), state,
+			fmt.Sprintf("%d kbit/s", t.Bitrate/1000), t.Viewers, t.Subscribers, t.Dropped})
+	}
+	c.print(topics, "TOPIC\tPUBLISHER\tUPTIME\tSTATE\tBITRATE\tVIEWERS\tSUBSCRIBERS\tDROPPED", rows)
+	return nil
+}
+
+func (c *ctlClient) listViewers(args []string) error {
+	path := "/api/admin/viewers"
+	if len(args) == 1 {
+		path = "/api/admin/topics/" + args[0] + "/viewers"
+	}
+	var viewers []streams.ViewerStatus
+	if err := c.call("GET", path, nil, &viewers); err != nil {
+		return err
+	}
+	rows := [][]interface{}{}
+	for _, v := range viewers {
+		id := v.ID
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		rows = append(rows, []interface{}{id, v.App + "/" + v.Key, v.RemoteAddr, v.Protocol,
+			since(v.ConnectedAt), v.BytesSent, v.QueueDepth, v.Dropped})
+	}
+	c.print(viewers, "ID\tTOPIC\tADDRESS\tPROTOCOL\tCONNECTED\tBYTES SENT\tQUEUE\tDROPPED", rows)
+	return nil
+}
+
+// kick disconnects viewers given by a unique prefix of their id, as listed.
+func (c *ctlClient) kick(prefixes []string) error {
+	var viewers []streams.ViewerStatus
+	if err := c.call("GET", "/api/admin/viewers", nil, &viewers); err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		var ids []string
+		for _, v := range viewers {
+			if strings.HasPrefix(v.ID, prefix) {
+				ids = append(ids, v.ID)
+			}
+		}
+		switch len(ids) {
+		case 0:
+			return fmt.Errorf("no viewer %v", prefix)
+		case 1:
+			if err := c.call("DELETE", "/api/admin/viewers/"+ids[0], nil, nil); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("ambiguous viewer %v", prefix)
+		}
+	}
+	return nil
+}
+
+func (c *ctlClient) listSchedules() error {
+	var schedules []record.Schedule
+	if err := c.call("GET", "/api/schedules", nil, &schedules); err != nil {
+		return err
+	}
+	rows := [][]interface{}{}
+	for _, s := range schedules {
+		when := s.Start.Local().Format(time.RFC3339) + " - " + s.End.Local().Format(time.RFC3339)
+		if s.Cron != "" {
+			when = fmt.Sprintf("%v for %v", s.Cron, time.Duration(s.Duration))
+		}
+		rows = append(rows, []interface{}{s.ID, s.Topic(), when})
+	}
+	c.print(schedules, "ID\tTOPIC\tWHEN", rows)
+	return nil
+}
+
+func (c *ctlClient) startRecording(topic string, duration time.Duration) error {
+	i := strings.Index(topic, "/")
+	now := time.Now()
+	sched := record.Schedule{App: topic[:i], Key: topic[i+1:], Start: now, End: now.Add(duration)}
+	if err := c.call("POST", "/api/schedules", sched, &sched); err != nil {
+		return err
+	}
+	c.print(sched, "TOPIC\tUNTIL\tSCHEDULE", [][]interface{}{{topic, sched.End.Local().Format(time.RFC3339), sched.ID}})
+	return nil
+}
+
+// stopRecording removes a schedule by id, or the one-shot schedules of a
+// topic whose window is open. Removing a cron schedule loses its next
+// windows too, so they are only removed by id.
+func (c *ctlClient) stopRecording(ref string) error {
+	if !strings.Contains(ref, "/") {
+		return c.call("DELETE", "/api/schedules/"+ref, nil, nil)
+	}
+	var schedules []record.Schedule
+	if err := c.call("GET", "/api/schedules", nil, &schedules); err != nil {
+		return err
+	}
+	stopped := 0
+	var recurring []string
+	for _, s := range schedules {
+		if s.Topic() != ref || s.Validate() != nil {
+			continue
+		}
+		if _, _, open := s.Window(time.Now()); !open {
+			continue
+		}
+		if s.Cron != "" {
+			recurring = append(recurring, s.ID)
+			continue
+		}
+		if err := c.call("DELETE", "/api/schedules/"+s.ID, nil, nil); err != nil {
+			return err
+		}
+		stopped++
+	}
+	if len(recurring) > 0 {
+		return fmt.Errorf("%v is recorded by the cron schedules %v, remove them by id", ref, strings.Join(recurring, ", "))
+	}
+	if stopped == 0 {
+		return fmt.Errorf("%v is not being recorded", ref)
+	}
+	return nil
+}
+
+func (c *ctlClient) listBans() error {
+	var list []relay.Ban
+	if err := c.call("GET", "/api/admin/bans", nil, &list); err != nil {
+		return err
+	}
+	return c.printBans(list)
+}
+
+func (c *ctlClient) printBans(list []relay.Ban) error {
+	rows := [][]interface{}{}
+	for _, b := range list {
+		until := "forever"
+		if b.Until != nil {
+			until = b.Until.Local().Format(time.RFC3339)
+		}
+		rows = append(rows, []interface{}{b.Addr, until, b.Reason})
+	}
+	c.print(list, "ADDRESS\tUNTIL\tREASON", rows)
+	return nil
+}
@@ -0,0 +1,84 @@
+package egress
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+)
+
+var ErrNotFound = errors.New("output not found")
+
+// Manager keeps the running outputs.
+type Manager struct {
+	sync.Mutex
+	broker  *pubsub.Broker
+	outputs map[string]*UDPOutput
+}
+
+// create a new output manager
+func NewManager(broker *pubsub.Broker) *Manager {
+	return &Manager{
+		broker:  broker,
+		outputs: map[string]*UDPOutput{},
+	}
+}
+
+// Add starts a new output.
+func (m *Manager) Add(cfg Config) (Status, error) {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	o, err := StartUDP(m.broker, hex.EncodeToString(id), cfg)
+	if err != nil {
+		return Status{}, err
+	}
+	m.Lock()
+	m.outputs[o.id] = o
+	m.Unlock()
+	return o.Status(), nil
+}
+
+// Remove stops an output.
+func (m *Manager) Remove(id string) error {
+	m.Lock()
+	o, ok := m.outputs[id]
+	delete(m.outputs, id)
+	m.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	o.Close()
+	return nil
+}
+
+// List returns the status of the outputs ordered by topic.
+func (m *Manager) List() []Status {
+	m.Lock()
+	defer m.Unlock()
+	list := make([]Status, 0, len(m.outputs))
+	for _, o := range m.outputs {
+		list = append(list, o.Status())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Topic != list[j].Topic {
+			return list[i].Topic < list[j].Topic
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Close stops all the outputs.
+func (m *Manager) Close() {
+	m.Lock()
+	outputs := m.outputs
+	m.outputs = map[string]*UDPOutput{}
+	m.Unlock()
+	for _, o := range outputs {
+		o.Close()
+	}
+}
@@ -0,0 +1,14 @@
+package egress
+
+import (
+	"errors"
+	"net"
+)
+
+// setTTL only accepts the default time to live on windows.
+func setTTL(conn *net.UDPConn, ip net.IP, ttl int) error {
+	if ttl != DefaultTTL {
+		return errors.New("setting the ttl is not supported on windows")
+	}
+	return nil
+}
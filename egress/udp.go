@@ -0,0 +1,232 @@
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+)
+
+const (
+	// 7 packets of 188 bytes fit in an ethernet frame
+	DefaultPacketsPerDatagram = 7
+	MaxPacketsPerDatagram     = 7
+	DefaultTTL                = 1
+
+	// how far ahead of the wall clock the PCR may be before the pacing is
+	// restarted rather than holding the output back
+	maxPaceAhead = time.Second
+)
+
+// Config describes where an output sends its topic.
+type Config struct {
+	Topic              string `json:"topic"`
+	Addr               string `json:"addr"`
+	TTL                int    `json:"ttl"`
+	PacketsPerDatagram int    `json:"packets_per_datagram"`
+}
+
+// ParseURL parses an output like "udp://239.0.0.1:1234?ttl=4&pkts=7".
+func ParseURL(topic, rawurl string) (Config, error) {
+	cfg := Config{Topic: topic}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return cfg, err
+	}
+	if u.Scheme != "udp" {
+		return cfg, fmt.Errorf("unsupported output %q, expecting udp://host:port", rawurl)
+	}
+	cfg.Addr = u.Host
+	if v := u.Query().Get("ttl"); v != "" {
+		if cfg.TTL, err = strconv.Atoi(v); err != nil {
+			return cfg, fmt.Errorf("invalid ttl %q", v)
+		}
+	}
+	if v := u.Query().Get("pkts"); v != "" {
+		if cfg.PacketsPerDatagram, err = strconv.Atoi(v); err != nil || cfg.PacketsPerDatagram < 1 || cfg.PacketsPerDatagram > MaxPacketsPerDatagram {
+			return cfg, fmt.Errorf("invalid pkts %q, expecting 1 to %d", v, MaxPacketsPerDatagram)
+		}
+	}
+	return cfg, nil
+}
+
+// Stats are the counters of an output.
+type Stats struct {
+	StartedAt time.Time `json:"started_at"`
+	Datagrams uint64    `json:"datagrams"`
+	Bytes     uint64    `json:"bytes"`
+	Dropped   uint64    `json:"dropped"`
+	Errors    uint64    `json:"errors"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Status describes a running output.
+type Status struct {
+	ID string `json:"id"`
+	Config
+	Stats Stats `json:"stats"`
+}
+
+// UDPOutput sends the packets of a topic as MPEG-TS over UDP, it reads the
+// topic like any other subscriber of the broker and paces the datagrams by
+// the PCR, as receivers expect a steady rate rather than the bursts of the
+// publisher.
+type UDPOutput struct {
+	sync.RWMutex
+	id      string
+	cfg     Config
+	conn    *net.UDPConn
+	sub     *pubsub.Subscriber
+	stats   Stats
+	pending []byte
+	pacer   mpegts.Pacer
+	stop    chan bool
+	done    chan bool
+}
+
+// StartUDP opens the socket of an output and starts relaying its topic.
+func StartUDP(broker *pubsub.Broker, id string, cfg Config) (*UDPOutput, error) {
+	if cfg.Topic == "" {
+		return nil, errors.New("an output requires a topic")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.PacketsPerDatagram == 0 {
+		cfg.PacketsPerDatagram = DefaultPacketsPerDatagram
+	}
+	if cfg.PacketsPerDatagram < 1 || cfg.PacketsPerDatagram > MaxPacketsPerDatagram {
+		return nil, fmt.Errorf("invalid packets per datagram %d, expecting 1 to %d", cfg.PacketsPerDatagram, MaxPacketsPerDatagram)
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := setTTL(conn, raddr.IP, cfg.TTL); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	sub, err := broker.Attach()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	broker.Subscribe(sub, cfg.Topic)
+
+	o := &UDPOutput{
+		id:    id,
+		cfg:   cfg,
+		conn:  conn,
+		sub:   sub,
+		stats: Stats{StartedAt: time.Now()},
+		stop:  make(chan bool, 1),
+		done:  make(chan bool),
+	}
+	go o.run(broker)
+	logging.Infof("[egress] %v: sending %v to udp://%v", id, cfg.Topic, cfg.Addr)
+	return o, nil
+}
+
+func (o *UDPOutput) run(broker *pubsub.Broker) {
+	defer func() {
+		broker.Detach(o.sub)
+		o.conn.Close()
+		close(o.done)
+	}()
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-o.sub.Closing():
+			return
+		case msg, ok := <-o.sub.GetMessages():
+			if !ok {
+				return
+			}
+			if !o.send(msg.GetData()) {
+				return
+			}
+		}
+	}
+}
+
+// send writes full datagrams when they are due, the packets left over wait
+// for the next message. It returns false when the output was stopped.
+func (o *UDPOutput) send(data []byte) bool {
+	size := o.cfg.PacketsPerDatagram * mpegts.PacketSize
+	o.pending = append(o.pending, data...)
+	sent := 0
+	for ; sent+size <= len(o.pending); sent += size {
+		datagram := o.pending[sent : sent+size]
+		if delay := o.delay(datagram); delay > 0 {
+			select {
+			case <-o.stop:
+				return false
+			case <-time.After(delay):
+			}
+		}
+		n, err := o.conn.Write(datagram)
+		o.Lock()
+		if err != nil {
+			o.stats.Errors++
+			o.stats.LastError = err.Error()
+		} else {
+			o.stats.Datagrams++
+			o.stats.Bytes += uint64(n)
+		}
+		o.Unlock()
+	}
+	o.pending = append(o.pending[:0], o.pending[sent:]...)
+	return true
+}
+
+// delay returns how long to wait before sending a datagram for its PCR to
+// leave at the pace of the stream.
+func (o *UDPOutput) delay(datagram []byte) time.Duration {
+	var delay time.Duration
+	now := time.Now()
+	for _, pkt := range mpegts.Packets(datagram) {
+		if d := o.pacer.Delay(pkt, now); d > delay {
+			delay = d
+		}
+	}
+	if delay > maxPaceAhead {
+		// the publisher runs faster than its clock, or it jumped
+		o.pacer.Reset()
+		return 0
+	}
+	return delay
+}
+
+// Status returns the configuration and the counters of the output.
+func (o *UDPOutput) Status() Status {
+	o.RLock()
+	defer o.RUnlock()
+	stats := o.stats
+	stats.Dropped = o.sub.Dropped()
+	return Status{ID: o.id, Config: o.cfg, Stats: stats}
+}
+
+// Close stops the output and closes its socket.
+func (o *UDPOutput) Close() {
+	select {
+	case o.stop <- true:
+	default:
+	}
+	<-o.done
+	logging.Infof("[egress] %v: stopped", o.id)
+}
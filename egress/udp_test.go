@@ -0,0 +1,156 @@
+package egress
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Config
+		ok   bool
+	}{
+		{"udp://239.0.0.1:1234", Config{Topic: "live/news", Addr: "239.0.0.1:1234"}, true},
+		{"udp://239.0.0.1:1234?ttl=4&pkts=1", Config{Topic: "live/news", Addr: "239.0.0.1:1234", TTL: 4, PacketsPerDatagram: 1}, true},
+		{"tcp://239.0.0.1:1234", Config{}, false},
+		{"udp://239.0.0.1:1234?ttl=many", Config{}, false},
+		{"udp://239.0.0.1:1234?pkts=8", Config{}, false},
+		{"udp://239.0.0.1:1234?pkts=0", Config{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseURL("live/news", tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: got error %v", tt.url, err)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("%v: got %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+}
+
+// listen returns a local UDP socket and a channel of the datagrams received
+// with their time of arrival.
+func listen(t *testing.T) (*net.UDPConn, <-chan []byte, <-chan time.Time) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	datagrams, times := make(chan []byte, 1000), make(chan time.Time, 1000)
+	go func() {
+		for {
+			b := make([]byte, 2048)
+			n, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			datagrams <- b[:n]
+			times <- time.Now()
+		}
+	}()
+	return conn, datagrams, times
+}
+
+func TestUDPOutput(t *testing.T) {
+	conn, datagrams, times := listen(t)
+	broker := pubsub.NewBroker()
+	m := NewManager(broker)
+	defer m.Close()
+	if _, err := m.Add(Config{Topic: "live/news", Addr: conn.LocalAddr().String(), PacketsPerDatagram: 8}); err == nil {
+		t.Error("started an output of 8 packets per datagram")
+	}
+	status, err := m.Add(Config{Topic: "live/news", Addr: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := m.List(); len(list) != 1 || list[0].ID != status.ID || list[0].TTL != DefaultTTL {
+		t.Fatalf("got %+v", list)
+	}
+
+	// a second of stream published at once goes out over a second
+	var buf bytes.Buffer
+	gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < 26; i++ {
+		if err := gen.WriteFrame(clock.Add(time.Duration(i) * gen.FrameDuration())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+	broker.Broadcast(data, "live/news")
+
+	size := DefaultPacketsPerDatagram * mpegts.PacketSize
+	var got []byte
+	var first, last time.Time
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(data)/size*size {
+		select {
+		case d := <-datagrams:
+			at := <-times
+			if len(d) != size {
+				t.Fatalf("got a datagram of %d bytes", len(d))
+			}
+			if first.IsZero() {
+				first = at
+			}
+			last = at
+			got = append(got, d...)
+		case <-timeout:
+			t.Fatalf("got %d bytes of %d", len(got), len(data))
+		}
+	}
+	if !bytes.Equal(got, data[:len(got)]) {
+		t.Error("the datagrams differ from the stream")
+	}
+	if d := last.Sub(first); d < 900*time.Millisecond || d > 1500*time.Millisecond {
+		t.Errorf("got the stream over %v, want about a second", d)
+	}
+	if s := m.List()[0].Stats; s.Datagrams != uint64(len(got)/size) || s.Bytes != uint64(len(got)) {
+		t.Errorf("got stats %+v", s)
+	}
+
+	if err := m.Remove(status.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove(status.ID); err != ErrNotFound {
+		t.Errorf("removed twice: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestUDPOutputClosePacing(t *testing.T) {
+	conn, _, _ := listen(t)
+	broker := pubsub.NewBroker()
+	o, err := StartUDP(broker, "out", Config{Topic: "live/news", Addr: conn.LocalAddr().String(), PacketsPerDatagram: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two PCRs half a second apart, the output waits for the second one
+	var buf bytes.Buffer
+	mux := mpegts.NewMuxer(&buf)
+	for _, pcr := range []int64{0, mpegts.PCRFrequency / 2} {
+		if err := mux.WritePES(0x100, 0xe0, -1, pcr, []byte{0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	broker.Broadcast(buf.Bytes(), "live/news")
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	o.Close()
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("closed in %v while pacing", d)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/numb3r3/jsmpeg-relay/egress"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+// outputFlags collects the repeated -udp-out flags, like
+// "live/news=udp://239.0.0.1:1234?ttl=4&pkts=7".
+type outputFlags []egress.Config
+
+func (f *outputFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *outputFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expecting app/key=udp://host:port, got %q", value)
+	}
+	cfg, err := egress.ParseURL(parts[0], parts[1])
+	if err != nil {
+		return err
+	}
+	*f = append(*f, cfg)
+	return nil
+}
+
+// policyFlags collects the policies given by the repeated -policy flags.
+type policyFlags map[string]streams.Policy
+
+func (f policyFlags) String() string {
+	return ""
+}
+
+func (f policyFlags) Set(value string) error {
+	app, policy, err := streams.ParsePolicy(value)
+	if err != nil {
+		return err
+	}
+	f[app] = policy
+	return nil
+}
+
+// addrFlags collects the listen addresses, separated by commas.
+type addrFlags []string
+
+func (f *addrFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *addrFlags) Set(value string) error {
+	*f = strings.Split(value, ",")
+	return nil
+}
@@ -0,0 +1,167 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// Segment is a piece of a stream starting with the PAT, the PMT and a keyframe.
+type Segment struct {
+	Seq      uint64
+	Duration time.Duration
+	Data     []byte
+}
+
+// Stream cuts a live topic into segments and keeps the latest of them.
+type Stream struct {
+	sync.RWMutex
+	target   time.Duration
+	window   int
+	tables   mpegts.Tables
+	segments []*Segment
+	next     uint64
+	ended    bool
+
+	// the segment being filled
+	current  *bytes.Buffer
+	started  time.Time
+	firstPCR int64
+	lastPCR  int64
+	pcrPID   uint16
+	hasPCR   bool
+}
+
+// create a new stream cut in segments of about target duration, keeping
+// window segments in the playlist
+func NewStream(target time.Duration, window int) *Stream {
+	return &Stream{
+		target: target,
+		window: window,
+	}
+}
+
+// Write segments aligned packets received at now, a segment is cut on the
+// first keyframe after it reached the target duration.
+func (s *Stream) Write(now time.Time, data []byte) {
+	s.Lock()
+	defer s.Unlock()
+	if s.ended {
+		return
+	}
+
+	for _, pkt := range mpegts.Packets(data) {
+		s.tables.Update(pkt)
+		if mpegts.IsKeyframe(pkt) {
+			if s.current != nil && s.duration(now) >= s.target {
+				s.cut(now)
+			}
+			if s.current == nil && s.tables.Packets() != nil {
+				s.open(now)
+			}
+		}
+		if s.current == nil {
+			// wait for the tables and the first keyframe
+			continue
+		}
+
+		if pcr, ok := pkt.PCR(); ok && (!s.hasPCR || pkt.PID() == s.pcrPID) {
+			if !s.hasPCR {
+				s.firstPCR, s.pcrPID, s.hasPCR = pcr, pkt.PID(), true
+			}
+			s.lastPCR = pcr
+		}
+		s.current.Write(pkt)
+	}
+}
+
+// open starts a segment, timed from the last PCR of the previous one so
+// that no PCR interval is lost between the segments.
+func (s *Stream) open(now time.Time) {
+	s.current = bytes.NewBuffer(s.tables.Packets())
+	s.started = now
+	s.firstPCR = s.lastPCR
+}
+
+// duration of the current segment, measured by the PCR when available
+func (s *Stream) duration(now time.Time) time.Duration {
+	if s.hasPCR && s.lastPCR > s.firstPCR {
+		return mpegts.PCRDuration(s.lastPCR - s.firstPCR)
+	}
+	return now.Sub(s.started)
+}
+
+func (s *Stream) cut(now time.Time) {
+	s.segments = append(s.segments, &Segment{
+		Seq:      s.next,
+		Duration: s.duration(now),
+		Data:     s.current.Bytes(),
+	})
+	s.next++
+	if len(s.segments) > s.window {
+		s.segments = s.segments[len(s.segments)-s.window:]
+	}
+	s.current = nil
+}
+
+// End closes the last segment, the playlist is then complete.
+func (s *Stream) End() {
+	s.Lock()
+	defer s.Unlock()
+	if s.current != nil && s.current.Len() > 0 {
+		s.cut(time.Now())
+	}
+	s.ended = true
+}
+
+// to check whether the publisher of the stream is gone
+func (s *Stream) Ended() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.ended
+}
+
+// Segment returns a segment still in the window.
+func (s *Stream) Segment(seq uint64) (*Segment, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, seg := range s.segments {
+		if seg.Seq == seq {
+			return seg, true
+		}
+	}
+	return nil, false
+}
+
+// Playlist renders the media playlist of the segments in the window,
+// nil when no segment has been cut yet.
+func (s *Stream) Playlist() []byte {
+	s.RLock()
+	defer s.RUnlock()
+	if len(s.segments) == 0 {
+		return nil
+	}
+
+	target := s.target
+	for _, seg := range s.segments {
+		if seg.Duration > target {
+			target = seg.Duration
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", s.segments[0].Seq)
+	for _, seg := range s.segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.ts\n", seg.Duration.Seconds(), seg.Seq)
+	}
+	if s.ended {
+		fmt.Fprintf(&b, "#EXT-X-ENDLIST\n")
+	}
+	return b.Bytes()
+}
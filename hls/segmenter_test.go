@@ -0,0 +1,104 @@
+package hls
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+// stream returns a test stream with a keyframe every second and the
+// offsets of its keyframes.
+func stream(t *testing.T, seconds int) ([]byte, []int) {
+	t.Helper()
+	var buf bytes.Buffer
+	gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < seconds*25; i++ {
+		if err := gen.WriteFrame(clock.Add(time.Duration(i) * gen.FrameDuration())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keyframes []int
+	for i, p := range mpegts.Packets(buf.Bytes()) {
+		if mpegts.IsKeyframe(p) {
+			keyframes = append(keyframes, i*mpegts.PacketSize)
+		}
+	}
+	return buf.Bytes(), keyframes
+}
+
+func TestStream(t *testing.T) {
+	data, keyframes := stream(t, 5)
+	s := NewStream(500*time.Millisecond, 3)
+	if s.Playlist() != nil {
+		t.Fatal("got a playlist without segments")
+	}
+
+	// the first keyframe comes without the tables, the first segment waits
+	// for the tables before the next one
+	now := time.Now()
+	s.Write(now, data[keyframes[0]:])
+	s.End()
+
+	// the segments are timed by the PCR, each one from the last PCR of the
+	// previous, the first one out of the window
+	want := []time.Duration{time.Second, time.Second, time.Second}
+	var got []time.Duration
+	for seq := uint64(0); seq < 4; seq++ {
+		seg, ok := s.Segment(seq)
+		if !ok {
+			continue
+		}
+		got = append(got, seg.Duration)
+
+		packets := mpegts.Packets(seg.Data)
+		if len(packets) < 3 || packets[0].PID() != 0 || !mpegts.IsKeyframe(packets[2]) {
+			t.Errorf("segment %v: does not start with the tables and a keyframe", seq)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got durations %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %v: got duration %v, want %v", i+1, got[i], want[i])
+		}
+	}
+	if _, ok := s.Segment(0); ok {
+		t.Error("the segment out of the window is kept")
+	}
+
+	playlist := string(s.Playlist())
+	for _, line := range []string{"#EXT-X-TARGETDURATION:1\n", "#EXT-X-MEDIA-SEQUENCE:1\n", "#EXTINF:1.000,\n1.ts\n", "#EXTINF:1.000,\n3.ts\n", "#EXT-X-ENDLIST\n"} {
+		if !strings.Contains(playlist, line) {
+			t.Errorf("%q missing from the playlist:\n%v", line, playlist)
+		}
+	}
+}
+
+func TestStreamDurationsAdd(t *testing.T) {
+	data, _ := stream(t, 4)
+	s := NewStream(500*time.Millisecond, 10)
+	// written packet by packet, the segments add up to the whole stream
+	now := time.Now()
+	for _, p := range mpegts.Packets(data) {
+		s.Write(now, p)
+	}
+	var total time.Duration
+	for seq := uint64(0); seq < 10; seq++ {
+		if seg, ok := s.Segment(seq); ok {
+			total += seg.Duration
+		}
+	}
+	// the last segment is not cut, the first one is timed from its own PCR
+	if want := 3*time.Second - 40*time.Millisecond; total != want {
+		t.Errorf("got %v in the segments, want %v", total, want)
+	}
+}
@@ -0,0 +1,64 @@
+package hls
+
+import (
+	"sync"
+	"time"
+)
+
+// Store holds the segmented streams of the live topics.
+type Store struct {
+	sync.RWMutex
+	target  time.Duration
+	window  int
+	streams map[string]*Stream
+}
+
+// create a new store cutting segments of about target duration and
+// keeping window segments per topic
+func NewStore(target time.Duration, window int) *Store {
+	return &Store{
+		target:  target,
+		window:  window,
+		streams: map[string]*Stream{},
+	}
+}
+
+// Write segments aligned packets of the topic, a topic published again
+// after it ended starts a new stream.
+func (s *Store) Write(topic string, data []byte) {
+	s.Lock()
+	stream := s.streams[topic]
+	if stream == nil || stream.Ended() {
+		stream = NewStream(s.target, s.window)
+		s.streams[topic] = stream
+	}
+	s.Unlock()
+	stream.Write(time.Now(), data)
+}
+
+// End completes the playlist of the topic and removes its segments once
+// the players had time to fetch them.
+func (s *Store) End(topic string) {
+	s.RLock()
+	stream := s.streams[topic]
+	s.RUnlock()
+	if stream == nil {
+		return
+	}
+
+	stream.End()
+	time.AfterFunc(time.Duration(s.window)*s.target, func() {
+		s.Lock()
+		defer s.Unlock()
+		if s.streams[topic] == stream {
+			delete(s.streams, topic)
+		}
+	})
+}
+
+// to get the segmented stream of the topic, nil when it is not available
+func (s *Store) Get(topic string) *Stream {
+	s.RLock()
+	defer s.RUnlock()
+	return s.streams[topic]
+}
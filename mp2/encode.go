@@ -0,0 +1,314 @@
+// Package mp2 encodes MPEG-1 audio layer II, the audio codec of jsmpeg.
+package mp2
+
+import (
+	"errors"
+	"math"
+)
+
+// SamplesPerFrame is the number of samples of a channel in a frame.
+const SamplesPerFrame = 1152
+
+var (
+	ErrSampleRate = errors.New("unsupported sample rate, 32000, 44100 or 48000 Hz")
+	ErrBitrate    = errors.New("unsupported bitrate, from 56 to 192 kbit/s")
+)
+
+var sampleRates = [3]int{44100, 48000, 32000}
+
+// the layer II bitrates in kbit/s by index
+var bitrates = [15]int{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384}
+
+// the quantization levels by subband and allocation, of the allocation
+// tables A and B which only differ by their number of subbands
+var (
+	levels4a = []int{0, 3, 7, 15, 31, 63, 127, 255, 511, 1023, 2047, 4095, 8191, 16383, 32767, 65535}
+	levels4b = []int{0, 3, 5, 7, 9, 15, 31, 63, 127, 255, 511, 1023, 2047, 4095, 8191, 65535}
+	levels3  = []int{0, 3, 5, 7, 9, 15, 31, 65535}
+	levels2  = []int{0, 3, 5, 65535}
+)
+
+func allocationLevels(sb int) []int {
+	switch {
+	case sb < 3:
+		return levels4a
+	case sb < 11:
+		return levels4b
+	case sb < 23:
+		return levels3
+	}
+	return levels2
+}
+
+// the bits of the allocation of a subband
+func allocationBits(sb int) int {
+	switch len(allocationLevels(sb)) {
+	case 16:
+		return 4
+	case 8:
+		return 3
+	}
+	return 2
+}
+
+// the levels coded by groups of 3 samples, with the bits of a group
+var groupBits = map[int]int{3: 5, 5: 7, 9: 10}
+
+// the bits of a sample of the levels which are not grouped
+func sampleBits(levels int) int {
+	return int(math.Ceil(math.Log2(float64(levels + 1))))
+}
+
+// the bits of the 36 samples of a subband
+func subbandBits(levels int) int {
+	if bits, ok := groupBits[levels]; ok {
+		return 12 * bits
+	}
+	return 36 * sampleBits(levels)
+}
+
+// scalefactors[i] = 2^(1-i/3), the largest first
+var scalefactors [63]float64
+
+// matrix[k][i] = cos((2k+1)(i-16)π/64), of the analysis filterbank
+var matrix [32][64]float64
+
+func init() {
+	for i := range scalefactors {
+		scalefactors[i] = math.Pow(2, 1-float64(i)/3)
+	}
+	for k := 0; k < 32; k++ {
+		for i := 0; i < 64; i++ {
+			matrix[k][i] = math.Cos(float64((2*k+1)*(i-16)) * math.Pi / 64)
+		}
+	}
+}
+
+// Encoder encodes mono audio as MPEG-1 layer II frames.
+type Encoder struct {
+	rateIndex int
+	srIndex   int
+	bitrate   int
+	rate      int
+	sblimit   int
+	rest      int // of the division of the frame size, for the padding
+
+	x [512]float64 // the latest input samples, the latest first
+}
+
+// create an encoder of mono audio at a sample rate and a bitrate in bits/s
+func NewEncoder(sampleRate, bitrate int) (*Encoder, error) {
+	e := &Encoder{srIndex: -1, rate: sampleRate, bitrate: bitrate}
+	for i, rate := range sampleRates {
+		if rate == sampleRate {
+			e.srIndex = i
+		}
+	}
+	for i, rate := range bitrates {
+		if rate*1000 == bitrate && rate >= 56 && rate <= 192 {
+			e.rateIndex = i
+		}
+	}
+	switch {
+	case e.srIndex < 0:
+		return nil, ErrSampleRate
+	case e.rateIndex == 0:
+		return nil, ErrBitrate
+	}
+
+	// the table B has more subbands, for the higher bitrates below 48kHz
+	e.sblimit = 27
+	if sampleRate != 48000 && bitrate >= 96000 {
+		e.sblimit = 30
+	}
+	return e, nil
+}
+
+// Encode encodes a frame of SamplesPerFrame samples from -1 to 1.
+func (e *Encoder) Encode(pcm []float64) []byte {
+	var samples [32][36]float64
+	for gr := 0; gr < 36; gr++ {
+		e.analyze(pcm[gr*32:gr*32+32], gr, &samples)
+	}
+
+	// the scalefactor of each part of 12 samples
+	var scf [32][3]int
+	for sb := 0; sb < e.sblimit; sb++ {
+		for part := 0; part < 3; part++ {
+			peak := 0.0
+			for _, s := range samples[sb][part*12 : part*12+12] {
+				peak = math.Max(peak, math.Abs(s))
+			}
+			i := len(scalefactors) - 1
+			for i > 0 && scalefactors[i] < peak {
+				i--
+			}
+			scf[sb][part] = i
+		}
+	}
+
+	size := 144 * e.bitrate / e.rate
+	e.rest += 144 * e.bitrate % e.rate
+	padding := 0
+	if e.rest >= e.rate {
+		e.rest -= e.rate
+		padding = 1
+	}
+	alloc := e.allocate(&scf, (size+padding)*8)
+
+	w := &bitWriter{}
+	w.write(0xfff, 12)
+	w.write(1, 1) // MPEG-1
+	w.write(2, 2) // layer II
+	w.write(1, 1) // no CRC
+	w.write(uint32(e.rateIndex), 4)
+	w.write(uint32(e.srIndex), 2)
+	w.write(uint32(padding), 1)
+	w.write(0, 1) // private
+	w.write(3, 2) // mono
+	w.write(0, 2) // mode extension
+	w.write(0, 4) // copyright, original and emphasis
+
+	for sb := 0; sb < e.sblimit; sb++ {
+		w.write(uint32(alloc[sb]), allocationBits(sb))
+	}
+	for sb := 0; sb < e.sblimit; sb++ {
+		if alloc[sb] != 0 {
+			w.write(0, 2) // the three scalefactors are sent
+		}
+	}
+	for sb := 0; sb < e.sblimit; sb++ {
+		if alloc[sb] != 0 {
+			for part := 0; part < 3; part++ {
+				w.write(uint32(scf[sb][part]), 6)
+			}
+		}
+	}
+
+	for part := 0; part < 3; part++ {
+		for gr := 0; gr < 4; gr++ {
+			for sb := 0; sb < e.sblimit; sb++ {
+				if alloc[sb] == 0 {
+					continue
+				}
+				levels := allocationLevels(sb)[alloc[sb]]
+				var codes [3]uint32
+				for s := range codes {
+					x := samples[sb][part*12+gr*3+s] / scalefactors[scf[sb][part]]
+					codes[s] = quantize(x, levels)
+				}
+				if bits, ok := groupBits[levels]; ok {
+					l := uint32(levels)
+					w.write(codes[0]+codes[1]*l+codes[2]*l*l, bits)
+				} else {
+					bits := sampleBits(levels)
+					for _, c := range codes {
+						w.write(c, bits)
+					}
+				}
+			}
+		}
+	}
+
+	out := w.b
+	for len(out) < size+padding {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// analyze filters 32 input samples into a sample of each subband.
+func (e *Encoder) analyze(pcm []float64, gr int, samples *[32][36]float64) {
+	copy(e.x[32:], e.x[:480])
+	for i := 0; i < 32; i++ {
+		e.x[31-i] = pcm[i]
+	}
+	var y [64]float64
+	for i := 0; i < 512; i++ {
+		y[i%64] += e.x[i] * float64(windowD[i]) / (1 << 16) / 32
+	}
+	for k := 0; k < 32; k++ {
+		var s float64
+		for i := 0; i < 64; i++ {
+			s += matrix[k][i] * y[i]
+		}
+		samples[k][gr] = s
+	}
+}
+
+// allocate gives the bits of a frame to the subbands whose noise is the
+// highest compared to their level.
+func (e *Encoder) allocate(scf *[32][3]int, bits int) [32]int {
+	var alloc [32]int
+	available := bits - 32
+	for sb := 0; sb < e.sblimit; sb++ {
+		available -= allocationBits(sb)
+	}
+
+	// the level in dB of a subband from its largest scalefactor
+	var level [32]float64
+	for sb := 0; sb < e.sblimit; sb++ {
+		level[sb] = 20 * math.Log10(scalefactors[min(scf[sb][0], scf[sb][1], scf[sb][2])])
+	}
+	for {
+		best, bestNoise, bestCost := -1, -90.0, 0
+		for sb := 0; sb < e.sblimit; sb++ {
+			levels := allocationLevels(sb)
+			if alloc[sb]+1 >= len(levels) {
+				continue
+			}
+			noise := level[sb] - snr(levels[alloc[sb]])
+			cost := subbandBits(levels[alloc[sb]+1])
+			if alloc[sb] == 0 {
+				cost += 2 + 18
+			} else {
+				cost -= subbandBits(levels[alloc[sb]])
+			}
+			if noise > bestNoise && cost <= available {
+				best, bestNoise, bestCost = sb, noise, cost
+			}
+		}
+		if best < 0 {
+			return alloc
+		}
+		alloc[best]++
+		available -= bestCost
+	}
+}
+
+// snr returns the signal to noise ratio in dB of a number of levels.
+func snr(levels int) float64 {
+	if levels == 0 {
+		return 0
+	}
+	return 20 * math.Log10(float64(levels))
+}
+
+// quantize returns the code of a sample from -1 to 1.
+func quantize(x float64, levels int) uint32 {
+	c := int(math.Floor(float64(levels) * (x + 1) / 2))
+	if c < 0 {
+		c = 0
+	} else if c > levels-1 {
+		c = levels - 1
+	}
+	return uint32(c)
+}
+
+// bitWriter writes bits, most significant first.
+type bitWriter struct {
+	b []byte
+	n int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.b[len(w.b)-1] |= 1 << uint(7-w.n%8)
+		}
+		w.n++
+	}
+}
@@ -0,0 +1,86 @@
+package mp2
+
+import (
+	"math"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		sampleRate, bitrate int
+		want                error
+	}{
+		{44100, 128000, nil},
+		{48000, 56000, nil},
+		{32000, 192000, nil},
+		{22050, 128000, ErrSampleRate},
+		{44100, 48000, ErrBitrate},
+		{44100, 224000, ErrBitrate},
+		{44100, 100000, ErrBitrate},
+	}
+	for _, tt := range tests {
+		if _, err := NewEncoder(tt.sampleRate, tt.bitrate); err != tt.want {
+			t.Errorf("%v Hz at %v bit/s: got %v, want %v", tt.sampleRate, tt.bitrate, err, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		sampleRate, bitrate int
+		amplitude           float64
+		peak                float64 // dBFS
+	}{
+		{44100, 128000, 0.5, -6},
+		{48000, 64000, 0.5, -6},
+		{32000, 192000, 0.1, -20},
+		{44100, 96000, 1, 0},
+		{48000, 128000, 0, mpegts.Silent},
+	}
+	for _, tt := range tests {
+		e, err := NewEncoder(tt.sampleRate, tt.bitrate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a sine in the middle of the third subband
+		freq := 2.5 * float64(tt.sampleRate) / 64
+		pcm := make([]float64, SamplesPerFrame)
+		var total int
+		const frames = 40
+		for n := 0; n < frames; n++ {
+			for i := range pcm {
+				at := float64(n*SamplesPerFrame+i) / float64(tt.sampleRate)
+				pcm[i] = tt.amplitude * math.Sin(2*math.Pi*freq*at)
+			}
+			frame := e.Encode(pcm)
+			total += len(frame)
+
+			h, offset, ok := mpegts.ParseAudioHeader(frame)
+			if !ok || offset != 0 {
+				t.Errorf("%v Hz at %v bit/s: frame %d has no header", tt.sampleRate, tt.bitrate, n)
+				break
+			}
+			want := mpegts.AudioHeader{Version: 1, Layer: 2, Bitrate: tt.bitrate, SampleRate: tt.sampleRate, Mode: "mono", Channels: 1, FrameSize: len(frame)}
+			if *h != want {
+				t.Errorf("%v Hz at %v bit/s: frame %d has header %+v, want %+v", tt.sampleRate, tt.bitrate, n, *h, want)
+				break
+			}
+			// the first frame holds the delay of the filter bank
+			if n == 0 {
+				continue
+			}
+			if peak, ok := mpegts.ScalefactorPeak(frame); !ok || math.Abs(peak-tt.peak) > 3 {
+				t.Errorf("%v Hz at %v bit/s: frame %d peaks at %v dBFS, want %v", tt.sampleRate, tt.bitrate, n, peak, tt.peak)
+				break
+			}
+		}
+
+		// the padding keeps the bitrate exact
+		want := float64(tt.bitrate) / 8 * frames * SamplesPerFrame / float64(tt.sampleRate)
+		if math.Abs(float64(total)-want) > 1 {
+			t.Errorf("%v Hz at %v bit/s: got %d bytes, want %.0f", tt.sampleRate, tt.bitrate, total, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mpeg1
+
+// bitReader reads the bits of video data, most significant first.
+type bitReader struct {
+	b   []byte
+	pos int // in bits
+}
+
+// to get the next n bits, with zeros past the end of the data
+func (r *bitReader) peek(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		pos := r.pos + i
+		v <<= 1
+		if pos/8 < len(r.b) {
+			v |= uint32(r.b[pos/8]>>(7-uint(pos%8))) & 1
+		}
+	}
+	return v
+}
+
+func (r *bitReader) read(n int) uint32 {
+	v := r.peek(n)
+	r.pos += n
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+}
+
+func (r *bitReader) eof() bool {
+	return r.pos >= len(r.b)*8
+}
+
+// nextStartCode moves to the next start code and returns its value, false
+// at the end of the data.
+func (r *bitReader) nextStartCode() (byte, bool) {
+	i := (r.pos + 7) / 8
+	for ; i+3 < len(r.b); i++ {
+		if r.b[i] == 0 && r.b[i+1] == 0 && r.b[i+2] == 1 {
+			r.pos = (i + 4) * 8
+			return r.b[i+3], true
+		}
+	}
+	r.pos = len(r.b) * 8
+	return 0, false
+}
+
+// atStartCode tells whether the next bits are the zeros starting a start
+// code, which end the macroblocks of a slice.
+func (r *bitReader) atStartCode() bool {
+	return r.peek(23) == 0
+}
+
+// bitWriter writes the bits of video data, most significant first.
+type bitWriter struct {
+	b []byte
+	n int // in bits
+}
+
+// to write the n low bits of v
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.b[len(w.b)-1] |= 1 << uint(7-w.n%8)
+		}
+		w.n++
+	}
+}
+
+// to write a code given as a string of bits
+func (w *bitWriter) writeCode(code string) {
+	for _, c := range code {
+		w.write(uint32(c-'0'), 1)
+	}
+}
+
+// to pad the data with zeros to a byte boundary
+func (w *bitWriter) align() {
+	for w.n%8 != 0 {
+		w.write(0, 1)
+	}
+}
+
+// to write a start code at the next byte boundary
+func (w *bitWriter) startCode(code byte) {
+	w.align()
+	w.write(1, 24)
+	w.write(uint32(code), 8)
+}
@@ -0,0 +1,305 @@
+// Package mpeg1 decodes the intra-coded pictures of MPEG-1 video, enough
+// to render keyframes as images, and encodes synthetic pictures.
+package mpeg1
+
+import (
+	"errors"
+	"image"
+)
+
+var (
+	ErrNoSequenceHeader = errors.New("no sequence header")
+	ErrNoPicture        = errors.New("no intra-coded picture")
+	ErrUnsupported      = errors.New("unsupported video, only MPEG-1 is decoded")
+	ErrCorrupt          = errors.New("corrupt picture")
+)
+
+// the start codes of the video syntax
+const (
+	startPicture   = 0x00
+	startSliceMin  = 0x01
+	startSliceMax  = 0xaf
+	startUserData  = 0xb2
+	startSequence  = 0xb3
+	startExtension = 0xb5
+)
+
+const pictureI = 1
+
+// the raster position of the coefficients in zigzag order
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// the default intra quantizer matrix in raster order
+var defaultIntraQuant = [64]int{
+	8, 16, 19, 22, 26, 27, 29, 34,
+	16, 16, 22, 24, 27, 29, 34, 37,
+	19, 22, 26, 27, 29, 34, 34, 38,
+	22, 22, 26, 27, 29, 34, 37, 40,
+	22, 26, 27, 29, 32, 35, 40, 48,
+	26, 27, 29, 32, 35, 40, 48, 58,
+	26, 27, 29, 34, 38, 46, 56, 69,
+	27, 29, 35, 38, 46, 56, 69, 83,
+}
+
+type sequence struct {
+	width      int
+	height     int
+	mbWidth    int
+	mbHeight   int
+	intraQuant [64]int
+}
+
+func parseSequence(r *bitReader) *sequence {
+	s := &sequence{
+		width:      int(r.read(12)),
+		height:     int(r.read(12)),
+		intraQuant: defaultIntraQuant,
+	}
+	s.mbWidth = (s.width + 15) / 16
+	s.mbHeight = (s.height + 15) / 16
+	// aspect ratio, frame rate, bitrate, marker, VBV buffer size and
+	// constrained parameters flag
+	r.skip(4 + 4 + 18 + 1 + 10 + 1)
+	if r.read(1) == 1 {
+		for i := 0; i < 64; i++ {
+			s.intraQuant[zigzag[i]] = int(r.read(8))
+		}
+	}
+	if r.read(1) == 1 {
+		r.skip(64 * 8)
+	}
+	return s
+}
+
+// DecodeIntra decodes the first intra-coded picture of video data which
+// starts with a sequence header.
+func DecodeIntra(es []byte) (*image.YCbCr, error) {
+	r := &bitReader{b: es}
+	var seq *sequence
+	for {
+		code, ok := r.nextStartCode()
+		if !ok {
+			break
+		}
+		switch code {
+		case startSequence:
+			seq = parseSequence(r)
+		case startExtension:
+			// the sequence extension of MPEG-2
+			if seq != nil {
+				return nil, ErrUnsupported
+			}
+		case startPicture:
+			if seq == nil {
+				return nil, ErrNoSequenceHeader
+			}
+			if seq.width == 0 || seq.height == 0 {
+				return nil, ErrCorrupt
+			}
+			r.skip(10) // temporal reference
+			if r.read(3) != pictureI {
+				continue
+			}
+			return decodePicture(r, seq)
+		}
+	}
+	if seq == nil {
+		return nil, ErrNoSequenceHeader
+	}
+	return nil, ErrNoPicture
+}
+
+type decoder struct {
+	r      *bitReader
+	seq    *sequence
+	img    *image.YCbCr
+	dcPast [3]int
+}
+
+func decodePicture(r *bitReader, seq *sequence) (*image.YCbCr, error) {
+	r.skip(16) // VBV delay
+	for r.read(1) == 1 {
+		r.skip(8) // extra information
+	}
+
+	d := &decoder{
+		r:   r,
+		seq: seq,
+		img: image.NewYCbCr(image.Rect(0, 0, seq.mbWidth*16, seq.mbHeight*16), image.YCbCrSubsampleRatio420),
+	}
+	slices := 0
+	for {
+		code, ok := r.nextStartCode()
+		if !ok {
+			break
+		}
+		if code == startUserData || code == startExtension {
+			continue
+		}
+		if code < startSliceMin || code > startSliceMax {
+			break
+		}
+		if err := d.decodeSlice(int(code) - 1); err != nil {
+			return nil, err
+		}
+		slices++
+	}
+	if slices == 0 {
+		return nil, ErrCorrupt
+	}
+	return d.img.SubImage(image.Rect(0, 0, seq.width, seq.height)).(*image.YCbCr), nil
+}
+
+func (d *decoder) decodeSlice(row int) error {
+	r := d.r
+	if row >= d.seq.mbHeight {
+		return ErrCorrupt
+	}
+	quant := int(r.read(5))
+	for r.read(1) == 1 {
+		r.skip(8) // extra information
+	}
+	d.dcPast = [3]int{1024, 1024, 1024}
+
+	address := row*d.seq.mbWidth - 1
+	for !r.atStartCode() && !r.eof() {
+		increment := 0
+		for {
+			v, ok := addressIncrement.decode(r)
+			if !ok {
+				return ErrCorrupt
+			}
+			if v == mbStuffing {
+				continue
+			}
+			if v == mbEscape {
+				increment += 33
+				continue
+			}
+			increment += v
+			break
+		}
+		address += increment
+		if address >= d.seq.mbWidth*d.seq.mbHeight {
+			return ErrCorrupt
+		}
+		if increment > 1 {
+			d.dcPast = [3]int{1024, 1024, 1024}
+		}
+
+		// the macroblock type of I pictures, 1 or 01 with a new quantizer
+		if r.read(1) == 0 {
+			if r.read(1) != 1 {
+				return ErrCorrupt
+			}
+			quant = int(r.read(5))
+		}
+		for b := 0; b < 6; b++ {
+			if err := d.decodeBlock(address, b, quant); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decodeBlock(address, b, quant int) error {
+	r := d.r
+	var coef [64]int
+
+	ch, sizes := 0, dcSizeLuminance
+	if b >= 4 {
+		ch, sizes = b-3, dcSizeChrominance
+	}
+	size, ok := sizes.decode(r)
+	if !ok {
+		return ErrCorrupt
+	}
+	diff := 0
+	if size > 0 {
+		diff = int(r.read(size))
+		if diff < 1<<uint(size-1) {
+			diff = diff - 1<<uint(size) + 1
+		}
+	}
+	d.dcPast[ch] += diff * 8
+	coef[0] = d.dcPast[ch]
+
+	for i := 0; ; {
+		v, ok := dctCoefficients.decode(r)
+		if !ok {
+			return ErrCorrupt
+		}
+		if v == dctEndOfBlock {
+			break
+		}
+		var run, level int
+		if v == dctEscape {
+			run, level = int(r.read(6)), int(r.read(8))
+			switch {
+			case level == 0:
+				level = int(r.read(8))
+			case level == 128:
+				level = int(r.read(8)) - 256
+			case level > 128:
+				level -= 256
+			}
+		} else {
+			run, level = v>>8, v&0xff
+			if r.read(1) == 1 {
+				level = -level
+			}
+		}
+		i += run + 1
+		if i > 63 {
+			return ErrCorrupt
+		}
+		pos := zigzag[i]
+		c := 2 * level * quant * d.seq.intraQuant[pos] / 16
+		if c&1 == 0 {
+			switch {
+			case c > 0:
+				c--
+			case c < 0:
+				c++
+			}
+		}
+		if c > 2047 {
+			c = 2047
+		} else if c < -2048 {
+			c = -2048
+		}
+		coef[pos] = c
+	}
+
+	samples := idct(&coef)
+	mbX, mbY := address%d.seq.mbWidth, address/d.seq.mbWidth
+	plane, stride, x0, y0 := d.img.Y, d.img.YStride, mbX*16+(b&1)*8, mbY*16+(b>>1)*8
+	switch b {
+	case 4:
+		plane, stride, x0, y0 = d.img.Cb, d.img.CStride, mbX*8, mbY*8
+	case 5:
+		plane, stride, x0, y0 = d.img.Cr, d.img.CStride, mbX*8, mbY*8
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			plane[(y0+y)*stride+x0+x] = clamp(samples[y*8+x])
+		}
+	}
+	return nil
+}
+
+func clamp(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,337 @@
+package mpeg1
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+var ErrFrameRate = errors.New("unsupported frame rate")
+
+// the frame rates of MPEG-1 by their code
+var frameRates = []float64{0, 24000.0 / 1001, 24, 25, 30000.0 / 1001, 30, 50, 60000.0 / 1001, 60}
+
+const (
+	pictureP = 2
+
+	startGOP = 0xb8
+)
+
+// Table B.2b, the macroblock types of predicted pictures used by the encoder
+const (
+	mbTypePIntra        = "00011"
+	mbTypePIntraQuant   = "000001"
+	mbTypePNotCoded     = "001" // forward motion compensated, no coefficients
+	motionCodeZero      = "1"
+	addressIncrementI   = "1"
+	mbTypeIIntra        = "1"
+	mbTypeIIntraQuant   = "01"
+	maxAddressIncrement = 33
+)
+
+// the largest level of a coefficient, and the largest height the slice
+// start codes cover
+const (
+	maxLevel  = 255
+	maxHeight = (startSliceMax - startSliceMin + 1) * 16
+)
+
+// Encoder encodes pictures as MPEG-1 video. A GOP starts with an intra-coded
+// picture, the following pictures are predicted and only code the
+// macroblocks which changed since the previous picture, which suits
+// synthetic pictures like test patterns.
+type Encoder struct {
+	width     int
+	height    int
+	rateCode  int
+	quantizer int
+	gop       int
+
+	frame    int
+	previous *image.YCbCr
+}
+
+// create an encoder of pictures of a size, quantizer from 1 (best) to 31
+// and GOP size in pictures. The quantizer is raised for the macroblocks
+// whose coefficients would not fit in the levels of MPEG-1.
+func NewEncoder(width, height int, frameRate float64, quantizer, gop int) (*Encoder, error) {
+	e := &Encoder{width: width, height: height, quantizer: quantizer, gop: gop}
+	for code, rate := range frameRates {
+		if code > 0 && math.Abs(rate-frameRate) < 0.01 {
+			e.rateCode = code
+		}
+	}
+	switch {
+	case e.rateCode == 0:
+		return nil, ErrFrameRate
+	case width <= 0 || width > 4095 || height <= 0 || height > maxHeight:
+		return nil, errors.New("invalid picture size")
+	case quantizer < 1 || quantizer > 31:
+		return nil, errors.New("the quantizer ranges from 1 to 31")
+	case gop < 1:
+		return nil, errors.New("invalid GOP size")
+	}
+	return e, nil
+}
+
+// Encode encodes the next picture, which must be a 4:2:0 image of the size
+// of the encoder. The first picture of a GOP is preceded by the sequence
+// header.
+func (e *Encoder) Encode(img *image.YCbCr) []byte {
+	w := &bitWriter{}
+	index := e.frame % e.gop
+	intra := index == 0 || e.previous == nil
+	if intra {
+		e.writeHeaders(w)
+		index = 0
+	}
+	e.frame++
+
+	w.startCode(startPicture)
+	w.write(uint32(index), 10) // temporal reference
+	if intra {
+		w.write(pictureI, 3)
+		w.write(0xffff, 16) // vbv delay
+	} else {
+		w.write(pictureP, 3)
+		w.write(0xffff, 16)
+		w.write(0, 1) // full pel forward vector
+		w.write(1, 3) // forward f code
+	}
+	w.write(0, 1) // extra bit
+
+	mbWidth, mbHeight := (e.width+15)/16, (e.height+15)/16
+	for row := 0; row < mbHeight; row++ {
+		w.startCode(byte(startSliceMin + row))
+		w.write(uint32(e.quantizer), 5)
+		w.write(0, 1) // extra bit
+
+		dcPredictor := [3]int{128, 128, 128}
+		skipped, previousIntra := 0, false
+		quant := e.quantizer // of the slice until a macroblock changes it
+		for col := 0; col < mbWidth; col++ {
+			var blocks [6][64]float64
+			q := 0
+			if !intra {
+				// the first and last macroblocks of a slice are coded
+				edge := col == 0 || col == mbWidth-1
+				if sameMacroblock(img, e.previous, col, row) {
+					if !edge {
+						skipped++
+						previousIntra = false
+						continue
+					}
+					writeAddressIncrement(w, skipped+1)
+					w.writeCode(mbTypePNotCoded)
+					w.writeCode(motionCodeZero)
+					w.writeCode(motionCodeZero)
+					skipped, previousIntra = 0, false
+					continue
+				}
+				writeAddressIncrement(w, skipped+1)
+				blocks, q = e.transformMacroblock(img, col, row)
+				if q == quant {
+					w.writeCode(mbTypePIntra)
+				} else {
+					w.writeCode(mbTypePIntraQuant)
+					w.write(uint32(q), 5)
+				}
+				// the predictors reset after a macroblock which is not intra coded
+				if !previousIntra {
+					dcPredictor = [3]int{128, 128, 128}
+				}
+				skipped, previousIntra = 0, true
+			} else {
+				w.writeCode(addressIncrementI)
+				blocks, q = e.transformMacroblock(img, col, row)
+				if q == quant {
+					w.writeCode(mbTypeIIntra)
+				} else {
+					w.writeCode(mbTypeIIntraQuant)
+					w.write(uint32(q), 5)
+				}
+			}
+			quant = q
+			for b := range blocks {
+				writeBlock(w, &blocks[b], b, q, &dcPredictor)
+			}
+		}
+	}
+
+	if e.previous == nil {
+		e.previous = image.NewYCbCr(img.Rect, img.SubsampleRatio)
+	}
+	copy(e.previous.Y, img.Y)
+	copy(e.previous.Cb, img.Cb)
+	copy(e.previous.Cr, img.Cr)
+
+	w.align()
+	return w.b
+}
+
+func (e *Encoder) writeHeaders(w *bitWriter) {
+	w.startCode(startSequence)
+	w.write(uint32(e.width), 12)
+	w.write(uint32(e.height), 12)
+	w.write(1, 4) // square pixels
+	w.write(uint32(e.rateCode), 4)
+	w.write(0x3ffff, 18) // variable bitrate
+	w.write(1, 1)        // marker
+	w.write(20, 10)      // vbv buffer size in 16 kbit
+	w.write(0, 1)        // constrained parameters
+	w.write(0, 1)        // default intra quantizer matrix
+	w.write(0, 1)        // default non intra quantizer matrix
+
+	w.startCode(startGOP)
+	w.write(1<<12, 25) // time code, the marker bit only
+	w.write(1, 1)      // closed GOP
+	w.write(0, 1)      // broken link
+}
+
+func writeAddressIncrement(w *bitWriter, increment int) {
+	for ; increment > maxAddressIncrement; increment -= maxAddressIncrement {
+		addressIncrement.encode(w, mbEscape)
+	}
+	addressIncrement.encode(w, increment)
+}
+
+// sameMacroblock tells whether a macroblock is the same in two images.
+func sameMacroblock(a, b *image.YCbCr, col, row int) bool {
+	if b == nil {
+		return false
+	}
+	for y := row * 16; y < row*16+16 && y < a.Rect.Dy(); y++ {
+		for x := col * 16; x < col*16+16 && x < a.Rect.Dx(); x++ {
+			if a.Y[y*a.YStride+x] != b.Y[y*b.YStride+x] {
+				return false
+			}
+		}
+	}
+	for y := row * 8; y < row*8+8 && y < (a.Rect.Dy()+1)/2; y++ {
+		for x := col * 8; x < col*8+8 && x < (a.Rect.Dx()+1)/2; x++ {
+			i := y*a.CStride + x
+			if a.Cb[i] != b.Cb[i] || a.Cr[i] != b.Cr[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// transformMacroblock transforms the blocks of a macroblock, and returns
+// the lowest quantizer from the one of the encoder which keeps their levels
+// in range.
+func (e *Encoder) transformMacroblock(img *image.YCbCr, col, row int) ([6][64]float64, int) {
+	var blocks [6][64]float64
+	largest := 0.0 // the largest weighted coefficient
+	for b := range blocks {
+		blocks[b] = transformBlock(img, col, row, b)
+		for i := 1; i < 64; i++ {
+			largest = math.Max(largest, math.Abs(blocks[b][i]*8/float64(defaultIntraQuant[i])))
+		}
+	}
+	q := e.quantizer
+	for q < 31 && math.Round(largest/float64(q)) > maxLevel {
+		q++
+	}
+	return blocks, q
+}
+
+// transformBlock returns the DCT coefficients of a block, blocks 0 to 3 are
+// luminance and 4 and 5 chrominance.
+func transformBlock(img *image.YCbCr, col, row, b int) [64]float64 {
+	var samples [64]float64
+	plane, stride, x0, y0 := img.Y, img.YStride, col*16+(b&1)*8, row*16+(b>>1)*8
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	switch b {
+	case 4:
+		plane, stride, x0, y0 = img.Cb, img.CStride, col*8, row*8
+		width, height = (width+1)/2, (height+1)/2
+	case 5:
+		plane, stride, x0, y0 = img.Cr, img.CStride, col*8, row*8
+		width, height = (width+1)/2, (height+1)/2
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			// the edges repeat past the picture
+			px, py := x0+x, y0+y
+			if px >= width {
+				px = width - 1
+			}
+			if py >= height {
+				py = height - 1
+			}
+			samples[y*8+x] = float64(plane[py*stride+px])
+		}
+	}
+	return fdct(&samples)
+}
+
+// writeBlock writes an intra-coded block with a quantizer.
+func writeBlock(w *bitWriter, coef *[64]float64, b, quantizer int, dcPredictor *[3]int) {
+	ch, sizes := 0, dcSizeLuminance
+	if b >= 4 {
+		ch, sizes = b-3, dcSizeChrominance
+	}
+	dc := int(math.Round(coef[0] / 8))
+	if dc > 255 {
+		dc = 255
+	} else if dc < 0 {
+		dc = 0
+	}
+	diff := dc - dcPredictor[ch]
+	dcPredictor[ch] = dc
+	size := 0
+	for a := abs(diff); a != 0; a >>= 1 {
+		size++
+	}
+	sizes.encode(w, size)
+	if diff < 0 {
+		diff += 1<<uint(size) - 1
+	}
+	w.write(uint32(diff), size)
+
+	run := 0
+	for i := 1; i < 64; i++ {
+		pos := zigzag[i]
+		level := int(math.Round(coef[pos] * 8 / float64(quantizer*defaultIntraQuant[pos])))
+		if level > maxLevel {
+			level = maxLevel
+		} else if level < -maxLevel {
+			level = -maxLevel
+		}
+		if level == 0 {
+			run++
+			continue
+		}
+		if dctCoefficients.encode(w, rl(run, abs(level))) {
+			if level < 0 {
+				w.write(1, 1)
+			} else {
+				w.write(0, 1)
+			}
+		} else {
+			dctCoefficients.encode(w, dctEscape)
+			w.write(uint32(run), 6)
+			switch {
+			case level > 127:
+				w.write(0, 8)
+				w.write(uint32(level), 8)
+			case level < -127:
+				w.write(128, 8)
+				w.write(uint32(level+256), 8)
+			default:
+				w.write(uint32(level)&0xff, 8)
+			}
+		}
+		run = 0
+	}
+	dctCoefficients.encode(w, dctEndOfBlock)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
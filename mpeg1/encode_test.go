@@ -0,0 +1,147 @@
+package mpeg1
+
+import (
+	"errors"
+	"image"
+	"math"
+	"testing"
+)
+
+// testImage returns a checkerboard of gradients whose edges cross the
+// blocks, the coefficients of which clip at the lowest quantizers.
+func testImage(width, height int) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := (x*255/width + y*255/height) / 4
+			if ((x+4)/8+(y+4)/8)%2 == 0 {
+				v = 255 - v
+			}
+			img.Y[img.YOffset(x, y)] = uint8(v)
+		}
+	}
+	for y := 0; y < (height+1)/2; y++ {
+		for x := 0; x < (width+1)/2; x++ {
+			i := y*img.CStride + x
+			img.Cb[i] = uint8(64 + x*128/width)
+			img.Cr[i] = uint8(192 - y*128/height)
+		}
+	}
+	return img
+}
+
+// psnr returns the peak signal to noise ratio of the luma of b against a.
+func psnr(a, b *image.YCbCr) float64 {
+	var sum float64
+	r := a.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			d := float64(a.Y[a.YOffset(x, y)]) - float64(b.Y[b.YOffset(x, y)])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(r.Dx()*r.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		width, height int
+		quantizer     int
+		psnr          float64 // the lowest luma PSNR in dB
+	}{
+		{320, 240, 1, 40},
+		{320, 240, 4, 35},
+		{320, 240, 8, 30},
+		{320, 240, 31, 20},
+		{100, 60, 2, 38},
+		{16, 16, 1, 38},
+	}
+	for _, tt := range tests {
+		e, err := NewEncoder(tt.width, tt.height, 25, tt.quantizer, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := testImage(tt.width, tt.height)
+		img, err := DecodeIntra(e.Encode(src))
+		if err != nil {
+			t.Errorf("%dx%d q=%d: %v", tt.width, tt.height, tt.quantizer, err)
+			continue
+		}
+		if img.Rect != src.Rect {
+			t.Errorf("%dx%d q=%d: decoded %v", tt.width, tt.height, tt.quantizer, img.Rect)
+			continue
+		}
+		if got := psnr(src, img); got < tt.psnr {
+			t.Errorf("%dx%d q=%d: PSNR %.1f dB, want at least %v", tt.width, tt.height, tt.quantizer, got, tt.psnr)
+		}
+
+		// a predicted picture follows, then the next GOP
+		if _, err := DecodeIntra(e.Encode(src)); !errors.Is(err, ErrNoSequenceHeader) {
+			t.Errorf("%dx%d q=%d: decoded a predicted picture, %v", tt.width, tt.height, tt.quantizer, err)
+		}
+		if _, err := DecodeIntra(e.Encode(src)); err != nil {
+			t.Errorf("%dx%d q=%d: the second GOP: %v", tt.width, tt.height, tt.quantizer, err)
+		}
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		width, height int
+		frameRate     float64
+		quantizer     int
+		gop           int
+		ok            bool
+	}{
+		{320, 240, 25, 4, 25, true},
+		{4095, maxHeight, 30000.0 / 1001, 31, 1, true},
+		{320, 240, 26, 4, 25, false},
+		{0, 240, 25, 4, 25, false},
+		{4096, 240, 25, 4, 25, false},
+		{320, maxHeight + 16, 25, 4, 25, false},
+		{320, 240, 25, 0, 25, false},
+		{320, 240, 25, 32, 25, false},
+		{320, 240, 25, 4, 0, false},
+	}
+	for _, tt := range tests {
+		_, err := NewEncoder(tt.width, tt.height, tt.frameRate, tt.quantizer, tt.gop)
+		if (err == nil) != tt.ok {
+			t.Errorf("%dx%d at %v, q=%d, gop %d: got error %v", tt.width, tt.height, tt.frameRate, tt.quantizer, tt.gop, err)
+		}
+	}
+}
+
+func TestDecodeIntraErrors(t *testing.T) {
+	e, err := NewEncoder(32, 32, 25, 4, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es := e.Encode(testImage(32, 32))
+	picture := 0
+	for i := 4; i+4 <= len(es); i++ {
+		if es[i] == 0 && es[i+1] == 0 && es[i+2] == 1 && es[i+3] == startPicture {
+			picture = i
+			break
+		}
+	}
+
+	tests := []struct {
+		name string
+		es   []byte
+		want error
+	}{
+		{"empty", nil, ErrNoSequenceHeader},
+		{"picture only", es[picture:], ErrNoSequenceHeader},
+		{"sequence header only", es[:picture], ErrNoPicture},
+		{"MPEG-2", append(append(append([]byte{}, es[:picture]...), 0, 0, 1, startExtension, 0x14, 0x8a), es[picture:]...), ErrUnsupported},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeIntra(tt.es); !errors.Is(err, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package mpeg1
+
+import (
+	"math"
+)
+
+// the IDCT basis, idctCos[x][u] = c(u)/2 * cos((2x+1)uπ/16)
+var idctCos [8][8]float64
+
+func init() {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c := 1.0
+			if u == 0 {
+				c = 1 / math.Sqrt2
+			}
+			idctCos[x][u] = c / 2 * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+}
+
+// idct transforms the coefficients of a block in raster order to samples.
+func idct(block *[64]int) (out [64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var sum float64
+			for u := 0; u < 8; u++ {
+				if c := block[y*8+u]; c != 0 {
+					sum += float64(c) * idctCos[x][u]
+				}
+			}
+			tmp[y*8+x] = sum
+		}
+	}
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			var sum float64
+			for v := 0; v < 8; v++ {
+				sum += tmp[v*8+x] * idctCos[y][v]
+			}
+			out[y*8+x] = sum
+		}
+	}
+	return out
+}
+
+// fdct transforms the samples of a block in raster order to coefficients.
+func fdct(samples *[64]float64) (out [64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < 8; x++ {
+				sum += samples[y*8+x] * idctCos[x][u]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var sum float64
+			for y := 0; y < 8; y++ {
+				sum += tmp[y*8+u] * idctCos[y][v]
+			}
+			out[v*8+u] = sum
+		}
+	}
+	return out
+}
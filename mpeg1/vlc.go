@@ -0,0 +1,157 @@
+package mpeg1
+
+import (
+	"strings"
+)
+
+// vlc decodes a variable length code, built from the codes as strings of
+// bits.
+type vlc struct {
+	nodes []vlcNode
+	codes map[int]string // by value, for the encoder
+}
+
+type vlcNode struct {
+	next  [2]int // the index of the children, 0 when none
+	leaf  bool
+	value int
+}
+
+func newVLC(codes map[string]int) *vlc {
+	t := &vlc{nodes: []vlcNode{{}}, codes: map[int]string{}}
+	for code, value := range codes {
+		code = strings.Replace(code, " ", "", -1)
+		t.codes[value] = code
+		n := 0
+		for _, c := range code {
+			bit := int(c - '0')
+			if t.nodes[n].next[bit] == 0 {
+				t.nodes = append(t.nodes, vlcNode{})
+				t.nodes[n].next[bit] = len(t.nodes) - 1
+			}
+			n = t.nodes[n].next[bit]
+		}
+		t.nodes[n].leaf, t.nodes[n].value = true, value
+	}
+	return t
+}
+
+// decode reads a code, false when the bits match none.
+func (t *vlc) decode(r *bitReader) (int, bool) {
+	n := 0
+	for !t.nodes[n].leaf {
+		if r.eof() {
+			return 0, false
+		}
+		n = t.nodes[n].next[r.read(1)]
+		if n == 0 {
+			return 0, false
+		}
+	}
+	return t.nodes[n].value, true
+}
+
+// encode writes the code of a value, false when the table has none.
+func (t *vlc) encode(w *bitWriter, value int) bool {
+	code, ok := t.codes[value]
+	if ok {
+		w.writeCode(code)
+	}
+	return ok
+}
+
+// the special values of the macroblock address increments
+const (
+	mbStuffing = -1
+	mbEscape   = -2
+)
+
+// Table B.1, macroblock_address_increment
+var addressIncrement = newVLC(map[string]int{
+	"1": 1, "011": 2, "010": 3, "0011": 4, "0010": 5, "00011": 6, "00010": 7,
+	"0000111": 8, "0000110": 9, "00001011": 10, "00001010": 11, "00001001": 12,
+	"00001000": 13, "00000111": 14, "00000110": 15, "0000010111": 16,
+	"0000010110": 17, "0000010101": 18, "0000010100": 19, "0000010011": 20,
+	"0000010010": 21, "00000100011": 22, "00000100010": 23, "00000100001": 24,
+	"00000100000": 25, "00000011111": 26, "00000011110": 27, "00000011101": 28,
+	"00000011100": 29, "00000011011": 30, "00000011010": 31, "00000011001": 32,
+	"00000011000": 33,
+	"00000001111": mbStuffing,
+	"00000001000": mbEscape,
+})
+
+// Table B.12 and B.13, dct_dc_size_luminance and dct_dc_size_chrominance
+var (
+	dcSizeLuminance = newVLC(map[string]int{
+		"100": 0, "00": 1, "01": 2, "101": 3, "110": 4, "1110": 5, "11110": 6,
+		"111110": 7, "1111110": 8,
+	})
+	dcSizeChrominance = newVLC(map[string]int{
+		"00": 0, "01": 1, "10": 2, "110": 3, "1110": 4, "11110": 5, "111110": 6,
+		"1111110": 7, "11111110": 8,
+	})
+)
+
+// the special values of the DCT coefficients, the others are
+// run<<8 | level
+const (
+	dctEndOfBlock = -1
+	dctEscape     = -2
+)
+
+func rl(run, level int) int {
+	return run<<8 | level
+}
+
+// Table B.14, dct_coeff_next without the sign bit which follows every
+// run/level code
+var dctCoefficients = newVLC(map[string]int{
+	"10":     dctEndOfBlock,
+	"000001": dctEscape,
+
+	"11": rl(0, 1), "011": rl(1, 1), "0100": rl(0, 2), "0101": rl(2, 1),
+	"00101": rl(0, 3), "00111": rl(3, 1), "00110": rl(4, 1),
+	"000110": rl(1, 2), "000111": rl(5, 1), "000101": rl(6, 1), "000100": rl(7, 1),
+	"0000110": rl(0, 4), "0000100": rl(2, 2), "0000111": rl(8, 1), "0000101": rl(9, 1),
+	"00100110": rl(0, 5), "00100001": rl(0, 6), "00100101": rl(1, 3), "00100100": rl(3, 2),
+	"00100111": rl(10, 1), "00100011": rl(11, 1), "00100010": rl(12, 1), "00100000": rl(13, 1),
+
+	"0000001010": rl(0, 7), "0000001100": rl(1, 4), "0000001011": rl(2, 3),
+	"0000001111": rl(4, 2), "0000001001": rl(5, 2), "0000001110": rl(14, 1),
+	"0000001101": rl(15, 1), "0000001000": rl(16, 1),
+
+	"000000011101": rl(0, 8), "000000011000": rl(0, 9), "000000010011": rl(0, 10),
+	"000000010000": rl(0, 11), "000000011011": rl(1, 5), "000000010100": rl(2, 4),
+	"000000011100": rl(3, 3), "000000010010": rl(4, 3), "000000011110": rl(6, 2),
+	"000000010101": rl(7, 2), "000000010001": rl(8, 2), "000000011111": rl(17, 1),
+	"000000011010": rl(18, 1), "000000011001": rl(19, 1), "000000010111": rl(20, 1),
+	"000000010110": rl(21, 1),
+
+	"0000000011010": rl(0, 12), "0000000011001": rl(0, 13), "0000000011000": rl(0, 14),
+	"0000000010111": rl(0, 15), "0000000010110": rl(1, 6), "0000000010101": rl(1, 7),
+	"0000000010100": rl(2, 5), "0000000010011": rl(3, 4), "0000000010010": rl(5, 3),
+	"0000000010001": rl(9, 2), "0000000010000": rl(10, 2), "0000000011111": rl(22, 1),
+	"0000000011110": rl(23, 1), "0000000011101": rl(24, 1), "0000000011100": rl(25, 1),
+	"0000000011011": rl(26, 1),
+
+	"00000000011111": rl(0, 16), "00000000011110": rl(0, 17), "00000000011101": rl(0, 18),
+	"00000000011100": rl(0, 19), "00000000011011": rl(0, 20), "00000000011010": rl(0, 21),
+	"00000000011001": rl(0, 22), "00000000011000": rl(0, 23), "00000000010111": rl(0, 24),
+	"00000000010110": rl(0, 25), "00000000010101": rl(0, 26), "00000000010100": rl(0, 27),
+	"00000000010011": rl(0, 28), "00000000010010": rl(0, 29), "00000000010001": rl(0, 30),
+	"00000000010000": rl(0, 31),
+
+	"000000000011000": rl(0, 32), "000000000010111": rl(0, 33), "000000000010110": rl(0, 34),
+	"000000000010101": rl(0, 35), "000000000010100": rl(0, 36), "000000000010011": rl(0, 37),
+	"000000000010010": rl(0, 38), "000000000010001": rl(0, 39), "000000000010000": rl(0, 40),
+	"000000000011111": rl(1, 8), "000000000011110": rl(1, 9), "000000000011101": rl(1, 10),
+	"000000000011100": rl(1, 11), "000000000011011": rl(1, 12), "000000000011010": rl(1, 13),
+	"000000000011001": rl(1, 14),
+
+	"0000000000010011": rl(1, 15), "0000000000010010": rl(1, 16), "0000000000010001": rl(1, 17),
+	"0000000000010000": rl(1, 18), "0000000000010100": rl(6, 3), "0000000000011010": rl(11, 2),
+	"0000000000011001": rl(12, 2), "0000000000011000": rl(13, 2), "0000000000010111": rl(14, 2),
+	"0000000000010110": rl(15, 2), "0000000000010101": rl(16, 2), "0000000000011111": rl(27, 1),
+	"0000000000011110": rl(28, 1), "0000000000011101": rl(29, 1), "0000000000011100": rl(30, 1),
+	"0000000000011011": rl(31, 1),
+})
@@ -0,0 +1,259 @@
+package mpegts
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// the number of one second buckets bitrates are measured over
+const rateWindow = 5
+
+// rateMeter measures a bitrate over the last complete seconds.
+type rateMeter struct {
+	bytes [rateWindow]uint64
+	secs  [rateWindow]int64
+	first int64
+}
+
+func (m *rateMeter) add(now time.Time, n int) {
+	sec := now.Unix()
+	if m.first == 0 {
+		m.first = sec
+	}
+	i := sec % rateWindow
+	if m.secs[i] != sec {
+		m.secs[i], m.bytes[i] = sec, 0
+	}
+	m.bytes[i] += uint64(n)
+}
+
+// rate returns the bits/s of the complete seconds of the window.
+func (m *rateMeter) rate(now time.Time) int {
+	sec := now.Unix()
+	seconds := int64(rateWindow - 1)
+	if m.first == 0 {
+		return 0
+	}
+	if elapsed := sec - m.first; elapsed < seconds {
+		seconds = elapsed
+	}
+	if seconds <= 0 {
+		return 0
+	}
+
+	var total uint64
+	for i := range m.secs {
+		if m.secs[i] < sec && m.secs[i] >= sec-seconds {
+			total += m.bytes[i]
+		}
+	}
+	return int(total * 8 / uint64(seconds))
+}
+
+type pidState struct {
+	packets  uint64
+	streamID uint8
+	meter    rateMeter
+}
+
+// Analyzer inspects the packets of a stream to describe its programs,
+// codecs and bitrates.
+type Analyzer struct {
+	tables   Tables
+	pids     map[uint16]*pidState
+	total    rateMeter
+	video    *SequenceHeader
+	videoPID uint16
+	audio    *AudioHeader
+	audioPID uint16
+}
+
+// create a new analyzer
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{pids: map[uint16]*pidState{}}
+}
+
+// Push inspects a packet received at now.
+func (a *Analyzer) Push(p Packet, now time.Time) {
+	a.tables.Update(p)
+	a.total.add(now, PacketSize)
+
+	pid := p.PID()
+	state := a.pids[pid]
+	if state == nil {
+		state = &pidState{}
+		a.pids[pid] = state
+	}
+	state.packets++
+	state.meter.add(now, PacketSize)
+
+	if !p.PayloadUnitStart() {
+		return
+	}
+	h, offset, ok := ParsePESHeader(p.Payload())
+	if !ok {
+		return
+	}
+	state.streamID = h.StreamID
+	es := p.Payload()[offset:]
+	switch {
+	case h.IsVideo():
+		if seq, ok := ParseSequenceHeader(es); ok {
+			a.video, a.videoPID = seq, pid
+		}
+	case h.IsAudio():
+		if audio, _, ok := ParseAudioHeader(es); ok {
+			a.audio, a.audioPID = audio, pid
+		}
+	}
+}
+
+// to get the PAT and PMT seen so far
+func (a *Analyzer) Tables() *Tables {
+	return &a.tables
+}
+
+// Info describes what is known of a stream.
+type Info struct {
+	Programs []ProgramInfo `json:"programs"`
+	PIDs     []PIDInfo     `json:"pids"`
+	Video    *VideoInfo    `json:"video,omitempty"`
+	Audio    *AudioInfo    `json:"audio,omitempty"`
+	Bitrate  int           `json:"bitrate"`
+}
+
+// ProgramInfo describes a program of the PMT.
+type ProgramInfo struct {
+	Number  uint16       `json:"number"`
+	PMTPID  uint16       `json:"pmt_pid"`
+	PCRPID  uint16       `json:"pcr_pid"`
+	Streams []StreamInfo `json:"streams"`
+}
+
+// StreamInfo describes an elementary stream of a program.
+type StreamInfo struct {
+	PID        uint16 `json:"pid"`
+	StreamType uint8  `json:"stream_type"`
+	Codec      string `json:"codec"`
+}
+
+// PIDInfo describes the packets seen on a PID.
+type PIDInfo struct {
+	PID     uint16 `json:"pid"`
+	Kind    string `json:"kind"`
+	Packets uint64 `json:"packets"`
+	Bitrate int    `json:"bitrate"`
+}
+
+// VideoInfo describes the video from its sequence header.
+type VideoInfo struct {
+	PID            uint16  `json:"pid"`
+	Codec          string  `json:"codec"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	AspectRatio    string  `json:"aspect_ratio"`
+	FrameRate      float64 `json:"frame_rate"`
+	NominalBitrate int     `json:"nominal_bitrate,omitempty"`
+	Bitrate        int     `json:"bitrate"`
+}
+
+// AudioInfo describes the audio from its frame headers.
+type AudioInfo struct {
+	PID            uint16 `json:"pid"`
+	Codec          string `json:"codec"`
+	SampleRate     int    `json:"sample_rate"`
+	Channels       int    `json:"channels"`
+	Mode           string `json:"mode"`
+	NominalBitrate int    `json:"nominal_bitrate"`
+	Bitrate        int    `json:"bitrate"`
+}
+
+// Info returns the description of the stream at now.
+func (a *Analyzer) Info(now time.Time) Info {
+	info := Info{
+		Programs: []ProgramInfo{},
+		PIDs:     []PIDInfo{},
+		Bitrate:  a.total.rate(now),
+	}
+
+	pmt := a.tables.PMT()
+	kinds := map[uint16]string{PIDPAT: "pat", NullPID: "null"}
+	if pmt != nil {
+		program := ProgramInfo{Number: pmt.Program, PMTPID: a.tables.PMTPID(), PCRPID: pmt.PCRPID, Streams: []StreamInfo{}}
+		kinds[program.PMTPID] = "pmt"
+		for _, es := range pmt.Streams {
+			program.Streams = append(program.Streams, StreamInfo{PID: es.PID, StreamType: es.StreamType, Codec: a.codec(es.PID)})
+		}
+		info.Programs = append(info.Programs, program)
+	}
+
+	for pid, state := range a.pids {
+		kind, ok := kinds[pid]
+		if !ok {
+			switch {
+			case state.streamID >= StreamIDVideoFirst && state.streamID <= StreamIDVideoLast:
+				kind = "video"
+			case state.streamID >= StreamIDAudioFirst && state.streamID <= StreamIDAudioLast:
+				kind = "audio"
+			default:
+				kind = "other"
+			}
+		}
+		info.PIDs = append(info.PIDs, PIDInfo{PID: pid, Kind: kind, Packets: state.packets, Bitrate: state.meter.rate(now)})
+	}
+	sort.Slice(info.PIDs, func(i, j int) bool { return info.PIDs[i].PID < info.PIDs[j].PID })
+
+	if v := a.video; v != nil {
+		info.Video = &VideoInfo{
+			PID:            a.videoPID,
+			Codec:          a.codec(a.videoPID),
+			Width:          v.Width,
+			Height:         v.Height,
+			AspectRatio:    v.AspectRatio,
+			FrameRate:      v.FrameRate,
+			NominalBitrate: v.Bitrate,
+			Bitrate:        a.pids[a.videoPID].meter.rate(now),
+		}
+	}
+	if au := a.audio; au != nil {
+		info.Audio = &AudioInfo{
+			PID:            a.audioPID,
+			Codec:          a.codec(a.audioPID),
+			SampleRate:     au.SampleRate,
+			Channels:       au.Channels,
+			Mode:           au.Mode,
+			NominalBitrate: au.Bitrate,
+			Bitrate:        a.pids[a.audioPID].meter.rate(now),
+		}
+	}
+	return info
+}
+
+// codec returns the codec of a PID from the PMT refined by the headers of
+// the stream, MPEG-1 and MPEG-2 video sharing a stream type for instance.
+func (a *Analyzer) codec(pid uint16) string {
+	streamType, listed := uint8(0), false
+	if pmt := a.tables.PMT(); pmt != nil {
+		for _, es := range pmt.Streams {
+			if es.PID == pid {
+				streamType, listed = es.StreamType, true
+			}
+		}
+	}
+
+	mpegVideo := !listed || streamType == StreamTypeMPEG1Video || streamType == StreamTypeMPEG2Video
+	mpegAudio := !listed || streamType == StreamTypeMPEG1Audio || streamType == StreamTypeMPEG2Audio
+	switch {
+	case mpegVideo && a.video != nil && pid == a.videoPID:
+		if a.video.MPEG2 {
+			return "mpeg2video"
+		}
+		return "mpeg1video"
+	case mpegAudio && a.audio != nil && pid == a.audioPID:
+		return fmt.Sprintf("mp%d", a.audio.Layer)
+	case listed:
+		return CodecName(streamType)
+	}
+	return "unknown"
+}
@@ -0,0 +1,80 @@
+package mpegts
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAnalyzer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf,
+		ElementaryStream{PID: 0x100, StreamType: StreamTypeMPEG1Video},
+		ElementaryStream{PID: 0x101, StreamType: StreamTypeMPEG1Audio})
+	if err := m.WriteTables(); err != nil {
+		t.Fatal(err)
+	}
+	audio := append([]byte{0xff, 0xfd, 0x84, 0xc0}, make([]byte, 380)...)
+	for i := 0; i < 25; i++ {
+		es := picture(PictureP)
+		if i == 0 {
+			es = append(append([]byte{}, sequence320...), picture(PictureI)...)
+		}
+		if err := m.WritePES(0x100, 0xe0, -1, -1, es); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WritePES(0x101, 0xc0, -1, -1, audio); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a second of packets spread over 3 seconds
+	a := NewAnalyzer()
+	start := time.Unix(1700000000, 0)
+	packets := Packets(buf.Bytes())
+	for i, p := range packets {
+		a.Push(p, start.Add(time.Duration(i)*3*time.Second/time.Duration(len(packets))))
+	}
+	info := a.Info(start.Add(3 * time.Second))
+
+	if len(info.Programs) != 1 {
+		t.Fatalf("got programs %+v", info.Programs)
+	}
+	program := info.Programs[0]
+	if program.Number != MuxProgram || program.PMTPID != MuxPMTPID || program.PCRPID != 0x100 {
+		t.Errorf("got program %+v", program)
+	}
+	wantStreams := []StreamInfo{{0x100, StreamTypeMPEG1Video, "mpeg1video"}, {0x101, StreamTypeMPEG1Audio, "mp2"}}
+	if len(program.Streams) != 2 || program.Streams[0] != wantStreams[0] || program.Streams[1] != wantStreams[1] {
+		t.Errorf("got streams %+v", program.Streams)
+	}
+
+	kinds := map[uint16]string{}
+	var total uint64
+	for _, pid := range info.PIDs {
+		kinds[pid.PID] = pid.Kind
+		total += pid.Packets
+	}
+	if kinds[PIDPAT] != "pat" || kinds[MuxPMTPID] != "pmt" || kinds[0x100] != "video" || kinds[0x101] != "audio" || total != uint64(len(packets)) {
+		t.Errorf("got PIDs %+v", info.PIDs)
+	}
+
+	if v := info.Video; v == nil || v.Width != 320 || v.Height != 240 || v.FrameRate != 25 || v.Codec != "mpeg1video" {
+		t.Errorf("got video %+v", v)
+	}
+	if au := info.Audio; au == nil || au.SampleRate != 48000 || au.Channels != 1 || au.NominalBitrate != 128000 || au.Codec != "mp2" {
+		t.Errorf("got audio %+v", au)
+	}
+	// the bits of the 3 complete seconds, by the second
+	if want := len(buf.Bytes()) * 8 / 3; info.Bitrate < want*8/10 || info.Bitrate > want*12/10 {
+		t.Errorf("got bitrate %v, want about %v", info.Bitrate, want)
+	}
+}
+
+func TestAnalyzerUnknown(t *testing.T) {
+	a := NewAnalyzer()
+	info := a.Info(time.Now())
+	if len(info.Programs) != 0 || len(info.PIDs) != 0 || info.Video != nil || info.Audio != nil || info.Bitrate != 0 {
+		t.Errorf("got %+v before any packet", info)
+	}
+}
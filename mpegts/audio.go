@@ -0,0 +1,222 @@
+package mpegts
+
+import (
+	"math"
+)
+
+// MPEG audio bitrates in kbit/s by version 1 layer and index
+var audioBitrates = [3][16]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // layer I
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // layer II
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // layer III
+}
+
+// MPEG-2 low sampling frequencies bitrates, layer I then layers II and III
+var audioBitratesLSF = [2][16]int{
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+var audioSampleRates = [3]int{44100, 48000, 32000}
+
+var audioModes = [4]string{"stereo", "joint stereo", "dual channel", "mono"}
+
+// AudioHeader holds the fields of an MPEG audio frame header.
+type AudioHeader struct {
+	Version    int // 1 or 2
+	Layer      int // 1, 2 or 3
+	Bitrate    int // bits/s
+	SampleRate int
+	Mode       string
+	Channels   int
+	Protected  bool // a CRC follows the header
+	FrameSize  int  // bytes, 0 when free format
+}
+
+// ParseAudioHeader looks for an MPEG audio frame header in audio data.
+func ParseAudioHeader(es []byte) (*AudioHeader, int, bool) {
+	for i := 0; i+4 <= len(es); i++ {
+		if h, ok := parseAudioHeader(es[i:]); ok {
+			return h, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+func parseAudioHeader(b []byte) (*AudioHeader, bool) {
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+	version := b[1] >> 3 & 0x03 // 3 is MPEG-1, 2 is MPEG-2
+	layer := b[1] >> 1 & 0x03   // 3 is layer I
+	rateIndex := b[2] >> 4
+	srIndex := b[2] >> 2 & 0x03
+	if version == 1 || version == 0 || layer == 0 || rateIndex == 15 || srIndex == 3 {
+		return nil, false
+	}
+
+	h := &AudioHeader{
+		Version:   1,
+		Layer:     int(4 - layer),
+		Mode:      audioModes[b[3]>>6],
+		Channels:  2,
+		Protected: b[1]&0x01 == 0,
+	}
+	if b[3]>>6 == 3 {
+		h.Channels = 1
+	}
+	h.SampleRate = audioSampleRates[srIndex]
+	if version == 3 {
+		h.Bitrate = audioBitrates[h.Layer-1][rateIndex] * 1000
+	} else {
+		h.Version = 2
+		h.SampleRate /= 2
+		lsf := 1
+		if h.Layer == 1 {
+			lsf = 0
+		}
+		h.Bitrate = audioBitratesLSF[lsf][rateIndex] * 1000
+	}
+
+	padding := int(b[2] >> 1 & 0x01)
+	if h.Bitrate > 0 {
+		switch {
+		case h.Layer == 1:
+			h.FrameSize = (12*h.Bitrate/h.SampleRate + padding) * 4
+		case h.Layer == 3 && h.Version == 2:
+			h.FrameSize = 72*h.Bitrate/h.SampleRate + padding
+		default:
+			h.FrameSize = 144*h.Bitrate/h.SampleRate + padding
+		}
+	}
+	return h, true
+}
+
+// the layer II allocation tables, the number of bits of the allocation of
+// each subband
+var (
+	allocBitsA   = layerIIAlloc(27, 11, 4, 23, 3, 27, 2)
+	allocBitsB   = layerIIAlloc(30, 11, 4, 23, 3, 30, 2)
+	allocBitsC   = layerIIAlloc(8, 2, 4, 8, 3)
+	allocBitsD   = layerIIAlloc(12, 2, 4, 12, 3)
+	allocBitsLSF = layerIIAlloc(30, 4, 4, 11, 3, 30, 2)
+)
+
+// layerIIAlloc builds a table of sblimit subbands from pairs of the end of
+// a range of subbands and their number of bits.
+func layerIIAlloc(sblimit int, ranges ...int) []uint {
+	bits := make([]uint, sblimit)
+	sb := 0
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for ; sb < ranges[i]; sb++ {
+			bits[sb] = uint(ranges[i+1])
+		}
+	}
+	return bits
+}
+
+// the table of a layer II frame by its sample rate and bitrate per channel
+func layerIIAllocTable(h *AudioHeader) []uint {
+	if h.Version == 2 {
+		return allocBitsLSF
+	}
+	rate := h.Bitrate / 1000 / h.Channels
+	switch {
+	case (h.SampleRate == 48000 && rate >= 56) || (rate >= 56 && rate <= 80):
+		return allocBitsA
+	case h.SampleRate != 48000 && rate >= 96:
+		return allocBitsB
+	case h.SampleRate != 32000 && rate <= 48:
+		return allocBitsC
+	}
+	return allocBitsD
+}
+
+type bitReader struct {
+	b   []byte
+	pos uint
+}
+
+func (r *bitReader) read(n uint) (int, bool) {
+	v := 0
+	for ; n > 0; n-- {
+		if r.pos/8 >= uint(len(r.b)) {
+			return 0, false
+		}
+		v = v<<1 | int(r.b[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v, true
+}
+
+// Silent is the peak level of a frame without any allocated subband.
+const Silent = -200.0
+
+// ScalefactorPeak returns the peak level in dBFS of an MPEG audio layer II
+// frame from its largest scalefactor, without decoding its samples.
+func ScalefactorPeak(frame []byte) (float64, bool) {
+	if len(frame) < 4 {
+		return 0, false
+	}
+	h, ok := parseAudioHeader(frame)
+	if !ok || h.Layer != 2 || h.Bitrate == 0 {
+		return 0, false
+	}
+	table := layerIIAllocTable(h)
+	sblimit := len(table)
+	bound := sblimit
+	if h.Mode == "joint stereo" {
+		bound = 4 + 4*int(frame[3]>>4&0x03)
+	}
+
+	r := &bitReader{b: frame, pos: 32}
+	if h.Protected {
+		r.pos += 16
+	}
+	var alloc [2][32]int
+	for sb := 0; sb < sblimit; sb++ {
+		for ch := 0; ch < h.Channels; ch++ {
+			if sb >= bound && ch > 0 {
+				alloc[ch][sb] = alloc[0][sb]
+				continue
+			}
+			if alloc[ch][sb], ok = r.read(table[sb]); !ok {
+				return 0, false
+			}
+		}
+	}
+	var scfsi [2][32]int
+	for sb := 0; sb < sblimit; sb++ {
+		for ch := 0; ch < h.Channels; ch++ {
+			if alloc[ch][sb] != 0 {
+				if scfsi[ch][sb], ok = r.read(2); !ok {
+					return 0, false
+				}
+			}
+		}
+	}
+
+	// the scalefactor index 0 is the largest, each step is 2dB lower
+	min := -1
+	for sb := 0; sb < sblimit; sb++ {
+		for ch := 0; ch < h.Channels; ch++ {
+			if alloc[ch][sb] == 0 {
+				continue
+			}
+			n := [4]int{3, 2, 1, 2}[scfsi[ch][sb]]
+			for ; n > 0; n-- {
+				index, ok := r.read(6)
+				if !ok {
+					return 0, false
+				}
+				if min < 0 || index < min {
+					min = index
+				}
+			}
+		}
+	}
+	if min < 0 {
+		return Silent, true
+	}
+	return 20 * math.Log10(2) * (1 - float64(min)/3), true
+}
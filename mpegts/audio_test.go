@@ -0,0 +1,62 @@
+package mpegts
+
+import (
+	"testing"
+)
+
+func TestParseAudioHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		es     []byte
+		want   AudioHeader
+		offset int
+		ok     bool
+	}{
+		{
+			name: "MPEG-1 layer II mono",
+			es:   []byte{0xff, 0xfd, 0x84, 0xc0},
+			want: AudioHeader{Version: 1, Layer: 2, Bitrate: 128000, SampleRate: 48000, Mode: "mono", Channels: 1, FrameSize: 384},
+			ok:   true,
+		},
+		{
+			name: "MPEG-1 layer III stereo with CRC and padding",
+			es:   []byte{0xff, 0xfa, 0x92, 0x00},
+			want: AudioHeader{Version: 1, Layer: 3, Bitrate: 128000, SampleRate: 44100, Mode: "stereo", Channels: 2, Protected: true, FrameSize: 418},
+			ok:   true,
+		},
+		{
+			name: "MPEG-1 layer I joint stereo",
+			es:   []byte{0xff, 0xff, 0x48, 0x40},
+			want: AudioHeader{Version: 1, Layer: 1, Bitrate: 128000, SampleRate: 32000, Mode: "joint stereo", Channels: 2, FrameSize: 192},
+			ok:   true,
+		},
+		{
+			name:   "MPEG-2 layer II after garbage",
+			es:     []byte{0x00, 0xff, 0x12, 0xff, 0xf5, 0x84, 0x80},
+			want:   AudioHeader{Version: 2, Layer: 2, Bitrate: 64000, SampleRate: 24000, Mode: "dual channel", Channels: 2, FrameSize: 384},
+			offset: 3,
+			ok:     true,
+		},
+		{
+			name: "free format",
+			es:   []byte{0xff, 0xfd, 0x04, 0xc0},
+			want: AudioHeader{Version: 1, Layer: 2, SampleRate: 48000, Mode: "mono", Channels: 1},
+			ok:   true,
+		},
+		{name: "reserved version", es: []byte{0xff, 0xed, 0x84, 0xc0}},
+		{name: "reserved layer", es: []byte{0xff, 0xf9, 0x84, 0xc0}},
+		{name: "bad bitrate", es: []byte{0xff, 0xfd, 0xf4, 0xc0}},
+		{name: "reserved sample rate", es: []byte{0xff, 0xfd, 0x8c, 0xc0}},
+		{name: "truncated", es: []byte{0xff, 0xfd, 0x84}},
+	}
+	for _, tt := range tests {
+		h, offset, ok := ParseAudioHeader(tt.es)
+		if ok != tt.ok {
+			t.Errorf("%v: got ok %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && (*h != tt.want || offset != tt.offset) {
+			t.Errorf("%v: got %+v at %d, want %+v at %d", tt.name, *h, offset, tt.want, tt.offset)
+		}
+	}
+}
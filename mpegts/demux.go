@@ -0,0 +1,71 @@
+package mpegts
+
+// PES is a complete packetized elementary stream packet.
+type PES struct {
+	PID    uint16
+	Header *PESHeader
+	Data   []byte // the elementary stream data
+}
+
+type pesBuffer struct {
+	header *PESHeader
+	data   []byte
+	size   int // the expected size of data, 0 when unbounded
+}
+
+// Demuxer reassembles the PES packets of a transport stream.
+type Demuxer struct {
+	pending map[uint16]*pesBuffer
+	cc      ContinuityChecker
+}
+
+// create a new demuxer
+func NewDemuxer() *Demuxer {
+	return &Demuxer{pending: map[uint16]*pesBuffer{}}
+}
+
+// Push feeds a packet and returns the PES packets it completed. A PES with
+// a known length completes with its last packet, an unbounded one (usually
+// video) completes when the next one starts on the same PID. A PES which
+// lost packets is dropped rather than returned with a gap.
+func (d *Demuxer) Push(p Packet) []*PES {
+	pid := p.PID()
+	payload := p.Payload()
+	if pid == PIDPAT || pid == NullPID || len(payload) == 0 {
+		return nil
+	}
+	if d.cc.Check(p) {
+		delete(d.pending, pid)
+	}
+
+	var done []*PES
+	buf := d.pending[pid]
+	if p.PayloadUnitStart() {
+		if buf != nil {
+			done = append(done, &PES{PID: pid, Header: buf.header, Data: buf.data})
+			delete(d.pending, pid)
+		}
+
+		h, offset, ok := ParsePESHeader(payload)
+		if !ok {
+			// not a PES, like a PSI section
+			return done
+		}
+		buf = &pesBuffer{header: h}
+		if h.Length > 0 {
+			buf.size = h.Length + 6 - offset
+		}
+		d.pending[pid] = buf
+		payload = payload[offset:]
+	} else if buf == nil {
+		// the start of the PES was missed
+		return nil
+	}
+
+	buf.data = append(buf.data, payload...)
+	if buf.size > 0 && len(buf.data) >= buf.size {
+		delete(d.pending, pid)
+		done = append(done, &PES{PID: pid, Header: buf.header, Data: buf.data[:buf.size]})
+	}
+	return done
+}
@@ -0,0 +1,162 @@
+package mpegts
+
+import (
+	"io"
+)
+
+// the PIDs and program number used by the muxer
+const (
+	MuxProgram = 1
+	MuxPMTPID  = 0x1000
+)
+
+// Muxer writes elementary streams as the single program of a transport
+// stream.
+type Muxer struct {
+	w       io.Writer
+	streams []ElementaryStream
+	cc      map[uint16]uint8
+	buf     []byte
+}
+
+// create a muxer of a program, the first stream carries the PCR
+func NewMuxer(w io.Writer, streams ...ElementaryStream) *Muxer {
+	return &Muxer{w: w, streams: streams, cc: map[uint16]uint8{}}
+}
+
+// WriteTables writes the PAT and the PMT, which are repeated for players to
+// join the stream.
+func (m *Muxer) WriteTables() error {
+	pat := []byte{
+		TableIDPAT, 0, 0, 0, 1, 0xc1, 0, 0,
+		MuxProgram >> 8, MuxProgram & 0xff, 0xe0 | MuxPMTPID>>8, MuxPMTPID & 0xff,
+	}
+
+	var pcrPID uint16 = NullPID
+	if len(m.streams) > 0 {
+		pcrPID = m.streams[0].PID
+	}
+	pmt := []byte{
+		TableIDPMT, 0, 0, MuxProgram >> 8, MuxProgram & 0xff, 0xc1, 0, 0,
+		0xe0 | byte(pcrPID>>8), byte(pcrPID), 0xf0, 0,
+	}
+	for _, es := range m.streams {
+		pmt = append(pmt, es.StreamType, 0xe0|byte(es.PID>>8), byte(es.PID), 0xf0, 0)
+	}
+
+	m.buf = m.buf[:0]
+	m.buf = m.appendSection(m.buf, PIDPAT, pat)
+	m.buf = m.appendSection(m.buf, MuxPMTPID, pmt)
+	_, err := m.w.Write(m.buf)
+	return err
+}
+
+// appendSection appends a packet carrying a section, setting its length and
+// CRC.
+func (m *Muxer) appendSection(out []byte, pid uint16, s []byte) []byte {
+	length := len(s) + 4 - 3
+	s[1], s[2] = 0xb0|byte(length>>8), byte(length)
+	crc := crc32MPEG(s)
+	s = append(s, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+
+	p := make([]byte, PacketSize)
+	m.header(p, pid, true)
+	p[3] |= 0x10
+	p[4] = 0 // pointer field
+	n := copy(p[5:], s)
+	for i := 5 + n; i < PacketSize; i++ {
+		p[i] = 0xff
+	}
+	return append(out, p...)
+}
+
+// WritePES writes a PES packet of a stream. The PTS is in 90kHz units and the
+// PCR in 27MHz units, a negative value leaves them out.
+func (m *Muxer) WritePES(pid uint16, streamID uint8, pts, pcr int64, data []byte) error {
+	pes := make([]byte, 0, 14+len(data))
+	pes = append(pes, 0, 0, 1, streamID, 0, 0, 0x80, 0, 0)
+	if pts >= 0 {
+		pes[7], pes[8] = 0x80, 5
+		pes = append(pes,
+			0x21|byte(pts>>29)&0x0e, byte(pts>>22), byte(pts>>14)|0x01, byte(pts>>7), byte(pts<<1)|0x01)
+	}
+	// video may be longer than the length field allows, 0 means unbounded
+	if length := len(pes) - 6 + len(data); length <= 0xffff {
+		pes[4], pes[5] = byte(length>>8), byte(length)
+	}
+	pes = append(pes, data...)
+
+	m.buf = m.buf[:0]
+	for first := true; len(pes) > 0; first = false {
+		p := make([]byte, PacketSize)
+		m.header(p, pid, first)
+		p[3] |= 0x10
+
+		// the adaptation field carries the PCR and the stuffing
+		var af []byte
+		if first && pcr >= 0 {
+			base, ext := pcr/300, pcr%300
+			af = []byte{0x10, byte(base >> 25), byte(base >> 17), byte(base >> 9), byte(base >> 1), byte(base<<7) | 0x7e | byte(ext>>8), byte(ext)}
+		}
+		room := PacketSize - 4
+		if af != nil {
+			room -= 1 + len(af)
+		}
+		if len(pes) < room {
+			if af == nil {
+				af = []byte{}
+				room--
+			}
+			if stuffing := room - len(pes); stuffing > 0 {
+				if len(af) == 0 {
+					af = append(af, 0)
+					stuffing--
+				}
+				for i := 0; i < stuffing; i++ {
+					af = append(af, 0xff)
+				}
+			}
+			room = len(pes)
+		}
+
+		offset := 4
+		if af != nil {
+			p[3] |= 0x20
+			p[4] = byte(len(af))
+			offset += 1 + copy(p[5:], af)
+		}
+		pes = pes[copy(p[offset:], pes[:room]):]
+		m.buf = append(m.buf, p...)
+	}
+	_, err := m.w.Write(m.buf)
+	return err
+}
+
+// header writes the header of the next packet of a PID.
+func (m *Muxer) header(p []byte, pid uint16, start bool) {
+	p[0] = SyncByte
+	p[1] = byte(pid>>8) & 0x1f
+	if start {
+		p[1] |= 0x40
+	}
+	p[2] = byte(pid)
+	p[3] = m.cc[pid] & 0x0f
+	m.cc[pid]++
+}
+
+// crc32MPEG computes the CRC of PSI sections, polynomial 0x04c11db7 without
+// reflection.
+func crc32MPEG(b []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, v := range b {
+		crc ^= uint32(v) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,54 @@
+package mpegts
+
+import (
+	"time"
+)
+
+// PCRFrequency is the frequency of the program clock reference.
+const PCRFrequency = 27000000
+
+// the largest forward PCR jump considered continuous
+const maxPCRJump = 2 * PCRFrequency
+
+// Pacer maps the program clock reference of a stream onto the wall clock
+// so that a stored stream can be sent at real-time pace.
+type Pacer struct {
+	pid     uint16
+	base    int64
+	last    int64
+	start   time.Time
+	started bool
+}
+
+// Reset forgets the current time base, the next PCR is sent immediately.
+// It is used after a pause or a seek.
+func (p *Pacer) Reset() {
+	p.started = false
+}
+
+// Delay returns how long to wait from now before sending the packet. Only
+// packets carrying the PCR of the first PCR PID seen are delayed, the time
+// base is reset on discontinuities or backward jumps.
+func (p *Pacer) Delay(pkt Packet, now time.Time) time.Duration {
+	pcr, ok := pkt.PCR()
+	if !ok {
+		return 0
+	}
+	if p.started && pkt.PID() != p.pid {
+		return 0
+	}
+
+	if !p.started || pkt.Discontinuity() || pcr < p.last || pcr-p.last > maxPCRJump {
+		p.pid = pkt.PID()
+		p.base = pcr
+		p.start = now
+		p.started = true
+	}
+	p.last = pcr
+	return p.start.Add(PCRDuration(pcr - p.base)).Sub(now)
+}
+
+// PCRDuration converts a number of 27MHz ticks into a duration.
+func PCRDuration(ticks int64) time.Duration {
+	return time.Duration(ticks * 1000 / (PCRFrequency / 1000000))
+}
@@ -0,0 +1,54 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+)
+
+// pcrPacket returns a packet of a PID carrying a PCR in 27MHz units.
+func pcrPacket(pid uint16, pcr int64, discontinuity bool) Packet {
+	base, ext := pcr/300, pcr%300
+	af := []byte{0x10, byte(base >> 25), byte(base >> 17), byte(base >> 9), byte(base >> 1), byte(base<<7) | 0x7e | byte(ext>>8), byte(ext)}
+	if discontinuity {
+		af[0] |= 0x80
+	}
+	return packet(pid, 0, true, af)
+}
+
+func TestPacer(t *testing.T) {
+	start := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Millisecond)
+	}
+	tests := []struct {
+		name  string
+		pkt   Packet
+		now   time.Time
+		delay time.Duration
+	}{
+		{"first PCR", pcrPacket(0x100, 27000000, false), ms(0), 0},
+		{"no PCR", packet(0x100, 0, true, nil), ms(0), 0},
+		{"40ms later", pcrPacket(0x100, 27000000+40*27000, false), ms(10), 30 * time.Millisecond},
+		{"late", pcrPacket(0x100, 27000000+80*27000, false), ms(100), -20 * time.Millisecond},
+		{"other PID", pcrPacket(0x101, 0, false), ms(100), 0},
+		{"backward jump", pcrPacket(0x100, 1000, false), ms(200), 0},
+		{"after the jump", pcrPacket(0x100, 1000+100*27000, false), ms(250), 50 * time.Millisecond},
+		{"forward jump", pcrPacket(0x100, 1000+10*PCRFrequency, false), ms(300), 0},
+		{"discontinuity", pcrPacket(0x100, 5*PCRFrequency, true), ms(400), 0},
+		{"after the discontinuity", pcrPacket(0x100, 6*PCRFrequency, false), ms(400), time.Second},
+	}
+	var p Pacer
+	for _, tt := range tests {
+		if got := p.Delay(tt.pkt, tt.now); got != tt.delay {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.delay)
+		}
+	}
+
+	p.Reset()
+	if got := p.Delay(pcrPacket(0x101, 0, false), ms(500)); got != 0 {
+		t.Errorf("got %v after a reset", got)
+	}
+	if got := p.Delay(pcrPacket(0x101, 27000*20, false), ms(500)); got != 20*time.Millisecond {
+		t.Errorf("got %v on the PID seen after the reset", got)
+	}
+}
@@ -0,0 +1,171 @@
+package mpegts
+
+import (
+	"bytes"
+)
+
+const (
+	PacketSize = 188
+	SyncByte   = 0x47
+	NullPID    = 0x1fff
+)
+
+// Packet is a single 188 bytes transport stream packet.
+type Packet []byte
+
+// to get the packet identifier
+func (p Packet) PID() uint16 {
+	return uint16(p[1]&0x1f)<<8 | uint16(p[2])
+}
+
+// to check whether the transport error indicator is set
+func (p Packet) TransportError() bool {
+	return p[1]&0x80 != 0
+}
+
+// to check whether a PES packet or a PSI section starts in this packet
+func (p Packet) PayloadUnitStart() bool {
+	return p[1]&0x40 != 0
+}
+
+// to get the 4 bits continuity counter
+func (p Packet) ContinuityCounter() uint8 {
+	return p[3] & 0x0f
+}
+
+// to check whether the packet carries an adaptation field
+func (p Packet) HasAdaptationField() bool {
+	return p[3]&0x20 != 0
+}
+
+// to check whether the packet carries a payload
+func (p Packet) HasPayload() bool {
+	return p[3]&0x10 != 0
+}
+
+// to get the adaptation field, without its length byte
+func (p Packet) AdaptationField() []byte {
+	if !p.HasAdaptationField() {
+		return nil
+	}
+	n := int(p[4])
+	if 5+n > PacketSize {
+		return nil
+	}
+	return p[5 : 5+n]
+}
+
+// to check whether the discontinuity indicator is set
+func (p Packet) Discontinuity() bool {
+	af := p.AdaptationField()
+	return len(af) > 0 && af[0]&0x80 != 0
+}
+
+// to set the discontinuity indicator, false when the packet has no
+// adaptation field to hold it
+func (p Packet) SetDiscontinuity() bool {
+	if len(p.AdaptationField()) == 0 {
+		return false
+	}
+	p[5] |= 0x80
+	return true
+}
+
+// to get the program clock reference in 27MHz units
+func (p Packet) PCR() (int64, bool) {
+	af := p.AdaptationField()
+	if len(af) < 7 || af[0]&0x10 == 0 {
+		return 0, false
+	}
+	base := int64(af[1])<<25 | int64(af[2])<<17 | int64(af[3])<<9 | int64(af[4])<<1 | int64(af[5])>>7
+	ext := int64(af[5]&0x01)<<8 | int64(af[6])
+	return base*300 + ext, true
+}
+
+// to get the payload following the header and the adaptation field
+func (p Packet) Payload() []byte {
+	if !p.HasPayload() {
+		return nil
+	}
+	offset := 4
+	if p.HasAdaptationField() {
+		offset += 1 + int(p[4])
+	}
+	if offset >= PacketSize {
+		return nil
+	}
+	return p[offset:]
+}
+
+// ContinuityChecker follows the continuity counters of the PIDs of a stream.
+type ContinuityChecker struct {
+	last      map[uint16]uint8
+	duplicate map[uint16]bool // whether the last packet repeated the one before
+}
+
+// Check reports whether packets were lost or reordered before p. The counter
+// only increments on packets with payload, a single duplicate is allowed.
+func (c *ContinuityChecker) Check(p Packet) bool {
+	pid := p.PID()
+	if pid == NullPID || !p.HasPayload() {
+		return false
+	}
+	if c.last == nil {
+		c.last = map[uint16]uint8{}
+		c.duplicate = map[uint16]bool{}
+	}
+	cc := p.ContinuityCounter()
+	last, ok := c.last[pid]
+	c.last[pid] = cc
+	if !ok || p.Discontinuity() {
+		c.duplicate[pid] = false
+		return false
+	}
+	if cc == last {
+		repeated := c.duplicate[pid]
+		c.duplicate[pid] = true
+		return repeated
+	}
+	c.duplicate[pid] = false
+	return cc != (last+1)&0x0f
+}
+
+// Packets splits an aligned buffer into packets.
+func Packets(data []byte) []Packet {
+	pkts := make([]Packet, 0, len(data)/PacketSize)
+	for i := 0; i+PacketSize <= len(data); i += PacketSize {
+		pkts = append(pkts, Packet(data[i:i+PacketSize]))
+	}
+	return pkts
+}
+
+// Aligner reassembles an arbitrary chunked byte stream into whole packets,
+// resynchronizing on the sync byte when garbage shows up.
+type Aligner struct {
+	pending []byte
+}
+
+// Push appends data and returns a new buffer holding all the complete
+// packets available, the remainder is kept for the next call.
+func (a *Aligner) Push(data []byte) []byte {
+	a.pending = append(a.pending, data...)
+
+	out := make([]byte, 0, len(a.pending))
+	i := 0
+	for i+PacketSize <= len(a.pending) {
+		if a.pending[i] != SyncByte || (i+PacketSize < len(a.pending) && a.pending[i+PacketSize] != SyncByte) {
+			// lost sync: skip to the next candidate sync byte
+			next := bytes.IndexByte(a.pending[i+1:], SyncByte)
+			if next < 0 {
+				i = len(a.pending)
+				break
+			}
+			i += 1 + next
+			continue
+		}
+		out = append(out, a.pending[i:i+PacketSize]...)
+		i += PacketSize
+	}
+	a.pending = append(a.pending[:0], a.pending[i:]...)
+	return out
+}
@@ -0,0 +1,143 @@
+package mpegts
+
+import (
+	"bytes"
+	"testing"
+)
+
+// packet returns a packet of a PID with a continuity counter, a payload and
+// an adaptation field of the given flags when af is not nil.
+func packet(pid uint16, cc uint8, payload bool, af []byte) Packet {
+	p := make(Packet, PacketSize)
+	p[0], p[1], p[2], p[3] = SyncByte, byte(pid>>8)&0x1f, byte(pid), cc&0x0f
+	if payload {
+		p[3] |= 0x10
+	}
+	if af != nil {
+		p[3] |= 0x20
+		p[4] = byte(len(af))
+		copy(p[5:], af)
+	}
+	return p
+}
+
+func TestContinuityChecker(t *testing.T) {
+	discontinuity := []byte{0x80}
+	tests := []struct {
+		name string
+		pkts []Packet
+		want []bool
+	}{
+		{"in order", []Packet{packet(0x100, 14, true, nil), packet(0x100, 15, true, nil), packet(0x100, 0, true, nil)}, []bool{false, false, false}},
+		{"lost", []Packet{packet(0x100, 1, true, nil), packet(0x100, 3, true, nil), packet(0x100, 4, true, nil)}, []bool{false, true, false}},
+		{"one duplicate", []Packet{packet(0x100, 1, true, nil), packet(0x100, 1, true, nil), packet(0x100, 2, true, nil)}, []bool{false, false, false}},
+		{"two duplicates", []Packet{packet(0x100, 1, true, nil), packet(0x100, 1, true, nil), packet(0x100, 1, true, nil)}, []bool{false, false, true}},
+		{"duplicates apart", []Packet{packet(0x100, 1, true, nil), packet(0x100, 1, true, nil), packet(0x100, 2, true, nil), packet(0x100, 2, true, nil)}, []bool{false, false, false, false}},
+		{"no payload", []Packet{packet(0x100, 1, true, nil), packet(0x100, 1, false, []byte{0}), packet(0x100, 2, true, nil)}, []bool{false, false, false}},
+		{"discontinuity", []Packet{packet(0x100, 1, true, nil), packet(0x100, 9, true, discontinuity), packet(0x100, 10, true, nil)}, []bool{false, false, false}},
+		{"PIDs apart", []Packet{packet(0x100, 1, true, nil), packet(0x101, 7, true, nil), packet(0x100, 2, true, nil), packet(0x101, 9, true, nil)}, []bool{false, false, false, true}},
+		{"null packets", []Packet{packet(NullPID, 1, true, nil), packet(NullPID, 5, true, nil)}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		var c ContinuityChecker
+		for i, p := range tt.pkts {
+			if got := c.Check(p); got != tt.want[i] {
+				t.Errorf("%v: packet %d got %v, want %v", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPCR(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Packet
+		want int64
+		ok   bool
+	}{
+		{"zero", packet(0x100, 0, true, []byte{0x10, 0, 0, 0, 0, 0x7e, 0}), 0, true},
+		{"base and extension", packet(0x100, 0, true, []byte{0x10, 0, 0, 0, 0x01, 0xfe, 0x2a}), 3*300 + 0x2a, true},
+		{"largest", packet(0x100, 0, true, []byte{0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0x2b}), (1<<33-1)*300 + 299, true},
+		{"no PCR flag", packet(0x100, 0, true, []byte{0x00, 0, 0, 0, 0, 0, 0}), 0, false},
+		{"short field", packet(0x100, 0, true, []byte{0x10, 0, 0}), 0, false},
+		{"no adaptation field", packet(0x100, 0, true, nil), 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := tt.p.PCR(); got != tt.want || ok != tt.ok {
+			t.Errorf("%v: got %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSetDiscontinuity(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Packet
+		ok   bool
+	}{
+		{"PCR", packet(0x100, 0, true, []byte{0x10, 0, 0, 0, 0, 0x7e, 0}), true},
+		{"stuffing", packet(0x100, 0, true, []byte{0x00, 0xff}), true},
+		{"empty adaptation field", packet(0x100, 0, true, []byte{}), false},
+		{"no adaptation field", packet(0x100, 0, true, nil), false},
+	}
+	for _, tt := range tests {
+		pcr, hasPCR := tt.p.PCR()
+		if ok := tt.p.SetDiscontinuity(); ok != tt.ok || tt.p.Discontinuity() != tt.ok {
+			t.Errorf("%v: got %v, discontinuity %v, want %v", tt.name, ok, tt.p.Discontinuity(), tt.ok)
+		}
+		if got, ok := tt.p.PCR(); got != pcr || ok != hasPCR {
+			t.Errorf("%v: the PCR changed to %v, %v", tt.name, got, ok)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	full := packet(0x100, 0, false, make([]byte, PacketSize-5))
+	full[3] |= 0x10
+	tests := []struct {
+		name string
+		p    Packet
+		want int
+	}{
+		{"payload only", packet(0x100, 0, true, nil), PacketSize - 4},
+		{"with an adaptation field", packet(0x100, 0, true, []byte{0x10, 0, 0, 0, 0, 0x7e, 0}), PacketSize - 4 - 8},
+		{"adaptation field only", packet(0x100, 0, false, []byte{0}), 0},
+		{"adaptation field filling the packet", full, 0},
+	}
+	for _, tt := range tests {
+		if got := len(tt.p.Payload()); got != tt.want {
+			t.Errorf("%v: got %d bytes, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAligner(t *testing.T) {
+	a, b := packet(0x100, 0, true, nil), packet(0x100, 1, true, nil)
+	for i := 4; i < PacketSize; i++ {
+		a[i], b[i] = 0xa5, 0x5a
+	}
+	ab := append(append([]byte{}, a...), b...)
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   []byte
+	}{
+		{"whole packets", [][]byte{ab}, ab},
+		{"split packets", [][]byte{ab[:100], ab[100:200], ab[200:]}, ab},
+		{"byte by byte", bytes.Split(ab, nil), ab},
+		{"garbage first", [][]byte{{0x00, SyncByte, 0x12}, ab}, ab},
+		{"garbage between", [][]byte{a, {0x47, 0x47, 0x00}, b, a}, bytes.Join([][]byte{a, b, a}, nil)},
+		{"partial packet", [][]byte{ab[:PacketSize+10]}, a},
+	}
+	for _, tt := range tests {
+		var al Aligner
+		var got []byte
+		for _, chunk := range tt.chunks {
+			got = append(got, al.Push(chunk)...)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%v: got %d bytes, want %d", tt.name, len(got), len(tt.want))
+		}
+	}
+}
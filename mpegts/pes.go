@@ -0,0 +1,129 @@
+package mpegts
+
+// stream id ranges of PES packets
+const (
+	StreamIDAudioFirst = 0xc0
+	StreamIDAudioLast  = 0xdf
+	StreamIDVideoFirst = 0xe0
+	StreamIDVideoLast  = 0xef
+)
+
+// MPEG-1/2 video start codes
+const (
+	StartCodePicture   = 0x00
+	StartCodeSequence  = 0xb3
+	StartCodeExtension = 0xb5
+	StartCodeSeqEnd    = 0xb7
+	StartCodeGOP       = 0xb8
+)
+
+// the picture coding types
+const (
+	PictureI = 1
+	PictureP = 2
+	PictureB = 3
+)
+
+// PESHeader holds the fields of a PES packet header the relay cares about.
+type PESHeader struct {
+	StreamID uint8
+	Length   int // 0 when unbounded
+	PTS      int64
+	HasPTS   bool
+	DTS      int64
+	HasDTS   bool
+}
+
+// to check whether the PES carries video
+func (h *PESHeader) IsVideo() bool {
+	return h.StreamID >= StreamIDVideoFirst && h.StreamID <= StreamIDVideoLast
+}
+
+// to check whether the PES carries audio
+func (h *PESHeader) IsAudio() bool {
+	return h.StreamID >= StreamIDAudioFirst && h.StreamID <= StreamIDAudioLast
+}
+
+// ParsePESHeader parses the header at the start of a PES packet and
+// returns it along with the offset of the elementary stream data.
+func ParsePESHeader(b []byte) (*PESHeader, int, bool) {
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return nil, 0, false
+	}
+	h := &PESHeader{
+		StreamID: b[3],
+		Length:   int(b[4])<<8 | int(b[5]),
+	}
+	if b[6]&0xc0 != 0x80 {
+		// MPEG-1 system style PES header, not used in transport streams
+		return h, 6, true
+	}
+
+	flags := b[7]
+	offset := 9 + int(b[8])
+	if offset > len(b) {
+		return nil, 0, false
+	}
+	if flags&0x80 != 0 && len(b) >= 14 {
+		h.PTS, h.HasPTS = parseTimestamp(b[9:14]), true
+	}
+	if flags&0x40 != 0 && len(b) >= 19 {
+		h.DTS, h.HasDTS = parseTimestamp(b[14:19]), true
+	}
+	return h, offset, true
+}
+
+func parseTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// IsKeyframe reports whether a video PES starts in the packet with either a
+// sequence header or an intra coded picture, a point where a decoder such as
+// jsmpeg can start decoding.
+func IsKeyframe(p Packet) bool {
+	if !p.PayloadUnitStart() {
+		return false
+	}
+	h, offset, ok := ParsePESHeader(p.Payload())
+	if !ok || !h.IsVideo() {
+		return false
+	}
+	es := p.Payload()[offset:]
+	for i := 0; i+5 < len(es); i++ {
+		if es[i] != 0 || es[i+1] != 0 || es[i+2] != 1 {
+			continue
+		}
+		switch es[i+3] {
+		case StartCodeSequence:
+			return true
+		case StartCodePicture:
+			return es[i+5]>>3&0x07 == PictureI
+		}
+	}
+	return false
+}
+
+// Chunk is a run of packets, a keyframe packet always starts its own chunk.
+type Chunk struct {
+	Data     []byte
+	Keyframe bool
+}
+
+// SplitKeyframes splits aligned packets before every keyframe.
+func SplitKeyframes(data []byte) []Chunk {
+	chunks := []Chunk{}
+	start, keyframe := 0, false
+	for i := 0; i+PacketSize <= len(data); i += PacketSize {
+		if !IsKeyframe(Packet(data[i : i+PacketSize])) {
+			continue
+		}
+		if i > start {
+			chunks = append(chunks, Chunk{Data: data[start:i], Keyframe: keyframe})
+		}
+		start, keyframe = i, true
+	}
+	if start < len(data) {
+		chunks = append(chunks, Chunk{Data: data[start:], Keyframe: keyframe})
+	}
+	return chunks
+}
@@ -0,0 +1,208 @@
+package mpegts
+
+import (
+	"bytes"
+	"testing"
+)
+
+// pes returns the packets of a PES written by a muxer.
+func pes(t *testing.T, pid uint16, streamID uint8, pts, pcr int64, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewMuxer(&buf).WritePES(pid, streamID, pts, pcr, data); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParsePESHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      []byte
+		want   PESHeader
+		offset int
+		ok     bool
+	}{
+		{
+			name:   "video with PTS",
+			b:      []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5, 0x21 | 0x02, 0, 0x01, 0, 0x01, 0xaa},
+			want:   PESHeader{StreamID: 0xe0, PTS: 1 << 30, HasPTS: true},
+			offset: 14,
+			ok:     true,
+		},
+		{
+			name:   "audio with PTS and DTS",
+			b:      []byte{0, 0, 1, 0xc0, 0, 13, 0x80, 0xc0, 10, 0x31, 0, 0x03, 0, 0x05, 0x11, 0, 0x01, 0, 0x03},
+			want:   PESHeader{StreamID: 0xc0, Length: 13, PTS: 1<<15 | 2, HasPTS: true, DTS: 1, HasDTS: true},
+			offset: 19,
+			ok:     true,
+		},
+		{
+			name:   "no timestamp",
+			b:      []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0, 0, 0xaa},
+			want:   PESHeader{StreamID: 0xe0},
+			offset: 9,
+			ok:     true,
+		},
+		{
+			name:   "MPEG-1 system",
+			b:      []byte{0, 0, 1, 0xe0, 0, 4, 0x0f, 0, 0},
+			want:   PESHeader{StreamID: 0xe0, Length: 4},
+			offset: 6,
+			ok:     true,
+		},
+		{name: "no start code", b: []byte{0, 0, 2, 0xe0, 0, 0, 0x80, 0, 0}},
+		{name: "short", b: []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0}},
+		{name: "header past the data", b: []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5, 0x21}},
+	}
+	for _, tt := range tests {
+		h, offset, ok := ParsePESHeader(tt.b)
+		if ok != tt.ok {
+			t.Errorf("%v: got ok %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && (*h != tt.want || offset != tt.offset) {
+			t.Errorf("%v: got %+v at %d, want %+v at %d", tt.name, *h, offset, tt.want, tt.offset)
+		}
+	}
+}
+
+func TestWritePES(t *testing.T) {
+	data := bytes.Repeat([]byte{0xa5}, 500)
+	tests := []struct {
+		name     string
+		streamID uint8
+		pts, pcr int64
+		data     []byte
+	}{
+		{"video with PTS and PCR", 0xe0, 123456789, 27000000 * 10, data},
+		{"audio with PTS", 0xc0, 1<<33 - 1, -1, data[:100]},
+		{"no timestamp", 0xe0, -1, -1, data[:1]},
+		{"one full packet", 0xe0, -1, -1, data[:PacketSize-4-9]},
+	}
+	for _, tt := range tests {
+		out := pes(t, 0x100, tt.streamID, tt.pts, tt.pcr, tt.data)
+		if len(out)%PacketSize != 0 {
+			t.Errorf("%v: %d bytes is not whole packets", tt.name, len(out))
+			continue
+		}
+
+		d := NewDemuxer()
+		var got []*PES
+		for _, p := range Packets(out) {
+			got = append(got, d.Push(p)...)
+		}
+		if len(got) != 1 {
+			t.Errorf("%v: got %d PES, want 1", tt.name, len(got))
+			continue
+		}
+		if h := got[0].Header; h.StreamID != tt.streamID || h.HasPTS != (tt.pts >= 0) || (h.HasPTS && h.PTS != tt.pts) {
+			t.Errorf("%v: got header %+v", tt.name, h)
+		}
+		if !bytes.Equal(got[0].Data, tt.data) {
+			t.Errorf("%v: got %d bytes of data, want %d", tt.name, len(got[0].Data), len(tt.data))
+		}
+		pcr, ok := Packet(out[:PacketSize]).PCR()
+		if ok != (tt.pcr >= 0) || (ok && pcr != tt.pcr) {
+			t.Errorf("%v: got PCR %v, %v, want %v", tt.name, pcr, ok, tt.pcr)
+		}
+	}
+}
+
+func TestDemuxerLoss(t *testing.T) {
+	data := bytes.Repeat([]byte{0xa5}, 500)
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	for i := 0; i < 3; i++ {
+		if err := m.WritePES(0x101, 0xc0, int64(i), -1, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	packets := Packets(buf.Bytes())
+	perPES := len(packets) / 3
+
+	// the second packet of the first PES is lost, the rest of it is dropped
+	d := NewDemuxer()
+	var got []*PES
+	for i, p := range packets {
+		if i != 1 {
+			got = append(got, d.Push(p)...)
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d PES, want 2", len(got))
+	}
+	for i, pes := range got {
+		if pes.Header.PTS != int64(i+1) || !bytes.Equal(pes.Data, data) {
+			t.Errorf("PES %v: got PTS %v and %d bytes", i, pes.Header.PTS, len(pes.Data))
+		}
+	}
+
+	// the start of the second PES is lost, the next one starts anew
+	d = NewDemuxer()
+	got = nil
+	for i, p := range packets {
+		if i != perPES {
+			got = append(got, d.Push(p)...)
+		}
+	}
+	if len(got) != 2 || got[0].Header.PTS != 0 || got[1].Header.PTS != 2 {
+		t.Errorf("got %d PES after losing a start", len(got))
+	}
+}
+
+func TestIsKeyframe(t *testing.T) {
+	sequence := []byte{0, 0, 1, StartCodeSequence, 0x14, 0x00, 0xf0, 0x13, 0xff, 0xff, 0xe0}
+	tests := []struct {
+		name     string
+		streamID uint8
+		data     []byte
+		want     bool
+	}{
+		{"sequence header", 0xe0, sequence, true},
+		{"I picture", 0xe0, []byte{0, 0, 1, StartCodePicture, 0, PictureI << 3, 0xff, 0xf8}, true},
+		{"P picture", 0xe0, []byte{0, 0, 1, StartCodePicture, 0, PictureP << 3, 0xff, 0xf8}, false},
+		{"audio", 0xc0, sequence, false},
+	}
+	for _, tt := range tests {
+		out := pes(t, 0x100, tt.streamID, 0, -1, tt.data)
+		if got := IsKeyframe(Packet(out[:PacketSize])); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKeyframes(t *testing.T) {
+	key := pes(t, 0x100, 0xe0, 0, -1, []byte{0, 0, 1, StartCodePicture, 0, PictureI << 3, 0xff, 0xf8})
+	delta := pes(t, 0x100, 0xe0, 0, -1, []byte{0, 0, 1, StartCodePicture, 0, PictureP << 3, 0xff, 0xf8})
+	cat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []Chunk
+	}{
+		{"empty", nil, []Chunk{}},
+		{"no keyframe", cat(delta, delta), []Chunk{{Data: cat(delta, delta)}}},
+		{"keyframe first", cat(key, delta), []Chunk{{Data: cat(key, delta), Keyframe: true}}},
+		{"keyframe later", cat(delta, key, delta, key), []Chunk{
+			{Data: delta},
+			{Data: cat(key, delta), Keyframe: true},
+			{Data: key, Keyframe: true},
+		}},
+	}
+	for _, tt := range tests {
+		got := SplitKeyframes(tt.data)
+		if len(got) != len(tt.want) {
+			t.Errorf("%v: got %d chunks, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i].Keyframe != tt.want[i].Keyframe || !bytes.Equal(got[i].Data, tt.want[i].Data) {
+				t.Errorf("%v: chunk %d differs", tt.name, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package mpegts
+
+// PIDPAT is the PID of the program association table.
+const PIDPAT = 0x0000
+
+// the table ids of the program specific information
+const (
+	TableIDPAT = 0x00
+	TableIDPMT = 0x02
+)
+
+// section returns the PSI section starting in the payload of a packet,
+// skipping the pointer field.
+func section(p Packet) []byte {
+	if !p.PayloadUnitStart() {
+		return nil
+	}
+	payload := p.Payload()
+	if len(payload) < 1 || 1+int(payload[0]) >= len(payload) {
+		return nil
+	}
+	s := payload[1+int(payload[0]):]
+	if len(s) < 3 {
+		return nil
+	}
+	length := int(s[1]&0x0f)<<8 | int(s[2])
+	if 3+length > len(s) {
+		// sections spanning several packets are not supported
+		return nil
+	}
+	return s[:3+length]
+}
+
+// ParsePAT returns the PMT PIDs by program number of a PAT packet.
+func ParsePAT(p Packet) (map[uint16]uint16, bool) {
+	s := section(p)
+	if len(s) < 12 || s[0] != TableIDPAT {
+		return nil, false
+	}
+	programs := map[uint16]uint16{}
+	for i := 8; i+4 <= len(s)-4; i += 4 {
+		number := uint16(s[i])<<8 | uint16(s[i+1])
+		pid := uint16(s[i+2]&0x1f)<<8 | uint16(s[i+3])
+		if number != 0 {
+			programs[number] = pid
+		}
+	}
+	return programs, true
+}
+
+// Tables keeps the latest PAT and PMT packets of the first program of a
+// stream, so that a cut of the stream can be made decodable on its own.
+type Tables struct {
+	pat    Packet
+	pmt    Packet
+	pmtPID uint16
+	parsed *PMT
+}
+
+// Update looks for the PAT and PMT in the packet.
+func (t *Tables) Update(p Packet) {
+	pid := p.PID()
+	switch {
+	case pid == PIDPAT:
+		programs, ok := ParsePAT(p)
+		if !ok || len(programs) == 0 {
+			return
+		}
+		first := uint16(0xffff)
+		for number := range programs {
+			if number < first {
+				first = number
+			}
+		}
+		t.pat = append(t.pat[:0], p...)
+		if t.pmtPID != programs[first] {
+			t.pmtPID, t.pmt, t.parsed = programs[first], nil, nil
+		}
+	case t.pmtPID != 0 && pid == t.pmtPID:
+		if pmt, ok := ParsePMT(p); ok {
+			t.pmt = append(t.pmt[:0], p...)
+			t.parsed = pmt
+		}
+	}
+}
+
+// to get the PID of the PMT, 0 until the PAT was seen
+func (t *Tables) PMTPID() uint16 {
+	return t.pmtPID
+}
+
+// to get the latest PMT, nil until it was seen
+func (t *Tables) PMT() *PMT {
+	return t.parsed
+}
+
+// Packets returns a copy of the PAT and PMT packets, nil until both are known.
+func (t *Tables) Packets() []byte {
+	if t.pat == nil || t.pmt == nil {
+		return nil
+	}
+	return append(append([]byte{}, t.pat...), t.pmt...)
+}
+
+// the stream types of the PMT
+const (
+	StreamTypeMPEG1Video = 0x01
+	StreamTypeMPEG2Video = 0x02
+	StreamTypeMPEG1Audio = 0x03
+	StreamTypeMPEG2Audio = 0x04
+	StreamTypePrivate    = 0x06
+	StreamTypeAAC        = 0x0f
+	StreamTypeH264       = 0x1b
+	StreamTypeHEVC       = 0x24
+	StreamTypeAC3        = 0x81
+)
+
+var codecNames = map[uint8]string{
+	StreamTypeMPEG1Video: "mpeg1video",
+	StreamTypeMPEG2Video: "mpeg2video",
+	StreamTypeMPEG1Audio: "mp2",
+	StreamTypeMPEG2Audio: "mp2",
+	StreamTypePrivate:    "private",
+	StreamTypeAAC:        "aac",
+	StreamTypeH264:       "h264",
+	StreamTypeHEVC:       "hevc",
+	StreamTypeAC3:        "ac3",
+}
+
+// CodecName returns a short name of the codec of a stream type.
+func CodecName(streamType uint8) string {
+	if name, ok := codecNames[streamType]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ElementaryStream is a stream listed in a PMT.
+type ElementaryStream struct {
+	PID        uint16
+	StreamType uint8
+}
+
+// PMT is a program map table.
+type PMT struct {
+	Program uint16
+	PCRPID  uint16
+	Streams []ElementaryStream
+}
+
+// ParsePMT parses the PMT starting in a packet.
+func ParsePMT(p Packet) (*PMT, bool) {
+	s := section(p)
+	if len(s) < 16 || s[0] != TableIDPMT {
+		return nil, false
+	}
+	pmt := &PMT{
+		Program: uint16(s[3])<<8 | uint16(s[4]),
+		PCRPID:  uint16(s[8]&0x1f)<<8 | uint16(s[9]),
+	}
+	i := 12 + (int(s[10]&0x0f)<<8 | int(s[11]))
+	for i+5 <= len(s)-4 {
+		pmt.Streams = append(pmt.Streams, ElementaryStream{
+			PID:        uint16(s[i+1]&0x1f)<<8 | uint16(s[i+2]),
+			StreamType: s[i],
+		})
+		i += 5 + (int(s[i+3]&0x0f)<<8 | int(s[i+4]))
+	}
+	return pmt, true
+}
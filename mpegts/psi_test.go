@@ -0,0 +1,105 @@
+package mpegts
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// tables returns the PAT and PMT packets written by a muxer.
+func tables(t *testing.T, streams ...ElementaryStream) (pat, pmt Packet) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewMuxer(&buf, streams...).WriteTables(); err != nil {
+		t.Fatal(err)
+	}
+	pkts := Packets(buf.Bytes())
+	if len(pkts) != 2 {
+		t.Fatalf("got %d packets, want 2", len(pkts))
+	}
+	return pkts[0], pkts[1]
+}
+
+func TestParsePAT(t *testing.T) {
+	pat, pmt := tables(t, ElementaryStream{PID: 0x100, StreamType: StreamTypeMPEG1Video})
+	truncated := append(Packet{}, pat...)
+	truncated[7] = 0xff // a section length past the packet
+
+	tests := []struct {
+		name string
+		p    Packet
+		want map[uint16]uint16
+		ok   bool
+	}{
+		{"muxer", pat, map[uint16]uint16{MuxProgram: MuxPMTPID}, true},
+		{"pmt", pmt, nil, false},
+		{"truncated", truncated, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParsePAT(tt.p)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParsePMT(t *testing.T) {
+	video := ElementaryStream{PID: 0x100, StreamType: StreamTypeMPEG1Video}
+	audio := ElementaryStream{PID: 0x101, StreamType: StreamTypeMPEG1Audio}
+
+	tests := []struct {
+		name    string
+		streams []ElementaryStream
+		pcr     uint16
+	}{
+		{"video", []ElementaryStream{video}, 0x100},
+		{"video and audio", []ElementaryStream{video, audio}, 0x100},
+		{"audio first", []ElementaryStream{audio, video}, 0x101},
+	}
+	for _, tt := range tests {
+		pat, p := tables(t, tt.streams...)
+		pmt, ok := ParsePMT(p)
+		if !ok {
+			t.Errorf("%v: not parsed", tt.name)
+			continue
+		}
+		if pmt.Program != MuxProgram || pmt.PCRPID != tt.pcr || !reflect.DeepEqual(pmt.Streams, tt.streams) {
+			t.Errorf("%v: got %+v", tt.name, pmt)
+		}
+		if _, ok := ParsePMT(pat); ok {
+			t.Errorf("%v: the PAT parsed as a PMT", tt.name)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	video := ElementaryStream{PID: 0x100, StreamType: StreamTypeMPEG1Video}
+	pat, pmt := tables(t, video)
+
+	var tab Tables
+	if tab.Packets() != nil || tab.PMT() != nil {
+		t.Fatal("tables known before any packet")
+	}
+	tab.Update(pmt)
+	if tab.PMT() != nil {
+		t.Fatal("the PMT was taken before the PAT")
+	}
+	tab.Update(pat)
+	if tab.PMTPID() != MuxPMTPID || tab.Packets() != nil {
+		t.Fatalf("got PMT PID %#x, packets %v after the PAT", tab.PMTPID(), tab.Packets() != nil)
+	}
+	tab.Update(pmt)
+	if got := tab.PMT(); got == nil || !reflect.DeepEqual(got.Streams, []ElementaryStream{video}) {
+		t.Fatalf("got PMT %+v", got)
+	}
+	if got, want := tab.Packets(), append(append([]byte{}, pat...), pmt...); !bytes.Equal(got, want) {
+		t.Fatal("the packets differ from the PAT and PMT")
+	}
+}
+
+func TestCRC32MPEG(t *testing.T) {
+	// the check value of CRC-32/MPEG-2
+	if got := crc32MPEG([]byte("123456789")); got != 0x0376e6e7 {
+		t.Fatalf("got %#x, want 0x376e6e7", got)
+	}
+}
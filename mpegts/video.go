@@ -0,0 +1,128 @@
+package mpegts
+
+import (
+	"bytes"
+)
+
+var frameRates = []float64{0, 24000.0 / 1001, 24, 25, 30000.0 / 1001, 30, 50, 60000.0 / 1001, 60}
+
+// the pel aspect ratios of MPEG-1, height/width of a pixel
+var aspectRatios = []string{
+	"", "1.0000 (square)", "0.6735", "0.7031 (16:9, 625 lines)", "0.7615", "0.8055",
+	"0.8437 (16:9, 525 lines)", "0.8935", "0.9157 (4:3, 625 lines)", "0.9815", "1.0255",
+	"1.0695", "1.0950 (4:3, 525 lines)", "1.1575", "1.2015",
+}
+
+// SequenceHeader holds the fields of an MPEG-1 video sequence header.
+type SequenceHeader struct {
+	Width       int
+	Height      int
+	AspectRatio string
+	FrameRate   float64
+	Bitrate     int  // bits/s, 0 when variable
+	MPEG2       bool // followed by a sequence extension
+}
+
+// ParseSequenceHeader looks for a sequence header in video data.
+func ParseSequenceHeader(es []byte) (*SequenceHeader, bool) {
+	i := bytes.Index(es, []byte{0, 0, 1, StartCodeSequence})
+	if i < 0 || i+11 > len(es) {
+		return nil, false
+	}
+	b := es[i+4:]
+	h := &SequenceHeader{
+		Width:  int(b[0])<<4 | int(b[1])>>4,
+		Height: int(b[1]&0x0f)<<8 | int(b[2]),
+	}
+	if aspect := int(b[3] >> 4); aspect < len(aspectRatios) {
+		h.AspectRatio = aspectRatios[aspect]
+	}
+	if rate := int(b[3] & 0x0f); rate < len(frameRates) {
+		h.FrameRate = frameRates[rate]
+	}
+	// 18 bits in units of 400 bits/s, all ones means variable
+	if rate := int(b[4])<<10 | int(b[5])<<2 | int(b[6])>>6; rate != 0x3ffff {
+		h.Bitrate = rate * 400
+	}
+	// the extension follows the header and its optional quantizer matrices
+	h.MPEG2 = bytes.Contains(es[i+4:], []byte{0, 0, 1, StartCodeExtension})
+	return h, true
+}
+
+// PictureType returns the coding type of the first picture in video data.
+func PictureType(es []byte) (int, bool) {
+	i := bytes.Index(es, []byte{0, 0, 1, StartCodePicture})
+	if i < 0 || i+6 > len(es) {
+		return 0, false
+	}
+	return int(es[i+5] >> 3 & 0x07), true
+}
+
+// Picture is a coded picture of video data, from its picture start code to
+// the next start code of a picture, GOP or sequence.
+type Picture struct {
+	Type int
+	Data []byte
+}
+
+// Pictures splits video data into its pictures.
+func Pictures(es []byte) []Picture {
+	var pictures []Picture
+	start := -1
+	for i := 0; i+4 <= len(es); i++ {
+		if es[i] != 0 || es[i+1] != 0 || es[i+2] != 1 {
+			continue
+		}
+		switch es[i+3] {
+		case StartCodePicture, StartCodeGOP, StartCodeSequence, StartCodeSeqEnd:
+			if start >= 0 {
+				pictures = append(pictures, newPicture(es[start:i]))
+				start = -1
+			}
+			if es[i+3] == StartCodePicture {
+				start = i
+			}
+		}
+		i += 2
+	}
+	if start >= 0 {
+		pictures = append(pictures, newPicture(es[start:]))
+	}
+	return pictures
+}
+
+func newPicture(data []byte) Picture {
+	p := Picture{Data: data}
+	if len(data) >= 6 {
+		p.Type = int(data[5] >> 3 & 0x07)
+	}
+	return p
+}
+
+// Slices returns the data of the picture following its header, which
+// changes between identical pictures.
+func (p Picture) Slices() []byte {
+	if len(p.Data) < 4 {
+		return nil
+	}
+	i := bytes.Index(p.Data[4:], []byte{0, 0, 1})
+	if i < 0 {
+		return nil
+	}
+	return p.Data[4+i:]
+}
+
+// SequenceHeaderData returns the sequence header of video data with its
+// quantizer matrices and extensions, up to the following GOP or picture.
+func SequenceHeaderData(es []byte) ([]byte, bool) {
+	i := bytes.Index(es, []byte{0, 0, 1, StartCodeSequence})
+	if i < 0 {
+		return nil, false
+	}
+	for j := i + 4; j+4 <= len(es); j++ {
+		if es[j] == 0 && es[j+1] == 0 && es[j+2] == 1 && (es[j+3] == StartCodeGOP || es[j+3] == StartCodePicture) {
+			return es[i:j], true
+		}
+	}
+	return es[i:], true
+}
@@ -0,0 +1,115 @@
+package mpegts
+
+import (
+	"bytes"
+	"testing"
+)
+
+// the sequence header of a 320x240 stream at 25 pictures/s and a
+// variable bitrate
+var sequence320 = []byte{0, 0, 1, StartCodeSequence, 0x14, 0x00, 0xf0, 0x13, 0xff, 0xff, 0xe0, 0x00}
+
+func picture(typ int) []byte {
+	return []byte{0, 0, 1, StartCodePicture, 0x00, byte(typ << 3), 0xff, 0xf8, 0, 0, 1, 0x01, 0x0a}
+}
+
+func TestParseSequenceHeader(t *testing.T) {
+	cbr := append([]byte{}, sequence320...)
+	cbr[8], cbr[9], cbr[10] = 0x00, 0x3e, 0xa0 // 250 * 400 bits/s, then the marker bit
+	ntsc := []byte{0, 0, 1, StartCodeSequence, 0x2d, 0x01, 0xe0, 0x64, 0xff, 0xff, 0xe0}
+
+	tests := []struct {
+		name string
+		es   []byte
+		want SequenceHeader
+		ok   bool
+	}{
+		{"variable bitrate", sequence320, SequenceHeader{Width: 320, Height: 240, AspectRatio: "1.0000 (square)", FrameRate: 25}, true},
+		{"constant bitrate", cbr, SequenceHeader{Width: 320, Height: 240, AspectRatio: "1.0000 (square)", FrameRate: 25, Bitrate: 100000}, true},
+		{"after a picture", append(picture(PictureP), ntsc...), SequenceHeader{Width: 720, Height: 480, AspectRatio: "0.8437 (16:9, 525 lines)", FrameRate: 30000.0 / 1001}, true},
+		{"MPEG-2", append(append([]byte{}, sequence320...), 0, 0, 1, StartCodeExtension, 0x14), SequenceHeader{Width: 320, Height: 240, AspectRatio: "1.0000 (square)", FrameRate: 25, MPEG2: true}, true},
+		{"truncated", sequence320[:10], SequenceHeader{}, false},
+		{"none", picture(PictureI), SequenceHeader{}, false},
+	}
+	for _, tt := range tests {
+		h, ok := ParseSequenceHeader(tt.es)
+		if ok != tt.ok || (ok && *h != tt.want) {
+			t.Errorf("%v: got %+v, %v, want %+v, %v", tt.name, h, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPictureType(t *testing.T) {
+	tests := []struct {
+		name string
+		es   []byte
+		want int
+		ok   bool
+	}{
+		{"I", picture(PictureI), PictureI, true},
+		{"P after a sequence header", append(append([]byte{}, sequence320...), picture(PictureP)...), PictureP, true},
+		{"B", picture(PictureB), PictureB, true},
+		{"truncated", picture(PictureI)[:5], 0, false},
+		{"none", sequence320, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := PictureType(tt.es); got != tt.want || ok != tt.ok {
+			t.Errorf("%v: got %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPictures(t *testing.T) {
+	gop := []byte{0, 0, 1, StartCodeGOP, 0x00, 0x08, 0x00, 0x40}
+	end := []byte{0, 0, 1, StartCodeSeqEnd}
+	cat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name  string
+		es    []byte
+		types []int
+	}{
+		{"none", sequence320, nil},
+		{"one", picture(PictureI), []int{PictureI}},
+		{"GOP", cat(sequence320, gop, picture(PictureI), picture(PictureP), picture(PictureB)), []int{PictureI, PictureP, PictureB}},
+		{"sequence end", cat(picture(PictureI), end, sequence320, picture(PictureP)), []int{PictureI, PictureP}},
+	}
+	for _, tt := range tests {
+		pictures := Pictures(tt.es)
+		if len(pictures) != len(tt.types) {
+			t.Errorf("%v: got %d pictures, want %d", tt.name, len(pictures), len(tt.types))
+			continue
+		}
+		for i, p := range pictures {
+			if p.Type != tt.types[i] || !bytes.Equal(p.Data, picture(tt.types[i])) {
+				t.Errorf("%v: picture %d is %v of %d bytes", tt.name, i, p.Type, len(p.Data))
+			}
+			if !bytes.Equal(p.Slices(), []byte{0, 0, 1, 0x01, 0x0a}) {
+				t.Errorf("%v: picture %d has slices %x", tt.name, i, p.Slices())
+			}
+		}
+	}
+}
+
+func TestSequenceHeaderData(t *testing.T) {
+	matrix := append(append([]byte{}, sequence320...), 0, 0, 1, StartCodeExtension, 0x14, 0x8a)
+	tests := []struct {
+		name string
+		es   []byte
+		want []byte
+		ok   bool
+	}{
+		{"before a picture", append(append([]byte{}, sequence320...), picture(PictureI)...), sequence320, true},
+		{"with an extension", append(append([]byte{}, matrix...), 0, 0, 1, StartCodeGOP, 0), matrix, true},
+		{"alone", sequence320, sequence320, true},
+		{"none", picture(PictureI), nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := SequenceHeaderData(tt.es)
+		if ok != tt.ok || !bytes.Equal(got, tt.want) {
+			t.Errorf("%v: got %x, %v, want %x, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
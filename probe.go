@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// ProbeReport describes what a viewer of a stream received during a probe,
+// durations are in milliseconds from the start of the probe.
+type ProbeReport struct {
+	URL              string            `json:"url"`
+	Connect          float64           `json:"connect_ms"`
+	FirstByte        float64           `json:"first_byte_ms"`
+	FirstKeyframe    float64           `json:"first_keyframe_ms"`
+	Duration         float64           `json:"duration_ms"`
+	Bytes            uint64            `json:"bytes"`
+	Packets          uint64            `json:"packets"`
+	Bitrate          int               `json:"bitrate"`
+	ContinuityErrors map[uint16]uint64 `json:"continuity_errors"`
+	Video            *mpegts.VideoInfo `json:"video,omitempty"`
+	Audio            *mpegts.AudioInfo `json:"audio,omitempty"`
+	Errors           []string          `json:"errors,omitempty"`
+}
+
+// probeCommand runs the probe subcommand, which plays a stream for a while
+// and exits non-zero when it is not watchable.
+func probeCommand(args []string) int {
+	fs := flag.NewFlagSet("probe", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsmpeg-relay probe ws://relay/play/app/key [-d DURATION] [-max-errors N] [-json]")
+		fs.PrintDefaults()
+	}
+	duration := fs.Duration("d", 5*time.Second, "the duration to play the stream for")
+	maxErrors := fs.Int("max-errors", 0, "the continuity errors tolerated, negative for any")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	url, err := parseURLArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if url == "" {
+		fs.Usage()
+		return 2
+	}
+
+	report := probe(url, *duration)
+	if *maxErrors >= 0 {
+		var total uint64
+		for _, n := range report.ContinuityErrors {
+			total += n
+		}
+		if total > uint64(*maxErrors) {
+			report.Errors = append(report.Errors, fmt.Sprintf("%d continuity errors", total))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printProbeReport(report)
+	}
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// probe plays a stream for a duration.
+func probe(url string, duration time.Duration) *ProbeReport {
+	report := &ProbeReport{URL: url, Connect: -1, FirstByte: -1, FirstKeyframe: -1, ContinuityErrors: map[uint16]uint64{}}
+	start := time.Now()
+	ms := func(t time.Time) float64 {
+		return float64(t.Sub(start)) / float64(time.Millisecond)
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = duration
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	defer conn.Close()
+	report.Connect = ms(time.Now())
+
+	analyzer := mpegts.NewAnalyzer()
+	aligner := &mpegts.Aligner{}
+	var continuity mpegts.ContinuityChecker
+	var firstByte time.Time
+	conn.SetReadDeadline(start.Add(duration))
+	for {
+		kind, data, err := conn.ReadMessage()
+		now := time.Now()
+		if err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); !ok || !ne.Timeout() {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			break
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		if firstByte.IsZero() {
+			firstByte = now
+			report.FirstByte = ms(now)
+		}
+		report.Bytes += uint64(len(data))
+		for _, pkt := range mpegts.Packets(aligner.Push(data)) {
+			report.Packets++
+			analyzer.Push(pkt, now)
+			if continuity.Check(pkt) {
+				report.ContinuityErrors[pkt.PID()]++
+			}
+			if report.FirstKeyframe < 0 && mpegts.IsKeyframe(pkt) {
+				report.FirstKeyframe = ms(now)
+			}
+		}
+	}
+
+	now := time.Now()
+	report.Duration = ms(now)
+	if elapsed := now.Sub(firstByte).Seconds(); !firstByte.IsZero() && elapsed > 0 {
+		report.Bitrate = int(float64(report.Bytes*8) / elapsed)
+	}
+	info := analyzer.Info(now)
+	report.Video, report.Audio = info.Video, info.Audio
+
+	switch {
+	case report.Bytes == 0:
+		report.Errors = append(report.Errors, "no data received")
+	case report.FirstKeyframe < 0:
+		report.Errors = append(report.Errors, "no keyframe received")
+	}
+	return report
+}
+
+func printProbeReport(r *ProbeReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	duration := func(v float64) string {
+		if v < 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0fms", v)
+	}
+	fmt.Fprintf(w, "url\t%v\n", r.URL)
+	fmt.Fprintf(w, "connect\t%v\n", duration(r.Connect))
+	fmt.Fprintf(w, "first byte\t%v\n", duration(r.FirstByte))
+	fmt.Fprintf(w, "first keyframe\t%v\n", duration(r.FirstKeyframe))
+	fmt.Fprintf(w, "received\t%d bytes, %d packets in %v\n", r.Bytes, r.Packets, duration(r.Duration))
+	fmt.Fprintf(w, "bitrate\t%.1f kbit/s\n", float64(r.Bitrate)/1000)
+	if v := r.Video; v != nil {
+		fmt.Fprintf(w, "video\t%v %dx%d %.2f fps, pid %d\n", v.Codec, v.Width, v.Height, v.FrameRate, v.PID)
+	}
+	if a := r.Audio; a != nil {
+		fmt.Fprintf(w, "audio\t%v %d Hz %v, pid %d\n", a.Codec, a.SampleRate, a.Mode, a.PID)
+	}
+
+	pids := make([]int, 0, len(r.ContinuityErrors))
+	for pid := range r.ContinuityErrors {
+		pids = append(pids, int(pid))
+	}
+	sort.Ints(pids)
+	errors := "none"
+	for i, pid := range pids {
+		if i == 0 {
+			errors = ""
+		} else {
+			errors += ", "
+		}
+		errors += fmt.Sprintf("%d on pid %d", r.ContinuityErrors[uint16(pid)], pid)
+	}
+	fmt.Fprintf(w, "continuity errors\t%v\n", errors)
+	for _, err := range r.Errors {
+		fmt.Fprintf(w, "error\t%v\n", err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// the number of packets read from the file at once
+const publishBatch = 64
+
+// publishCommand runs the publish subcommand, which sends a TS file to a
+// relay at real-time pace.
+func publishCommand(args []string) int {
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsmpeg-relay publish --file input.ts --url http://relay/publish/app/key [--loop]")
+		fs.PrintDefaults()
+	}
+	file := fs.String("file", "", "the MPEG-TS file to publish")
+	url := fs.String("url", "", "the publish URL of the topic")
+	loop := fs.Bool("loop", false, "publish the file again and again")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" || *url == "" {
+		fs.Usage()
+		return 2
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		err := paceFile(pw, f, *loop, interrupt)
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := http.Post(*url, "video/mp2t", pr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		fmt.Fprintf(os.Stderr, "error: %v: %v\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	return 0
+}
+
+// paceFile writes the packets of a file to w as the PCR tells, until its end
+// or an interrupt.
+func paceFile(w io.Writer, f *os.File, loop bool, interrupt <-chan os.Signal) error {
+	var pacer mpegts.Pacer
+	counters := continuityRewriter{}
+	aligner := &mpegts.Aligner{}
+	r := bufio.NewReaderSize(f, publishBatch*mpegts.PacketSize)
+	buf := make([]byte, publishBatch*mpegts.PacketSize)
+	looped := false // until the first PCR after the loop
+	for {
+		n, err := io.ReadFull(r, buf)
+		end := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !end {
+			return err
+		}
+
+		data := aligner.Push(buf[:n])
+		start := 0
+		for i, pkt := range mpegts.Packets(data) {
+			counters.rewrite(pkt)
+			if _, ok := pkt.PCR(); ok && looped {
+				// tells the players the time base goes back
+				looped = !pkt.SetDiscontinuity()
+			}
+			delay := pacer.Delay(pkt, time.Now())
+			if delay <= 0 {
+				continue
+			}
+			if _, err := w.Write(data[start : i*mpegts.PacketSize]); err != nil {
+				return err
+			}
+			start = i * mpegts.PacketSize
+			select {
+			case <-interrupt:
+				return nil
+			case <-time.After(delay):
+			}
+		}
+		if _, err := w.Write(data[start:]); err != nil {
+			return err
+		}
+
+		if end {
+			if !loop {
+				return nil
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			r.Reset(f)
+			// the PCR jumps back, which resets the pacer
+			counters.wrap()
+			looped = true
+		}
+	}
+}
+
+// continuityRewriter keeps the continuity counters going when a file loops,
+// so that players do not see the loop as lost packets.
+type continuityRewriter struct {
+	last   map[uint16]uint8
+	offset map[uint16]uint8
+}
+
+// wrap makes the next packet of each PID follow its last packet.
+func (c *continuityRewriter) wrap() {
+	c.offset = nil
+}
+
+func (c *continuityRewriter) rewrite(p mpegts.Packet) {
+	if p.PID() == mpegts.NullPID || !p.HasPayload() {
+		return
+	}
+	if c.last == nil {
+		c.last = map[uint16]uint8{}
+	}
+	if c.offset == nil {
+		c.offset = map[uint16]uint8{}
+	}
+	pid := p.PID()
+	offset, ok := c.offset[pid]
+	if !ok {
+		if last, seen := c.last[pid]; seen {
+			offset = (last + 1 - p.ContinuityCounter()) & 0x0f
+		}
+		c.offset[pid] = offset
+	}
+	cc := (p.ContinuityCounter() + offset) & 0x0f
+	p[3] = p[3]&0xf0 | cc
+	c.last[pid] = cc
+}
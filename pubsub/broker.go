@@ -3,30 +3,70 @@ package pubsub
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"sort"
 	"sync"
 	"time"
 )
 
+// the number of messages a subscriber may have pending before new ones are dropped
+const DefaultQueueSize = 256
+
+// the largest group of pictures cached per topic, in messages
+const DefaultGOPCacheSize = DefaultQueueSize / 2
+
+// Config sizes the queues of a broker.
+type Config struct {
+	QueueSize    int `json:"queue_size"`     // pending messages per subscriber
+	GOPCacheSize int `json:"gop_cache_size"` // cached messages per topic
+}
+
+// DefaultConfig is the config of NewBroker.
+var DefaultConfig = Config{QueueSize: DefaultQueueSize, GOPCacheSize: DefaultGOPCacheSize}
+
 // Pubsub Broker
 type Broker struct {
+	config      Config
 	subscribers Subscribers
 	slock       sync.RWMutex
 	topics      map[string]Subscribers
+	gops        map[string][]*Message
 	tlock       sync.RWMutex
 }
 
 // create new broker
 func NewBroker() *Broker {
+	return NewBrokerConfig(DefaultConfig)
+}
+
+// create a new broker sized by a config, the zero sizes being the default ones
+func NewBrokerConfig(config Config) *Broker {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.GOPCacheSize <= 0 {
+		config.GOPCacheSize = DefaultGOPCacheSize
+	}
 	return &Broker{
-		// subscribers: Subscribers{},
-		slock:  sync.RWMutex{},
-		topics: map[string]Subscribers{},
-		tlock:  sync.RWMutex{},
+		config:      config,
+		subscribers: Subscribers{},
+		slock:       sync.RWMutex{},
+		topics:      map[string]Subscribers{},
+		gops:        map[string][]*Message{},
+		tlock:       sync.RWMutex{},
 	}
 }
 
 // create a new subscriber and register it into the broker
 func (b *Broker) Attach() (*Subscriber, error) {
+	return b.AttachQueue(b.config.QueueSize, OverflowSkip)
+}
+
+// create a new subscriber like Attach, with its own queue size, the one of
+// the broker when not positive, and overflow policy
+func (b *Broker) AttachQueue(size int, overflow string) (*Subscriber, error) {
+	if size <= 0 {
+		size = b.config.QueueSize
+	}
 	b.slock.Lock()
 	defer b.slock.Unlock()
 	id := make([]byte, 50)
@@ -36,14 +76,14 @@ func (b *Broker) Attach() (*Subscriber, error) {
 
 	s := &Subscriber{
 		id:        hex.EncodeToString(id),
-		messages:  make(chan *Message, 1),
+		messages:  make(chan *Message, size),
+		overflow:  overflow,
 		createAt:  time.Now().UnixNano(),
 		destroyed: false,
-		//lock:      &sync.RWMutex{},
-		topics:  map[string]bool{},
-		closing: make(chan bool, 1),
+		topics:    map[string]bool{},
+		closing:   make(chan bool, 1),
 	}
-	// b.subscribers[s.id] = s
+	b.subscribers[s.id] = s
 	return s, nil
 }
 
@@ -51,11 +91,21 @@ func (b *Broker) Attach() (*Subscriber, error) {
 func (b *Broker) Detach(s *Subscriber) {
 	b.slock.Lock()
 	defer b.slock.Unlock()
-	b.Unsubscribe(s, s.GetTopics()...)
+	b.unsubscribeAll(s)
 	s.Destroy()
+	delete(b.subscribers, s.id)
 }
 
-// subscribes the specific subscriber "s" to the specific list of topic(s)
+// to get an attached subscriber by its id, nil when there is none
+func (b *Broker) GetSubscriber(id string) *Subscriber {
+	b.slock.RLock()
+	defer b.slock.RUnlock()
+	return b.subscribers[id]
+}
+
+// subscribes the specific subscriber "s" to the specific list of topic(s),
+// the cached group of pictures of a topic is sent first so that the
+// subscriber starts on a keyframe
 func (b *Broker) Subscribe(s *Subscriber, topics ...string) {
 	b.tlock.Lock()
 	defer b.tlock.Unlock()
@@ -65,6 +115,9 @@ func (b *Broker) Subscribe(s *Subscriber, topics ...string) {
 		}
 		s.topics[topic] = true
 		b.topics[topic][s.id] = s
+		for _, m := range b.gops[topic] {
+			s.signal(m, OverflowSkip)
+		}
 	}
 }
 
@@ -81,40 +134,131 @@ func (b *Broker) Unsubscribe(s *Subscriber, topics ...string) {
 	}
 }
 
-// broadcast the specific payload to all the topic(s) subscribers
+// unsubscribes the subscriber from all its topics, its topics are read
+// under the lock as its own goroutine may subscribe meanwhile
+func (b *Broker) unsubscribeAll(s *Subscriber) {
+	b.tlock.Lock()
+	defer b.tlock.Unlock()
+	for topic := range s.topics {
+		if nil != b.topics[topic] {
+			delete(b.topics[topic], s.id)
+		}
+		delete(s.topics, topic)
+	}
+}
+
+// broadcast the specific payload to all the topic(s) subscribers, every
+// subscriber receives the payloads in the order they were broadcasted
 func (b *Broker) Broadcast(data []byte, topics ...string) {
-	b.tlock.RLock()
-	defer b.tlock.RUnlock()
+	b.BroadcastFrame(data, false, topics...)
+}
+
+// broadcast the specific payload like Broadcast, a keyframe payload starts
+// a new group of pictures which is cached for the subscribers to come
+func (b *Broker) BroadcastFrame(data []byte, keyframe bool, topics ...string) {
+	b.tlock.Lock()
+	defer b.tlock.Unlock()
 	now := time.Now().UnixNano()
 	for _, topic := range topics {
-		if nil == b.topics[topic] {
-			continue
-		}
 		m := &Message{
 			topic:    topic,
 			data:     data,
 			createAt: now,
+			keyframe: keyframe,
 		}
+		b.cache(m)
 		for _, s := range b.topics[topic] {
-			go (func(s *Subscriber) {
-				select {
-				case <-s.Closing():
-					return
-				default:
-					s.Signal(m)
-				}
-				//s.Signal(m)
-			})(s)
-
-			// s.Signal(m)
+			s.Signal(m)
 		}
 	}
 }
 
+// cache must be called with the topics lock held.
+func (b *Broker) cache(m *Message) {
+	gop := b.gops[m.topic]
+	switch {
+	case m.keyframe:
+		gop = append(gop[:0], m)
+	case len(gop) == 0:
+		// no keyframe seen yet
+		return
+	case len(gop) >= b.config.GOPCacheSize:
+		// too large to be replayed, wait for the next keyframe
+		gop = gop[:0]
+	default:
+		gop = append(gop, m)
+	}
+	b.gops[m.topic] = gop
+}
+
+// forget the cached group of pictures of the topic(s), once their publisher is gone
+func (b *Broker) Reset(topics ...string) {
+	b.tlock.Lock()
+	defer b.tlock.Unlock()
+	for _, topic := range topics {
+		delete(b.gops, topic)
+	}
+}
+
 // get the subscribers count
 func (b *Broker) Subscribers(topic string) int {
 	b.tlock.RLock()
 	defer b.tlock.RUnlock()
 	return len(b.topics[topic])
-	return 0
+}
+
+// TopicStats describes a topic of the broker.
+type TopicStats struct {
+	Topic       string `json:"topic"`
+	Subscribers int    `json:"subscribers"`
+	GOPMessages int    `json:"gop_messages"`
+	GOPBytes    int    `json:"gop_bytes"`
+	Queued      int    `json:"queued"`
+	Dropped     uint64 `json:"dropped"`
+}
+
+// Stats describes the state of the broker.
+type Stats struct {
+	Subscribers int          `json:"subscribers"`
+	QueueSize   int          `json:"queue_size"`
+	GOPCache    int          `json:"gop_cache_size"`
+	Topics      []TopicStats `json:"topics"`
+}
+
+// get the state of the broker, topics ordered by name
+func (b *Broker) Stats() Stats {
+	b.slock.RLock()
+	stats := Stats{
+		Subscribers: len(b.subscribers),
+		QueueSize:   b.config.QueueSize,
+		GOPCache:    b.config.GOPCacheSize,
+		Topics:      []TopicStats{},
+	}
+	b.slock.RUnlock()
+
+	b.tlock.RLock()
+	defer b.tlock.RUnlock()
+	names := map[string]bool{}
+	for topic := range b.topics {
+		names[topic] = true
+	}
+	for topic := range b.gops {
+		names[topic] = true
+	}
+	for topic := range names {
+		if len(b.topics[topic]) == 0 && len(b.gops[topic]) == 0 {
+			continue
+		}
+		t := TopicStats{Topic: topic, Subscribers: len(b.topics[topic]), GOPMessages: len(b.gops[topic])}
+		for _, m := range b.gops[topic] {
+			t.GOPBytes += len(m.data)
+		}
+		for _, s := range b.topics[topic] {
+			t.Queued += s.QueueDepth()
+			t.Dropped += s.Dropped()
+		}
+		stats.Topics = append(stats.Topics, t)
+	}
+	sort.Slice(stats.Topics, func(i, j int) bool { return stats.Topics[i].Topic < stats.Topics[j].Topic })
+	return stats
 }
@@ -0,0 +1,222 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+// received returns the data of the messages queued for a subscriber.
+func received(s *Subscriber) []string {
+	var got []string
+	for {
+		select {
+		case m, ok := <-s.GetMessages():
+			if !ok {
+				return got
+			}
+			got = append(got, string(m.GetData()))
+		default:
+			return got
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBroadcast(t *testing.T) {
+	b := NewBroker()
+	s, err := b.Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := b.Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Subscribe(s, "live/news")
+	b.Subscribe(other, "live/sports")
+
+	for _, data := range []string{"a", "b", "c"} {
+		b.Broadcast([]byte(data), "live/news")
+	}
+	if got := received(s); !equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := received(other); len(got) != 0 {
+		t.Errorf("got %v on another topic", got)
+	}
+	if n := b.Subscribers("live/news"); n != 1 {
+		t.Errorf("got %v subscribers", n)
+	}
+
+	b.Unsubscribe(s, "live/news")
+	b.Broadcast([]byte("d"), "live/news")
+	if got := received(s); len(got) != 0 {
+		t.Errorf("got %v once unsubscribed", got)
+	}
+	b.Detach(other)
+	if b.GetSubscriber(other.GetID()) != nil {
+		t.Error("the subscriber detached is still attached")
+	}
+	if _, ok := <-other.GetMessages(); ok {
+		t.Error("the queue of a detached subscriber is open")
+	}
+}
+
+func TestGOPCache(t *testing.T) {
+	b := NewBrokerConfig(Config{QueueSize: 16, GOPCacheSize: 4})
+	frames := []struct {
+		data     string
+		keyframe bool
+	}{
+		{"p0", false}, // before the first keyframe, not cached
+		{"i1", true},
+		{"p1", false},
+		{"i2", true},
+		{"p2", false},
+		{"b2", false},
+	}
+	for _, f := range frames {
+		b.BroadcastFrame([]byte(f.data), f.keyframe, "live/news")
+	}
+
+	// a subscriber starts on the latest keyframe
+	s, _ := b.Attach()
+	b.Subscribe(s, "live/news")
+	if got := received(s); !equal(got, []string{"i2", "p2", "b2"}) {
+		t.Errorf("got %v", got)
+	}
+
+	// a group of pictures too large is not replayed
+	for _, data := range []string{"p3", "p4"} {
+		b.Broadcast([]byte(data), "live/news")
+	}
+	late, _ := b.Attach()
+	b.Subscribe(late, "live/news")
+	if got := received(late); len(got) != 0 {
+		t.Errorf("got %v replayed past the cache size", got)
+	}
+
+	// nor once the publisher is gone
+	b.BroadcastFrame([]byte("i5"), true, "live/news")
+	b.Reset("live/news")
+	reset, _ := b.Attach()
+	b.Subscribe(reset, "live/news")
+	if got := received(reset); len(got) != 0 {
+		t.Errorf("got %v replayed after a reset", got)
+	}
+}
+
+func TestOverflowSkip(t *testing.T) {
+	b := NewBrokerConfig(Config{QueueSize: 2})
+	s, _ := b.Attach()
+	b.Subscribe(s, "live/news")
+
+	// the queue full, the messages are dropped up to the next keyframe
+	frames := []struct {
+		data     string
+		keyframe bool
+	}{
+		{"i1", true},
+		{"p1", false},
+		{"p2", false}, // dropped, the queue is full
+	}
+	for _, f := range frames {
+		b.BroadcastFrame([]byte(f.data), f.keyframe, "live/news")
+	}
+	if got := received(s); !equal(got, []string{"i1", "p1"}) {
+		t.Errorf("got %v", got)
+	}
+	b.Broadcast([]byte("p3"), "live/news") // dropped, waiting for a keyframe
+	b.BroadcastFrame([]byte("i4"), true, "live/news")
+	b.Broadcast([]byte("p4"), "live/news")
+	if got := received(s); !equal(got, []string{"i4", "p4"}) {
+		t.Errorf("got %v after the overflow", got)
+	}
+	if n := s.Dropped(); n != 2 {
+		t.Errorf("got %v dropped, want 2", n)
+	}
+}
+
+func TestStats(t *testing.T) {
+	b := NewBrokerConfig(Config{QueueSize: 2, GOPCacheSize: 8})
+	s, _ := b.Attach()
+	other, _ := b.Attach()
+	b.Subscribe(s, "live/news")
+	b.Subscribe(other, "live/news", "live/sports")
+	b.BroadcastFrame([]byte("i1"), true, "live/news")
+	b.Broadcast([]byte("p1"), "live/news")
+	b.Broadcast([]byte("p2"), "live/news") // dropped by both
+	b.BroadcastFrame([]byte("i1"), true, "live/replay")
+	b.Unsubscribe(other, "live/sports")
+
+	stats := b.Stats()
+	if stats.Subscribers != 2 || stats.QueueSize != 2 || stats.GOPCache != 8 {
+		t.Errorf("got %+v", stats)
+	}
+	// the topics without subscribers nor cached pictures are left out
+	want := []TopicStats{
+		{Topic: "live/news", Subscribers: 2, GOPMessages: 3, GOPBytes: 6, Queued: 4, Dropped: 2},
+		{Topic: "live/replay", GOPMessages: 1, GOPBytes: 2},
+	}
+	if len(stats.Topics) != len(want) {
+		t.Fatalf("got topics %+v, want %+v", stats.Topics, want)
+	}
+	for i := range want {
+		if stats.Topics[i] != want[i] {
+			t.Errorf("got %+v, want %+v", stats.Topics[i], want[i])
+		}
+	}
+	if d := s.QueueDepth(); d != 2 {
+		t.Errorf("got queue depth %v", d)
+	}
+}
+
+func TestOverflowDisconnect(t *testing.T) {
+	b := NewBrokerConfig(Config{QueueSize: 16, GOPCacheSize: 8})
+	for _, data := range []string{"i1", "p1", "p2"} {
+		b.BroadcastFrame([]byte(data), data[0] == 'i', "live/news")
+	}
+
+	// the replay of the cache skips past the queue, whatever the policy
+	s, _ := b.AttachQueue(2, OverflowDisconnect)
+	b.Subscribe(s, "live/news")
+	select {
+	case <-s.Closing():
+		t.Fatal("disconnected by the replay of the cache")
+	default:
+	}
+	if got := received(s); !equal(got, []string{"i1", "p1"}) {
+		t.Errorf("got %v replayed", got)
+	}
+
+	// from the next keyframe, the subscriber is destroyed once its queue
+	// is full
+	b.BroadcastFrame([]byte("i3"), true, "live/news")
+	b.Broadcast([]byte("p3"), "live/news")
+	b.Broadcast([]byte("p4"), "live/news")
+	select {
+	case <-s.Closing():
+	default:
+		t.Fatal("not disconnected with its queue full")
+	}
+	if got := received(s); !equal(got, []string{"i3", "p3"}) {
+		t.Errorf("got %v before the disconnection", got)
+	}
+	if n := s.Dropped(); n != 2 {
+		t.Errorf("got %v dropped, want 2", n)
+	}
+	b.Broadcast([]byte("p6"), "live/news")
+	if n := s.Dropped(); n != 2 {
+		t.Errorf("got %v dropped once destroyed", n)
+	}
+}
@@ -4,6 +4,7 @@ type Message struct {
 	topic    string
 	data     []byte
 	createAt int64
+	keyframe bool
 }
 
 // to return the topic of the current message
@@ -20,3 +21,9 @@ func (m *Message) GetData() []byte {
 func (m *Message) GetCreatedAt() int64 {
 	return m.createAt
 }
+
+// to check whether the payload starts a group of pictures, a point where a
+// decoder can start
+func (m *Message) IsKeyframe() bool {
+	return m.keyframe
+}
@@ -1,19 +1,28 @@
 package pubsub
 
 import (
-//"sync"
+	"sync"
 )
 
 type Subscribers map[string]*Subscriber
 
+// the policies of a subscriber whose queue is full
+const (
+	OverflowSkip       = "skip"       // drop the messages up to the next keyframe
+	OverflowDisconnect = "disconnect" // destroy the subscriber
+)
+
 type Subscriber struct {
 	id        string
 	messages  chan *Message
 	createAt  int64
 	destroyed bool
-	//lock      *sync.RWMutex
-	topics  map[string]bool
-	closing chan bool
+	lock      sync.RWMutex
+	topics    map[string]bool
+	closing   chan bool
+	dropped   uint64
+	skipping  bool
+	overflow  string
 }
 
 // to get the subscriber id
@@ -35,47 +44,68 @@ func (s *Subscriber) GetMessages() <-chan *Message {
 	return s.messages
 }
 
-// to send a message to subscriber
+// to get the creation time of the subscriber in nanoseconds
+func (s *Subscriber) GetCreatedAt() int64 {
+	return s.createAt
+}
+
+// to get the number of messages waiting to be read
+func (s *Subscriber) QueueDepth() int {
+	return len(s.messages)
+}
+
+// to get the number of messages dropped because the queue was full
+func (s *Subscriber) Dropped() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.dropped
+}
+
+// to send a message to subscriber. A slow reader never blocks the others:
+// when the subscriber's queue is full, messages are dropped up to the next
+// keyframe so that the reader resumes on a decodable point, or the
+// subscriber is destroyed with the disconnect policy
 func (s *Subscriber) Signal(m *Message) *Subscriber {
-	// s.lock.RLock()
-	// defer s.lock.RUnlock()
-	defer func() {
-		// recoverint from panic caused by writing to a closed channel
-		if recover() == nil {
-			return
-		}
-	}()
-
-OK:
-	for {
-		select {
-		case <-s.closing:
-			break OK
-		case s.messages <- m:
-			break OK
-		default:
-		}
-		if s.destroyed {
-			break
-		}
+	return s.signal(m, s.overflow)
+}
+
+// signal sends a message with an overflow policy, the replay of the cached
+// group of pictures skips whatever the policy of the subscriber as its
+// queue may be shorter than the cache.
+func (s *Subscriber) signal(m *Message, overflow string) *Subscriber {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.destroyed {
+		return s
 	}
 
-	// if !s.destroyed {
-	// 	select {
-	// 	case <-s.closing:
-	// 		return s
-	// 	default:
-	// 		s.messages <- m
-	// 	}
-	// 	// s.messages <- m
-	// }
+	if s.skipping && !m.keyframe {
+		s.dropped++
+		return s
+	}
+	select {
+	case s.messages <- m:
+		s.skipping = false
+	default:
+		s.dropped++
+		if overflow == OverflowDisconnect {
+			s.destroy()
+			return s
+		}
+		s.skipping = true
+	}
 	return s
 }
 
 // to close the underlying channels/resources
 func (s *Subscriber) Destroy() {
-	// s.lock.Lock()
-	// defer s.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.destroy()
+}
+
+// destroy must be called with the lock held.
+func (s *Subscriber) destroy() {
 	if !s.destroyed {
 		s.destroyed = true
 		s.closing <- true
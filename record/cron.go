@@ -0,0 +1,127 @@
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec is a parsed five-field cron expression
+// (minute hour day-of-month month day-of-week). As in the standard cron,
+// a day matches either of the day fields when both are restricted, that is
+// when neither starts with "*".
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	anyDay                        bool // one of the day fields starts with "*"
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week, 0 is sunday
+}
+
+// parseCron parses expressions like "0 20 * * 1-5" or "*/15 * * * *".
+func parseCron(expr string) (*cronSpec, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: expected %d fields, got %d", expr, len(cronFields), len(parts))
+	}
+
+	bits := make([]uint64, len(cronFields))
+	for i, part := range parts {
+		b, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %v", expr, err)
+		}
+		bits[i] = b
+	}
+	return &cronSpec{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		anyDay: strings.HasPrefix(parts[2], "*") || strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseCronField handles lists of "*", "n", "a-b" with an optional "/step".
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", item)
+			}
+			rng, step = item[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", item)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", item)
+			}
+			lo, hi = n, n
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", item, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// match reports whether the minute containing t fires the expression.
+func (c *cronSpec) match(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	day := dom || dow
+	if c.anyDay {
+		day = dom && dow
+	}
+	return day &&
+		c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0
+}
+
+// last returns the latest firing minute in (t-within, t].
+func (c *cronSpec) last(t time.Time, within time.Duration) (time.Time, bool) {
+	m := t.Truncate(time.Minute)
+	for earliest := t.Add(-within); m.After(earliest); m = m.Add(-time.Minute) {
+		if c.match(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// next returns the first firing minute strictly after t, looking one year ahead.
+func (c *cronSpec) next(t time.Time) (time.Time, bool) {
+	m := t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(1, 0, 0); m.Before(limit); m = m.Add(time.Minute) {
+		if c.match(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
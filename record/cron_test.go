@@ -0,0 +1,105 @@
+package record
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		want *cronSpec
+		ok   bool
+	}{
+		{"* * * * *", &cronSpec{minute: 1<<60 - 1, hour: 1<<24 - 1, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1<<7 - 1, anyDay: true}, true},
+		{"0 20 * * 1-5", &cronSpec{minute: 1, hour: 1 << 20, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 0x3e, anyDay: true}, true},
+		{"*/15 0,12 1 1,7 0", &cronSpec{minute: 1 | 1<<15 | 1<<30 | 1<<45, hour: 1 | 1<<12, dom: 1 << 1, month: 1<<1 | 1<<7, dow: 1}, true},
+		{"10-20/5 * * * *", &cronSpec{minute: 1<<10 | 1<<15 | 1<<20, hour: 1<<24 - 1, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1<<7 - 1, anyDay: true}, true},
+		{"0 0 */2 * 1", &cronSpec{minute: 1, hour: 1, dom: 0xaaaaaaaa, month: 1<<13 - 2, dow: 1 << 1, anyDay: true}, true},
+		{"* * * *", nil, false},
+		{"* * * * * *", nil, false},
+		{"60 * * * *", nil, false},
+		{"* 24 * * *", nil, false},
+		{"* * 0 * *", nil, false},
+		{"* * * 13 *", nil, false},
+		{"* * * * 7", nil, false},
+		{"5-1 * * * *", nil, false},
+		{"*/0 * * * *", nil, false},
+		{"a * * * *", nil, false},
+		{"1-x * * * *", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseCron(tt.expr)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v", tt.expr, err)
+			continue
+		}
+		if tt.ok && *got != *tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.expr, *got, *tt.want)
+		}
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	// 2024-03-04 is a monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 30, 0, time.UTC)
+	}
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"0 20 * * 1-5", at(4, 20, 0), true},
+		{"0 20 * * 1-5", at(4, 20, 1), false},
+		{"0 20 * * 1-5", at(9, 20, 0), false}, // saturday
+		{"*/15 * * * *", at(4, 7, 45), true},
+		{"*/15 * * * *", at(4, 7, 44), false},
+		{"30 6 4 3 *", at(4, 6, 30), true},
+		{"30 6 4 4 *", at(4, 6, 30), false},
+		{"* * * * 0", at(10, 0, 0), true}, // sunday
+		{"0 0 1 * 1", at(1, 0, 0), true},  // the first, a friday
+		{"0 0 1 * 1", at(4, 0, 0), true},  // a monday
+		{"0 0 1 * 1", at(5, 0, 0), false},
+		{"0 0 */2 * 1", at(4, 0, 0), false}, // a monday but an even day
+		{"0 0 */2 * 1", at(11, 0, 0), true}, // a monday and an odd day
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.match(tt.t); got != tt.want {
+			t.Errorf("%q at %v: got %v, want %v", tt.expr, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestCronLastNext(t *testing.T) {
+	now := time.Date(2024, 3, 4, 20, 10, 30, 0, time.UTC) // a monday
+	tests := []struct {
+		expr   string
+		within time.Duration
+		last   time.Time
+		next   time.Time
+	}{
+		{"0 20 * * 1-5", time.Hour, time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 20, 0, 0, 0, time.UTC)},
+		{"0 20 * * 1-5", 10 * time.Minute, time.Time{}, time.Date(2024, 3, 5, 20, 0, 0, 0, time.UTC)},
+		{"10 20 * * *", time.Minute, time.Date(2024, 3, 4, 20, 10, 0, 0, time.UTC), time.Date(2024, 3, 5, 20, 10, 0, 0, time.UTC)},
+		{"*/15 * * * *", 30 * time.Minute, time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 20, 15, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Hour, time.Time{}, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Hour, time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last, ok := c.last(now, tt.within); !last.Equal(tt.last) || ok != !tt.last.IsZero() {
+			t.Errorf("%q within %v: got last %v, %v, want %v", tt.expr, tt.within, last, ok, tt.last)
+		}
+		if next, ok := c.next(now); !next.Equal(tt.next) || ok != !tt.next.IsZero() {
+			t.Errorf("%q: got next %v, %v, want %v", tt.expr, next, ok, tt.next)
+		}
+	}
+}
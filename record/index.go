@@ -0,0 +1,136 @@
+package record
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// IndexEntry locates a keyframe of a recording.
+type IndexEntry struct {
+	At     time.Time
+	Offset int64
+}
+
+// Index lists the keyframes of a recording in file order.
+type Index []IndexEntry
+
+// IndexPath returns the path of the keyframe index stored next to a recording.
+func IndexPath(path string) string {
+	return strings.TrimSuffix(path, ".ts") + ".idx"
+}
+
+// LoadIndex reads the keyframe index of a recording, rebuilding it from the
+// program clock reference when the recording has no index file.
+func LoadIndex(rec Recording) (Index, error) {
+	f, err := os.Open(IndexPath(rec.Path))
+	if os.IsNotExist(err) {
+		return buildIndex(rec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := Index{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var at, offset int64
+		if _, err := fmt.Sscan(scanner.Text(), &at, &offset); err != nil {
+			return nil, fmt.Errorf("%v: %v", IndexPath(rec.Path), err)
+		}
+		idx = append(idx, IndexEntry{At: time.Unix(0, at), Offset: offset})
+	}
+	return idx, scanner.Err()
+}
+
+// buildIndex scans the recording for keyframes, timing them by the PCR
+// relative to the start of the recording.
+func buildIndex(rec Recording) (Index, error) {
+	f, err := os.Open(rec.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := Index{}
+	r := bufio.NewReader(f)
+	pkt := make(mpegts.Packet, mpegts.PacketSize)
+	var offset, elapsed, last int64
+	started := false
+	for ; ; offset += mpegts.PacketSize {
+		if _, err := io.ReadFull(r, pkt); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return idx, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if pkt[0] != mpegts.SyncByte {
+			return nil, fmt.Errorf("%v: lost sync at %v", rec.Path, offset)
+		}
+
+		if pcr, ok := pkt.PCR(); ok {
+			if started && pcr >= last {
+				elapsed += pcr - last
+			}
+			started, last = true, pcr
+		}
+		if mpegts.IsKeyframe(pkt) {
+			at := rec.StartedAt.Add(mpegts.PCRDuration(elapsed))
+			idx = append(idx, IndexEntry{At: at, Offset: offset})
+		}
+	}
+}
+
+// Seek returns the latest keyframe at or before at, or the first one.
+func (idx Index) Seek(at time.Time) (IndexEntry, bool) {
+	if len(idx) == 0 {
+		return IndexEntry{}, false
+	}
+	i := sort.Search(len(idx), func(i int) bool { return idx[i].At.After(at) })
+	if i == 0 {
+		return idx[0], true
+	}
+	return idx[i-1], true
+}
+
+// indexWriter appends the keyframes of the data written to a recording.
+type indexWriter struct {
+	w      *bufio.Writer
+	file   *os.File
+	offset int64
+}
+
+func newIndexWriter(path string) (*indexWriter, error) {
+	file, err := os.OpenFile(IndexPath(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &indexWriter{w: bufio.NewWriter(file), file: file}, nil
+}
+
+// Write indexes aligned packets written to the recording at now.
+func (iw *indexWriter) Write(now time.Time, data []byte) error {
+	for _, pkt := range mpegts.Packets(data) {
+		if mpegts.IsKeyframe(pkt) {
+			if _, err := fmt.Fprintln(iw.w, now.UnixNano(), iw.offset); err != nil {
+				return err
+			}
+		}
+		iw.offset += mpegts.PacketSize
+	}
+	return iw.w.Flush()
+}
+
+func (iw *indexWriter) Close() error {
+	if err := iw.w.Flush(); err != nil {
+		iw.file.Close()
+		return err
+	}
+	return iw.file.Close()
+}
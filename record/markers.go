@@ -0,0 +1,140 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const markersFile = "markers.json"
+
+// Marker is a named point in time of a stream, like a chapter.
+type Marker struct {
+	ID        string    `json:"id"`
+	App       string    `json:"app"`
+	Key       string    `json:"key"`
+	Name      string    `json:"name"`
+	At        time.Time `json:"at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Markers stores the markers of every stream next to its recordings.
+type Markers struct {
+	sync.Mutex
+	dir string
+}
+
+// create a new marker store in the recordings directory
+func NewMarkers(dir string) *Markers {
+	return &Markers{dir: dir}
+}
+
+// Add drops a marker on a stream, at the current time when at is zero.
+func (m *Markers) Add(app, key, name string, at time.Time) (Marker, error) {
+	now := time.Now()
+	if at.IsZero() {
+		at = now
+	}
+	marker := Marker{ID: newID(), App: app, Key: key, Name: name, At: at, CreatedAt: now}
+	if name == "" {
+		return marker, errors.New("a marker requires a name")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	list, err := m.load(app, key)
+	if err != nil {
+		return marker, err
+	}
+	list = append(list, marker)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].At.Before(list[j].At) })
+	return marker, m.save(app, key, list)
+}
+
+// List returns the markers of a stream in time order.
+func (m *Markers) List(app, key string) ([]Marker, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.load(app, key)
+}
+
+// Find returns the marker with the given id, or the latest with that name.
+func (m *Markers) Find(app, key, ref string) (Marker, error) {
+	list, err := m.List(app, key)
+	if err != nil {
+		return Marker{}, err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].ID == ref || list[i].Name == ref {
+			return list[i], nil
+		}
+	}
+	return Marker{}, ErrNotFound
+}
+
+// Remove deletes a marker of a stream.
+func (m *Markers) Remove(app, key, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	list, err := m.load(app, key)
+	if err != nil {
+		return err
+	}
+	for i, marker := range list {
+		if marker.ID == id {
+			return m.save(app, key, append(list[:i], list[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+// path returns the markers file of a stream, the app and the key being
+// checked not to lead out of the directory.
+func (m *Markers) path(app, key string) (string, error) {
+	if err := ValidName(app); err != nil {
+		return "", err
+	}
+	if err := ValidName(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(m.dir, app, key, markersFile), nil
+}
+
+func (m *Markers) load(app, key string) ([]Marker, error) {
+	path, err := m.path(app, key)
+	if err != nil {
+		return nil, err
+	}
+	list := []Marker{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, json.Unmarshal(data, &list)
+}
+
+func (m *Markers) save(app, key string, list []Marker) error {
+	path, err := m.path(app, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,80 @@
+package record
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMarkers(t *testing.T) {
+	m := NewMarkers(t.TempDir())
+	start := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+
+	halftime, err := m.Add("live", "news", "halftime", start.Add(45*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kickoff, err := m.Add("live", "news", "kickoff", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Add("live", "news", "", start); err == nil {
+		t.Error("added a marker without a name")
+	}
+	if now, err := m.Add("live", "other", "now", time.Time{}); err != nil || now.At.IsZero() {
+		t.Errorf("got %v, %v for a marker at the current time", now.At, err)
+	}
+
+	// the markers are listed in time order, by stream
+	list, err := m.List("live", "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != kickoff.ID || list[1].ID != halftime.ID {
+		t.Fatalf("got %+v", list)
+	}
+
+	finds := []struct {
+		ref  string
+		want string
+		err  error
+	}{
+		{kickoff.ID, kickoff.ID, nil},
+		{"halftime", halftime.ID, nil},
+		{"now", "", ErrNotFound},
+	}
+	for _, tt := range finds {
+		got, err := m.Find("live", "news", tt.ref)
+		if err != tt.err || got.ID != tt.want {
+			t.Errorf("%v: got %v, %v, want %v, %v", tt.ref, got.ID, err, tt.want, tt.err)
+		}
+	}
+
+	// the markers are stored, a new store reads them back
+	if err := m.Remove("live", "news", kickoff.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove("live", "news", kickoff.ID); err != ErrNotFound {
+		t.Errorf("removed twice: got %v, want %v", err, ErrNotFound)
+	}
+	list, err = NewMarkers(m.dir).List("live", "news")
+	if err != nil || len(list) != 1 || list[0].ID != halftime.ID {
+		t.Errorf("got %+v, %v after a removal", list, err)
+	}
+}
+
+func TestMarkersInvalidName(t *testing.T) {
+	m := NewMarkers(t.TempDir())
+	names := [][2]string{{"..", "news"}, {"live", ".."}, {"live/..", "news"}, {"", "news"}}
+	for _, n := range names {
+		if _, err := m.Add(n[0], n[1], "kickoff", time.Time{}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%v/%v: got %v on add", n[0], n[1], err)
+		}
+		if _, err := m.List(n[0], n[1]); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%v/%v: got %v on list", n[0], n[1], err)
+		}
+		if err := m.Remove(n[0], n[1], "id"); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%v/%v: got %v on remove", n[0], n[1], err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+)
+
+// the states of a recording
+const (
+	StatusWaiting   = "waiting"   // the window is open but no data arrived yet
+	StatusRecording = "recording" // data is being written
+	StatusCompleted = "completed" // the window closed after some data was captured
+	StatusEmpty     = "empty"     // the window closed without any data
+	StatusFailed    = "failed"    // the recording could not be written
+)
+
+// QueueSize is the number of messages a recorder may have pending, much more
+// than a viewer as a disk may stall for a while.
+const QueueSize = 4096
+
+// Recording is an entry of the capture history.
+type Recording struct {
+	ID         string    `json:"id"`
+	ScheduleID string    `json:"schedule_id,omitempty"`
+	App        string    `json:"app"`
+	Key        string    `json:"key"`
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	OpenedAt   time.Time `json:"opened_at"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	Bytes      int64     `json:"bytes"`
+	Dropped    uint64    `json:"dropped"` // messages lost while the queue was full
+}
+
+// recorder writes the messages of a topic into a file, along with an index
+// of its keyframes, until stopped.
+type recorder struct {
+	sync.RWMutex
+	rec     Recording
+	file    *os.File
+	index   *indexWriter
+	sub     *pubsub.Subscriber
+	stop    chan bool
+	done    chan bool
+	updated func(Recording)
+}
+
+// startRecorder subscribes to the topic of the recording and starts
+// writing, a publisher that is absent is simply waited for.
+func startRecorder(broker *pubsub.Broker, rec Recording, updated func(Recording)) (*recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(rec.Path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(rec.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := newIndexWriter(rec.Path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	sub, err := broker.AttachQueue(QueueSize, pubsub.OverflowSkip)
+	if err != nil {
+		file.Close()
+		index.Close()
+		return nil, err
+	}
+	broker.Subscribe(sub, rec.App+"/"+rec.Key)
+
+	r := &recorder{
+		rec:     rec,
+		file:    file,
+		index:   index,
+		sub:     sub,
+		stop:    make(chan bool, 1),
+		done:    make(chan bool),
+		updated: updated,
+	}
+	go r.run(broker)
+	return r, nil
+}
+
+func (r *recorder) run(broker *pubsub.Broker) {
+	defer func() {
+		broker.Detach(r.sub)
+		if err := r.file.Close(); err != nil {
+			r.fail(err)
+		}
+		if err := r.index.Close(); err != nil {
+			r.fail(err)
+		}
+		r.finish()
+		close(r.done)
+	}()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.sub.Closing():
+			return
+		case msg, ok := <-r.sub.GetMessages():
+			if !ok {
+				return
+			}
+			data := msg.GetData()
+			n, err := r.file.Write(data)
+			r.wrote(n)
+			if err == nil {
+				err = r.index.Write(time.Now(), data)
+			}
+			if err != nil {
+				r.fail(err)
+				return
+			}
+		}
+	}
+}
+
+func (r *recorder) wrote(n int) {
+	r.Lock()
+	first := r.rec.Status == StatusWaiting
+	if first {
+		r.rec.Status = StatusRecording
+		r.rec.StartedAt = time.Now()
+	}
+	r.rec.Bytes += int64(n)
+	rec := r.rec
+	r.Unlock()
+
+	if first {
+		logging.Infof("[record] %v: first data for %v/%v", rec.ID, rec.App, rec.Key)
+		r.updated(rec)
+	}
+}
+
+func (r *recorder) fail(err error) {
+	logging.Errorf("[record] %v: %v", r.rec.ID, err)
+	r.Lock()
+	r.rec.Status = StatusFailed
+	r.rec.Error = err.Error()
+	r.Unlock()
+}
+
+func (r *recorder) finish() {
+	r.Lock()
+	r.rec.EndedAt = time.Now()
+	r.rec.Dropped = r.sub.Dropped()
+	switch r.rec.Status {
+	case StatusWaiting:
+		r.rec.Status = StatusEmpty
+	case StatusRecording:
+		r.rec.Status = StatusCompleted
+	}
+	rec := r.rec
+	r.Unlock()
+	logging.Infof("[record] %v: %v, %v bytes captured", rec.ID, rec.Status, rec.Bytes)
+	if rec.Dropped > 0 {
+		logging.Warningf("[record] %v: %v messages dropped while the disk was busy", rec.ID, rec.Dropped)
+	}
+	r.updated(rec)
+}
+
+// to get a snapshot of the recording
+func (r *recorder) recording() Recording {
+	r.RLock()
+	rec := r.rec
+	r.RUnlock()
+	rec.Dropped = r.sub.Dropped()
+	return rec
+}
+
+// Close stops the recorder and waits until the file is closed.
+func (r *recorder) Close() {
+	select {
+	case r.stop <- true:
+	default:
+	}
+	<-r.done
+}
@@ -0,0 +1,123 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that is (un)marshaled as a string like "90m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Schedule describes when a stream should be recorded, either as a single
+// window between Start and End or as a cron expression opening a window of
+// Duration every time it fires.
+type Schedule struct {
+	ID       string    `json:"id"`
+	App      string    `json:"app"`
+	Key      string    `json:"key"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Cron     string    `json:"cron,omitempty"`
+	Duration Duration  `json:"duration,omitempty"`
+
+	cron *cronSpec
+}
+
+// to get the broker topic of the scheduled stream
+func (s *Schedule) Topic() string {
+	return s.App + "/" + s.Key
+}
+
+// Validate checks the schedule and prepares its cron expression.
+func (s *Schedule) Validate() error {
+	if s.App == "" || s.Key == "" {
+		return errors.New("app and key are required")
+	}
+	if err := ValidName(s.App); err != nil {
+		return fmt.Errorf("invalid app: %v", err)
+	}
+	if err := ValidName(s.Key); err != nil {
+		return fmt.Errorf("invalid key: %v", err)
+	}
+
+	if s.Cron != "" {
+		if s.Duration <= 0 {
+			return errors.New("a cron schedule requires a positive duration")
+		}
+		spec, err := parseCron(s.Cron)
+		if err != nil {
+			return err
+		}
+		s.cron = spec
+		return nil
+	}
+
+	if s.Start.IsZero() || s.End.IsZero() {
+		return errors.New("either cron or start and end are required")
+	}
+	if !s.End.After(s.Start) {
+		return errors.New("end must be after start")
+	}
+	return nil
+}
+
+// ValidName checks an app name or a stream key is a single path segment,
+// as the recordings are stored under app/key in the directory.
+func ValidName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("%q is %w", name, ErrInvalidName)
+	}
+	return nil
+}
+
+// Window returns the recording window containing now, if any.
+func (s *Schedule) Window(now time.Time) (start, end time.Time, open bool) {
+	if s.cron != nil {
+		d := time.Duration(s.Duration)
+		if start, ok := s.cron.last(now, d); ok {
+			return start, start.Add(d), true
+		}
+		return time.Time{}, time.Time{}, false
+	}
+
+	if !now.Before(s.Start) && now.Before(s.End) {
+		return s.Start, s.End, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// Expired reports whether a one-shot schedule will never open again.
+func (s *Schedule) Expired(now time.Time) bool {
+	return s.cron == nil && !now.Before(s.End)
+}
+
+// Next returns the start of the next window opening after now.
+func (s *Schedule) Next(now time.Time) (time.Time, bool) {
+	if s.cron != nil {
+		return s.cron.next(now)
+	}
+	if now.Before(s.Start) {
+		return s.Start, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,95 @@
+package record
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"live", true},
+		{"news-1.hd", true},
+		{"..foo", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{"../live", false},
+		{`a\b`, false},
+		{"a\x00", false},
+	}
+	for _, tt := range tests {
+		if err := ValidName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v", tt.name, err)
+		}
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	start := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		s    Schedule
+		ok   bool
+	}{
+		{"window", Schedule{App: "live", Key: "news", Start: start, End: start.Add(time.Hour)}, true},
+		{"cron", Schedule{App: "live", Key: "news", Cron: "0 20 * * 1-5", Duration: Duration(time.Hour)}, true},
+		{"no app", Schedule{Key: "news", Start: start, End: start.Add(time.Hour)}, false},
+		{"no key", Schedule{App: "live", Start: start, End: start.Add(time.Hour)}, false},
+		{"app escaping", Schedule{App: "..", Key: "news", Start: start, End: start.Add(time.Hour)}, false},
+		{"key escaping", Schedule{App: "live", Key: "../../etc", Start: start, End: start.Add(time.Hour)}, false},
+		{"no window", Schedule{App: "live", Key: "news"}, false},
+		{"no end", Schedule{App: "live", Key: "news", Start: start}, false},
+		{"end before start", Schedule{App: "live", Key: "news", Start: start, End: start}, false},
+		{"cron without duration", Schedule{App: "live", Key: "news", Cron: "0 20 * * *"}, false},
+		{"invalid cron", Schedule{App: "live", Key: "news", Cron: "0 25 * * *", Duration: Duration(time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.s.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%v: got error %v", tt.name, err)
+		}
+	}
+}
+
+func TestScheduleWindow(t *testing.T) {
+	start := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC) // a monday
+	once := Schedule{App: "live", Key: "news", Start: start, End: start.Add(time.Hour)}
+	daily := Schedule{App: "live", Key: "news", Cron: "0 20 * * 1-5", Duration: Duration(time.Hour)}
+	for _, s := range []*Schedule{&once, &daily} {
+		if err := s.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		s     *Schedule
+		now   time.Time
+		open  bool
+		start time.Time
+		next  time.Time
+	}{
+		{"before the window", &once, start.Add(-time.Minute), false, time.Time{}, start},
+		{"in the window", &once, start.Add(30 * time.Minute), true, start, time.Time{}},
+		{"at the end", &once, start.Add(time.Hour), false, time.Time{}, time.Time{}},
+		{"cron before", &daily, start.Add(-time.Minute), false, time.Time{}, start},
+		{"cron in the window", &daily, start.Add(59 * time.Minute), true, start, start.AddDate(0, 0, 1)},
+		{"cron after", &daily, start.Add(time.Hour), false, time.Time{}, start.AddDate(0, 0, 1)},
+		{"cron on friday", &daily, start.AddDate(0, 0, 4).Add(time.Hour), false, time.Time{}, start.AddDate(0, 0, 7)},
+	}
+	for _, tt := range tests {
+		from, to, open := tt.s.Window(tt.now)
+		if open != tt.open || !from.Equal(tt.start) || (open && !to.Equal(from.Add(time.Hour))) {
+			t.Errorf("%v: got window %v to %v, %v", tt.name, from, to, open)
+		}
+		if next, ok := tt.s.Next(tt.now); !next.Equal(tt.next) || ok != !tt.next.IsZero() {
+			t.Errorf("%v: got next %v, %v, want %v", tt.name, next, ok, tt.next)
+		}
+	}
+	if once.Expired(start.Add(30*time.Minute)) || !once.Expired(start.Add(time.Hour)) || daily.Expired(start.AddDate(1, 0, 0)) {
+		t.Error("wrong expiration")
+	}
+}
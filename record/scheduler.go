@@ -0,0 +1,359 @@
+package record
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/utils"
+)
+
+const (
+	schedulesFile  = "schedules.json"
+	recordingsFile = "recordings.json"
+	checkInterval  = time.Second
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrInvalidName = errors.New("not a single path segment")
+)
+
+// Scheduler opens and closes recordings according to the schedules and
+// keeps the history of what was captured, both persisted in its directory.
+type Scheduler struct {
+	sync.Mutex
+	dir        string
+	broker     *pubsub.Broker
+	schedules  map[string]*Schedule
+	recordings []Recording
+	active     map[string]*recorder // by schedule id, or recording id outside of the schedules
+	failed     map[string]time.Time // the start of the window which failed to record, by schedule id
+	closing    chan bool
+}
+
+// NewScheduler loads the schedules and the history stored in dir.
+func NewScheduler(broker *pubsub.Broker, dir string) (*Scheduler, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		dir:       dir,
+		broker:    broker,
+		schedules: map[string]*Schedule{},
+		active:    map[string]*recorder{},
+		failed:    map[string]time.Time{},
+		closing:   make(chan bool, 1),
+	}
+
+	var schedules []*Schedule
+	if err := s.load(schedulesFile, &schedules); err != nil {
+		return nil, err
+	}
+	for _, sched := range schedules {
+		if err := sched.Validate(); err != nil {
+			logging.Warningf("[record] skip invalid schedule %v: %v", sched.ID, err)
+			continue
+		}
+		s.schedules[sched.ID] = sched
+	}
+	if err := s.load(recordingsFile, &s.recordings); err != nil {
+		return nil, err
+	}
+	// recordings left open by a previous run were interrupted
+	for i := range s.recordings {
+		switch s.recordings[i].Status {
+		case StatusWaiting, StatusRecording:
+			s.recordings[i].Status = StatusFailed
+			s.recordings[i].Error = "interrupted"
+		}
+	}
+	return s, nil
+}
+
+// Run starts checking the schedules periodically until Close is called.
+func (s *Scheduler) Run() {
+	utils.Repeat(s.check, checkInterval, s.closing)
+}
+
+// Close stops all the active recordings and persists the history.
+func (s *Scheduler) Close() {
+	s.closing <- true
+
+	s.Lock()
+	active := s.active
+	s.active = map[string]*recorder{}
+	s.Unlock()
+
+	for _, r := range active {
+		r.Close()
+	}
+}
+
+func (s *Scheduler) check() {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+
+	for id, sched := range s.schedules {
+		r := s.active[id]
+		start, end, open := sched.Window(now)
+		switch {
+		case open && r == nil:
+			// a window which failed is not retried every check
+			if failed, ok := s.failed[id]; ok && failed.Equal(start) {
+				break
+			}
+			if err := s.start(sched, now, end); err != nil {
+				s.failed[id] = start
+			}
+		case !open && r != nil:
+			delete(s.active, id)
+			go r.Close()
+		}
+		if !open {
+			delete(s.failed, id)
+		}
+		if !open && sched.Expired(now) {
+			logging.Infof("[record] schedule %v expired", id)
+			delete(s.schedules, id)
+			s.saveSchedules()
+		}
+	}
+}
+
+// start must be called with the lock held.
+func (s *Scheduler) start(sched *Schedule, now, end time.Time) error {
+	r, _, err := s.record(sched.App, sched.Key, sched.ID, now)
+	if err != nil {
+		logging.Errorf("[record] schedule %v: %v", sched.ID, err)
+		return err
+	}
+	s.active[sched.ID] = r
+	logging.Infof("[record] schedule %v: recording %v/%v until %v", sched.ID, sched.App, sched.Key, end)
+	return nil
+}
+
+// record starts a recorder and adds its recording to the history, it must
+// be called with the lock held.
+func (s *Scheduler) record(app, key, scheduleID string, now time.Time) (*recorder, Recording, error) {
+	rec := Recording{
+		ID:         newID(),
+		ScheduleID: scheduleID,
+		App:        app,
+		Key:        key,
+		Status:     StatusWaiting,
+		OpenedAt:   now,
+	}
+	rec.Path = filepath.Join(s.dir, app, key, now.Format("20060102-150405")+"-"+rec.ID+".ts")
+
+	var r *recorder
+	err := ValidName(app)
+	if err == nil {
+		err = ValidName(key)
+	}
+	if err == nil {
+		err = s.inside(rec.Path)
+	}
+	if err == nil {
+		r, err = startRecorder(s.broker, rec, s.update)
+	}
+	if err != nil {
+		rec.Status = StatusFailed
+		rec.Error = err.Error()
+		rec.EndedAt = now
+	}
+	s.recordings = append(s.recordings, rec)
+	s.saveRecordings()
+	return r, rec, err
+}
+
+// inside checks a path is within the directory of the scheduler.
+func (s *Scheduler) inside(path string) error {
+	rel, err := filepath.Rel(s.dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%v is outside of %v", path, s.dir)
+	}
+	return nil
+}
+
+// Record starts recording a topic at once, outside of the schedules, until
+// Stop is called with the id of the recording.
+func (s *Scheduler) Record(app, key string) (Recording, error) {
+	s.Lock()
+	defer s.Unlock()
+	r, rec, err := s.record(app, key, "", time.Now())
+	if err != nil {
+		return rec, err
+	}
+	s.active[rec.ID] = r
+	logging.Infof("[record] recording %v/%v", app, key)
+	return rec, nil
+}
+
+// Stop stops a recording started by Record.
+func (s *Scheduler) Stop(id string) error {
+	s.Lock()
+	r, ok := s.active[id]
+	delete(s.active, id)
+	s.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	r.Close()
+	return nil
+}
+
+// update replaces the history entry of a recording.
+func (s *Scheduler) update(rec Recording) {
+	s.Lock()
+	defer s.Unlock()
+	for i := range s.recordings {
+		if s.recordings[i].ID == rec.ID {
+			s.recordings[i] = rec
+		}
+	}
+	s.saveRecordings()
+}
+
+// AddSchedule validates, stores and persists a new schedule.
+func (s *Scheduler) AddSchedule(sched Schedule) (Schedule, error) {
+	sched.ID = newID()
+	if err := sched.Validate(); err != nil {
+		return sched, err
+	}
+	if sched.Expired(time.Now()) {
+		return sched, errors.New("the schedule window is already over")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.schedules[sched.ID] = &sched
+	return sched, s.saveSchedules()
+}
+
+// RemoveSchedule deletes a schedule, stopping its recording if one is active.
+func (s *Scheduler) RemoveSchedule(id string) error {
+	s.Lock()
+	if _, ok := s.schedules[id]; !ok {
+		s.Unlock()
+		return ErrNotFound
+	}
+	delete(s.schedules, id)
+	r := s.active[id]
+	delete(s.active, id)
+	err := s.saveSchedules()
+	s.Unlock()
+
+	if r != nil {
+		r.Close()
+	}
+	return err
+}
+
+// Schedules returns the schedules ordered by id.
+func (s *Scheduler) Schedules() []Schedule {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		list = append(list, *sched)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Recordings returns the capture history, oldest first.
+func (s *Scheduler) Recordings() []Recording {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Recording, len(s.recordings))
+	copy(list, s.recordings)
+	for i := range list {
+		if r, ok := s.activeRecording(list[i].ID); ok {
+			list[i] = r
+		}
+	}
+	return list
+}
+
+// Recording returns a single entry of the capture history.
+func (s *Scheduler) Recording(id string) (Recording, error) {
+	s.Lock()
+	defer s.Unlock()
+	if r, ok := s.activeRecording(id); ok {
+		return r, nil
+	}
+	for _, rec := range s.recordings {
+		if rec.ID == id {
+			return rec, nil
+		}
+	}
+	return Recording{}, ErrNotFound
+}
+
+// activeRecording must be called with the lock held.
+func (s *Scheduler) activeRecording(id string) (Recording, bool) {
+	for _, r := range s.active {
+		if rec := r.recording(); rec.ID == id {
+			return rec, true
+		}
+	}
+	return Recording{}, false
+}
+
+func (s *Scheduler) load(name string, v interface{}) error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// save writes the file atomically so a crash never leaves it truncated.
+func (s *Scheduler) save(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, name)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		logging.Error("[record] save error: ", err)
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *Scheduler) saveSchedules() error {
+	list := make([]*Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		list = append(list, sched)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return s.save(schedulesFile, list)
+}
+
+func (s *Scheduler) saveRecordings() error {
+	return s.save(recordingsFile, s.recordings)
+}
+
+func newID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
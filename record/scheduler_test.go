@@ -0,0 +1,107 @@
+package record
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+)
+
+func TestRecord(t *testing.T) {
+	broker := pubsub.NewBroker()
+	s, err := NewScheduler(broker, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := s.Record("live", "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != StatusWaiting {
+		t.Fatalf("got status %v before any data", rec.Status)
+	}
+
+	data := bytes.Repeat([]byte{0x47, 0x01, 0x00, 0x10}, 47)
+	for i := 0; i < 10; i++ {
+		broker.Broadcast(data, "live/news")
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if rec, _ = s.Recording(rec.ID); rec.Bytes == int64(10*len(data)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d bytes recorded", rec.Bytes)
+		}
+	}
+	if rec.Status != StatusRecording {
+		t.Fatalf("got status %v while recording", rec.Status)
+	}
+
+	if err := s.Stop(rec.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop(rec.ID); err != ErrNotFound {
+		t.Fatalf("stopped twice: %v", err)
+	}
+	rec, err = s.Recording(rec.ID)
+	if err != nil || rec.Status != StatusCompleted || rec.Dropped != 0 {
+		t.Fatalf("got %+v, %v", rec, err)
+	}
+	written, err := ioutil.ReadFile(rec.Path)
+	if err != nil || !bytes.Equal(written, bytes.Repeat(data, 10)) {
+		t.Fatalf("got %d bytes written, %v", len(written), err)
+	}
+}
+
+func TestRecordInvalidName(t *testing.T) {
+	s, err := NewScheduler(pubsub.NewBroker(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"..", "a/../../b", ""} {
+		rec, err := s.Record("live", key)
+		if err == nil {
+			s.Stop(rec.ID)
+			t.Errorf("%q: recorded to %v", key, rec.Path)
+			continue
+		}
+		if rec.Status != StatusFailed {
+			t.Errorf("%q: got status %v", key, rec.Status)
+		}
+	}
+	if n := len(s.Recordings()); n != 3 {
+		t.Fatalf("got %d recordings in the history, want 3", n)
+	}
+}
+
+func TestReloadInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewScheduler(pubsub.NewBroker(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched, err := s.AddSchedule(Schedule{App: "live", Key: "news", Cron: "0 20 * * *", Duration: Duration(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := s.Record("live", "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second scheduler reads the state as left by a crash of the first
+	reloaded, err := NewScheduler(pubsub.NewBroker(), dir)
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := reloaded.Schedules(); len(list) != 1 || list[0].ID != sched.ID {
+		t.Errorf("got schedules %+v", list)
+	}
+	if got, err := reloaded.Recording(rec.ID); err != nil || got.Status != StatusFailed || got.Error != "interrupted" {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
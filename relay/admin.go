@@ -0,0 +1,182 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+var (
+	errAdminDisabled = errors.New("admin API disabled, start the relay with -admin-token")
+	errUnauthorized  = errors.New("unauthorized")
+	errNoViewer      = errors.New("no such viewer")
+)
+
+// adminAuth lets the requests with the admin token through.
+func (s *Server) adminAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.AdminToken == "" {
+			writeError(w, http.StatusForbidden, errAdminDisabled)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="jsmpeg-relay"`)
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// countedViewer counts the bytes written to a viewer.
+type countedViewer struct {
+	viewer
+	client *streams.Viewer
+}
+
+func (c countedViewer) Write(b []byte) (int, error) {
+	n, err := c.viewer.Write(b)
+	c.client.Write(b[:n])
+	return n, err
+}
+
+// kickHTTP disconnects an HTTP viewer, even blocked on a write.
+func (s *Server) kickHTTP(w http.ResponseWriter, subscriber *pubsub.Subscriber) func() {
+	return func() {
+		http.NewResponseController(w).SetWriteDeadline(time.Now())
+		s.broker.Detach(subscriber)
+	}
+}
+
+// terminateOnRequest stops reading from the publisher of a stream once it
+// is terminated, until the request is done.
+func terminateOnRequest(w http.ResponseWriter, r *http.Request, stream *streams.Stream) {
+	select {
+	case <-stream.Terminated():
+		http.NewResponseController(w).SetReadDeadline(time.Now())
+	case <-r.Context().Done():
+	}
+}
+
+// TopicStatus describes a topic for the admin API.
+type TopicStatus struct {
+	pubsub.TopicStats
+	Live       bool      `json:"live"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	Private    bool      `json:"private"`
+	State      string    `json:"state,omitempty"`
+	Bitrate    int       `json:"bitrate"`
+	Viewers    int       `json:"viewers"`
+}
+
+func (s *Server) adminTopicsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := s.broker.Stats()
+	known := map[string]bool{}
+	topics := []TopicStatus{}
+	for _, t := range stats.Topics {
+		known[t.Topic] = true
+		topics = append(topics, s.topicStatus(t))
+	}
+	// the streams nobody subscribed to yet
+	for _, stream := range s.registry.List() {
+		if !known[stream.Topic()] {
+			topics = append(topics, s.topicStatus(pubsub.TopicStats{Topic: stream.Topic()}))
+		}
+	}
+	writeJSON(w, http.StatusOK, topics)
+}
+
+func (s *Server) topicStatus(t pubsub.TopicStats) TopicStatus {
+	status := TopicStatus{TopicStats: t}
+	if i := strings.Index(t.Topic, "/"); i >= 0 {
+		app, key := t.Topic[:i], t.Topic[i+1:]
+		if stream := s.registry.Get(app, key); stream != nil {
+			st := stream.Status()
+			status.Live, status.RemoteAddr, status.StartedAt = true, st.RemoteAddr, st.StartedAt
+			status.Private, status.State, status.Bitrate = st.Private, st.Health.State, st.Info.Bitrate
+		}
+		status.Viewers = len(s.registry.Viewers(app, key))
+	}
+	return status
+}
+
+func (s *Server) adminViewersHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	viewers := s.registry.AllViewers()
+	if app, key := vars["app_name"], vars["stream_key"]; app != "" {
+		viewers = s.registry.Viewers(app, key)
+	}
+	list := []streams.ViewerStatus{}
+	for _, v := range viewers {
+		list = append(list, v.Status())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) adminKickHandler(w http.ResponseWriter, r *http.Request) {
+	v := s.registry.Viewer(mux.Vars(r)["id"])
+	if v == nil {
+		writeError(w, http.StatusNotFound, errNoViewer)
+		return
+	}
+	logging.Infof("[admin] kick viewer %v of %v / %v from %v", v.ID(), v.App, v.Key, v.RemoteAddr)
+	v.Kick()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminTerminateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stream := s.registry.Get(vars["app_name"], vars["stream_key"])
+	if stream == nil {
+		writeError(w, http.StatusNotFound, errNotLive)
+		return
+	}
+	logging.Infof("[admin] terminate publisher of %v from %v", stream.Topic(), stream.RemoteAddr)
+	stream.Terminate()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminBrokerHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.broker.Stats())
+}
+
+// RuntimeStats describes the resource usage of the relay process.
+type RuntimeStats struct {
+	Uptime     float64 `json:"uptime"`
+	CPUs       int     `json:"cpus"`
+	CPUSeconds float64 `json:"cpu_seconds"` // user and system, -1 when unknown
+	Goroutines int     `json:"goroutines"`
+	HeapBytes  uint64  `json:"heap_bytes"`
+	SysBytes   uint64  `json:"sys_bytes"` // obtained from the system by the runtime
+	GCCycles   uint32  `json:"gc_cycles"`
+	GCPause    float64 `json:"gc_pause_seconds"` // total
+}
+
+func (s *Server) adminRuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := RuntimeStats{
+		Uptime:     time.Since(s.startedAt).Seconds(),
+		CPUs:       runtime.GOMAXPROCS(0),
+		CPUSeconds: -1,
+		Goroutines: runtime.NumGoroutine(),
+		HeapBytes:  mem.HeapAlloc,
+		SysBytes:   mem.Sys,
+		GCCycles:   mem.NumGC,
+		GCPause:    time.Duration(mem.PauseTotalNs).Seconds(),
+	}
+	if cpu, ok := processCPUTime(); ok {
+		stats.CPUSeconds = cpu.Seconds()
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/client"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+func TestAdminAuth(t *testing.T) {
+	_, disabled := newTestServer(t, Options{})
+	if status, _ := apiRequest(t, "GET", disabled+"/api/admin/topics", "s3cret", ""); status != http.StatusForbidden {
+		t.Errorf("without admin token: got status %v", status)
+	}
+	_, url := newTestServer(t, Options{AdminToken: "s3cret"})
+	for _, token := range []string{"", "other"} {
+		if status, _ := apiRequest(t, "GET", url+"/api/admin/topics", token, ""); status != http.StatusUnauthorized {
+			t.Errorf("token %q: got status %v", token, status)
+		}
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	s, url := newTestServer(t, Options{AdminToken: "s3cret"})
+	data := testStream(t, 50)
+	publishTest(t, url, "live", "news", data)
+	player, err := client.Play(url, "live", "news", client.PlayerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	readFull(t, player, len(data)-keyframes(data)[1])
+
+	get := func(path string, v interface{}) {
+		t.Helper()
+		status, body := apiRequest(t, "GET", url+path, "s3cret", "")
+		if status != http.StatusOK {
+			t.Fatalf("%v: got status %v", path, status)
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+	}
+
+	var topics []TopicStatus
+	get("/api/admin/topics", &topics)
+	if len(topics) != 1 || topics[0].Topic != "live/news" || !topics[0].Live || topics[0].Viewers != 1 || topics[0].Subscribers != 1 {
+		t.Errorf("got topics %+v", topics)
+	}
+	var viewers []streams.ViewerStatus
+	get("/api/admin/topics/live/news/viewers", &viewers)
+	if len(viewers) != 1 || viewers[0].Protocol != "websocket" || viewers[0].BytesSent < uint64(len(data)-keyframes(data)[1]) {
+		t.Fatalf("got viewers %+v", viewers)
+	}
+	var all []streams.ViewerStatus
+	get("/api/admin/viewers", &all)
+	if len(all) != 1 || all[0].ID != viewers[0].ID {
+		t.Errorf("got viewers %+v", all)
+	}
+	var broker pubsub.Stats
+	get("/api/admin/broker", &broker)
+	if broker.Subscribers != 1 || len(broker.Topics) != 1 || broker.Topics[0].GOPMessages == 0 {
+		t.Errorf("got broker %+v", broker)
+	}
+	var runtime RuntimeStats
+	get("/api/admin/runtime", &runtime)
+	if runtime.Goroutines == 0 || runtime.HeapBytes == 0 {
+		t.Errorf("got runtime %+v", runtime)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/admin/viewers/" + viewers[0].ID, http.StatusNoContent},
+		{"/api/admin/viewers/" + viewers[0].ID, http.StatusNotFound},
+		{"/api/admin/streams/live/news", http.StatusNoContent},
+		{"/api/admin/streams/live/other", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, _ := apiRequest(t, "DELETE", url+tt.path, "s3cret", ""); status != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.path, status, tt.status)
+		}
+		if tt.path == tests[0].path {
+			waitFor(t, "the viewer kicked", func() bool { return len(s.registry.AllViewers()) == 0 })
+		}
+	}
+	waitFor(t, "the publisher terminated", func() bool { return s.registry.Get("live", "news") == nil })
+}
@@ -0,0 +1,265 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+var (
+	errUnknownApp    = &HookError{Status: http.StatusNotFound, Message: "unknown app"}
+	errInvalidSecret = &HookError{Status: http.StatusUnauthorized, Message: "invalid secret"}
+	errOrigin        = &HookError{Status: http.StatusForbidden, Message: "origin not allowed"}
+	errMaxPublishers = &HookError{Status: http.StatusServiceUnavailable, Message: "too many publishers"}
+	errMaxViewers    = &HookError{Status: http.StatusServiceUnavailable, Message: "too many viewers"}
+	errSlateNotPaced = errors.New("no PCR to pace the slate")
+)
+
+// AppOptions are the settings of the streams of an app.
+type AppOptions struct {
+	// PublishSecret and PlaySecret are expected as a secret parameter or
+	// as a bearer token of the publishers and viewers.
+	PublishSecret string
+	PlaySecret    string
+	MaxPublishers int // live streams at once, 0 for no limit
+	MaxViewers    int // of all the streams at once, 0 for no limit
+
+	// Record records the streams as long as they are published.
+	Record bool
+	// AllowedOrigins are the origins of the pages allowed to publish and
+	// play, like https://example.com, any of them when empty or with "*".
+	AllowedOrigins []string
+
+	QueueSize int    // of the viewers, the one of the broker when 0
+	Overflow  string // of the viewers, pubsub.OverflowSkip by default
+
+	// Slate is a transport stream file looped to the viewers of the topics
+	// without publisher.
+	Slate string
+}
+
+// to get the options of an app, false when it is not declared
+func (s *Server) app(name string) (AppOptions, bool) {
+	app, ok := s.opts.Apps[name]
+	return app, ok
+}
+
+// checkApp enforces the options of the app of a publisher or a viewer, the
+// secret and origin checks are skipped without request.
+func (s *Server) checkApp(name string, r *http.Request, publish bool) error {
+	app, ok := s.app(name)
+	if !ok {
+		if s.opts.Strict {
+			return errUnknownApp
+		}
+		return nil
+	}
+	if r != nil {
+		secret := app.PlaySecret
+		if publish {
+			secret = app.PublishSecret
+		}
+		if secret != "" && !validSecret(r, secret) {
+			return errInvalidSecret
+		}
+		if !allowedOrigin(r, app.AllowedOrigins) {
+			return errOrigin
+		}
+	}
+	if publish && app.MaxPublishers > 0 {
+		live := 0
+		for _, stream := range s.registry.List() {
+			if stream.App == name {
+				live++
+			}
+		}
+		if live >= app.MaxPublishers {
+			return errMaxPublishers
+		}
+	}
+	if !publish && app.MaxViewers > 0 {
+		viewers := 0
+		for _, v := range s.registry.AllViewers() {
+			if v.App == name {
+				viewers++
+			}
+		}
+		if viewers >= app.MaxViewers {
+			return errMaxViewers
+		}
+	}
+	return nil
+}
+
+// validSecret tells whether a request carries the secret, as a parameter
+// or as a bearer token.
+func validSecret(r *http.Request, secret string) bool {
+	given := r.URL.Query().Get("secret")
+	if given == "" {
+		given = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+// allowedOrigin tells whether the page a request comes from may use the
+// app, the requests without origin are not from browsers.
+func allowedOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(allowed) == 0 {
+		return true
+	}
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// attach attaches a subscriber for a viewer of an app, with its queue.
+func (s *Server) attach(appName string) (*pubsub.Subscriber, error) {
+	app, _ := s.app(appName)
+	overflow := app.Overflow
+	if overflow == "" {
+		overflow = pubsub.OverflowSkip
+	}
+	return s.broker.AttachQueue(app.QueueSize, overflow)
+}
+
+// publish registers the stream of an accepted publisher, in place of the
+// slate of the topic, and records it when its app asks to. The returned
+// function unregisters it.
+func (s *Server) publish(p *Publish) (*streams.Stream, func()) {
+	topic := p.App + "/" + p.Key
+	s.stopSlate(topic)
+	stream := s.registry.Publish(p.App, p.Key, p.RemoteAddr, p.Transport, p.Private)
+
+	var recording string
+	if app, _ := s.app(p.App); app.Record {
+		if rec, err := s.scheduler.Record(p.App, p.Key); err != nil {
+			logging.Errorf("[record] %v: %v", topic, err)
+		} else {
+			recording = rec.ID
+		}
+	}
+	return stream, func() {
+		if recording != "" {
+			s.scheduler.Stop(recording)
+		}
+		s.registry.Unpublish(stream)
+		s.startSlate(topic)
+	}
+}
+
+// slate is the loop of a slate file into a topic.
+type slate struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startSlate loops the slate of the app of a topic to its viewers, unless
+// it is live or already slated.
+func (s *Server) startSlate(topic string) {
+	appName, key, _ := strings.Cut(topic, "/")
+	app, _ := s.app(appName)
+	if app.Slate == "" || s.registry.Get(appName, key) != nil || s.broker.Subscribers(topic) == 0 {
+		return
+	}
+	s.slateLock.Lock()
+	defer s.slateLock.Unlock()
+	if s.slates[topic] != nil {
+		return
+	}
+	sl := &slate{stop: make(chan struct{}), done: make(chan struct{})}
+	s.slates[topic] = sl
+	go func() {
+		defer close(sl.done)
+		logging.Debugf("[slate] start %v on %v", app.Slate, topic)
+		if err := s.runSlate(topic, app.Slate, sl.stop); err != nil {
+			logging.Errorf("[slate] %v: %v", topic, err)
+		}
+		s.slateLock.Lock()
+		if s.slates[topic] == sl {
+			delete(s.slates, topic)
+		}
+		s.slateLock.Unlock()
+	}()
+}
+
+// stopSlate stops the slate of a topic and forgets its pictures, before its
+// publisher starts.
+func (s *Server) stopSlate(topic string) {
+	s.slateLock.Lock()
+	sl := s.slates[topic]
+	delete(s.slates, topic)
+	s.slateLock.Unlock()
+	if sl == nil {
+		return
+	}
+	close(sl.stop)
+	<-sl.done
+	s.broker.Reset(topic)
+	logging.Debugf("[slate] stop %v", topic)
+}
+
+// runSlate broadcasts a slate file again and again at the pace of its PCR,
+// until stopped or the topic has no subscriber anymore.
+func (s *Server) runSlate(topic, path string, stop <-chan struct{}) error {
+	appName, key, _ := strings.Cut(topic, "/")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var pacer mpegts.Pacer
+	var chunk []byte
+	buf := make([]byte, 64*mpegts.PacketSize)
+	paced := false // by a PCR since the start of the file
+	for {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		for _, pkt := range mpegts.Packets(buf[:n]) {
+			if wait := pacer.Delay(pkt, time.Now()); wait > 0 {
+				paced = true
+				// the subscribers keep the packets after Broadcast returns
+				for _, c := range mpegts.SplitKeyframes(chunk) {
+					s.broker.BroadcastFrame(c.Data, c.Keyframe, topic)
+				}
+				chunk = nil
+				select {
+				case <-stop:
+					return nil
+				case <-time.After(wait):
+				}
+				if s.broker.Subscribers(topic) == 0 || s.registry.Get(appName, key) != nil {
+					return nil
+				}
+			}
+			chunk = append(chunk, pkt...)
+		}
+		if err == nil {
+			continue
+		}
+		// the end of the file
+		if !paced {
+			return errSlateNotPaced
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		pacer.Reset()
+		paced = false
+	}
+}
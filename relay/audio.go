@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// the number of audio bytes between two ICY metadata blocks
+const icyMetaInt = 16000
+
+// audioWriter extracts the elementary stream of the first audio PID from
+// the packets written to it.
+type audioWriter struct {
+	out   io.Writer
+	demux *mpegts.Demuxer
+	pid   uint16
+	found bool
+}
+
+func (aw *audioWriter) Write(data []byte) (int, error) {
+	for _, pkt := range mpegts.Packets(data) {
+		for _, pes := range aw.demux.Push(pkt) {
+			if !pes.Header.IsAudio() || (aw.found && pes.PID != aw.pid) {
+				continue
+			}
+			aw.pid, aw.found = pes.PID, true
+			if _, err := aw.out.Write(pes.Data); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(data), nil
+}
+
+// icyWriter interleaves SHOUTcast/Icecast metadata blocks with the audio.
+type icyWriter struct {
+	out   io.Writer
+	title string
+	sent  string // the title of the last block
+	left  int    // audio bytes before the next block
+}
+
+func (iw *icyWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		if iw.left == 0 {
+			if _, err := iw.out.Write(iw.metadata()); err != nil {
+				return written, err
+			}
+			iw.left = icyMetaInt
+		}
+
+		n := len(data)
+		if n > iw.left {
+			n = iw.left
+		}
+		if _, err := iw.out.Write(data[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		iw.left -= n
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// metadata returns the next block, a single zero byte when the title
+// didn't change since the last one.
+func (iw *icyWriter) metadata() []byte {
+	if iw.title == iw.sent {
+		return []byte{0}
+	}
+	iw.sent = iw.title
+
+	text := fmt.Sprintf("StreamTitle='%v';", strings.Replace(iw.title, "'", "", -1))
+	if len(text) > 255*16 {
+		text = text[:255*16]
+	}
+	blocks := (len(text) + 15) / 16
+	block := bytes.NewBuffer([]byte{byte(blocks)})
+	block.WriteString(text)
+	block.Write(make([]byte, blocks*16-len(text)))
+	return block.Bytes()
+}
+
+// audioHandler serves the MP2 audio of a topic as an endless audio/mpeg
+// response, with ICY metadata when the client asks for it.
+func (s *Server) audioHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName := vars["app_name"]
+	streamKey := vars["stream_key"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	p := &Play{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Protocol: "audio", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+
+	subscriber, err := s.attach(appName)
+	if err != nil {
+		logging.Error("subscribe error: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer s.broker.Detach(subscriber)
+	client := s.registry.Join(appName, streamKey, r.RemoteAddr, "audio", subscriber, s.kickHTTP(w, subscriber))
+	defer s.registry.Leave(client)
+	p.Viewer = client
+
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		title = appName + "/" + streamKey
+	}
+
+	out := io.MultiWriter(flushWriter{w, flusher}, client)
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("icy-name", title)
+	if r.Header.Get("Icy-MetaData") == "1" {
+		w.Header().Set("icy-metaint", fmt.Sprint(icyMetaInt))
+		out = &icyWriter{out: out, title: title, left: icyMetaInt}
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	logging.Infof("play audio of %v / %v for %v", appName, streamKey, r.RemoteAddr)
+	aw := &audioWriter{out: out, demux: mpegts.NewDemuxer()}
+	if err := s.relayTopic(aw, subscriber, appName+"/"+streamKey, r.Context().Done()); err != nil {
+		logging.Debug("[http] audio error: ", err)
+	}
+}
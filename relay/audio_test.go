@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+func TestICYWriter(t *testing.T) {
+	var out bytes.Buffer
+	iw := &icyWriter{out: &out, title: "it's live", left: 4}
+	if _, err := iw.Write([]byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	// the title unchanged, the next block is empty
+	if _, err := iw.Write([]byte(strings.Repeat("x", icyMetaInt-2) + "yz")); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "StreamTitle='its live';"
+	block := append([]byte{2}, text...)
+	block = append(block, make([]byte, 32-len(text))...)
+	want := "abcd" + string(block) + "ef" + strings.Repeat("x", icyMetaInt-2) + "\x00" + "yz"
+	if got := out.String(); got != want {
+		t.Errorf("got %d bytes starting with %.40q, want %d bytes", len(got), got, len(want))
+	}
+}
+
+// audioOf returns the elementary stream of the audio PID of a stream.
+func audioOf(data []byte) []byte {
+	var es []byte
+	d := mpegts.NewDemuxer()
+	for _, p := range mpegts.Packets(data) {
+		for _, pes := range d.Push(p) {
+			if pes.PID == testsrc.AudioPID {
+				es = append(es, pes.Data...)
+			}
+		}
+	}
+	return es
+}
+
+func TestAudio(t *testing.T) {
+	s, url := newTestServer(t, Options{})
+	data := testStream(t, 50)
+	pub := publishTest(t, url, "live", "news", data)
+	waitFor(t, "the cached pictures", func() bool {
+		topics := s.broker.Stats().Topics
+		return len(topics) > 0 && topics[0].GOPMessages > 0
+	})
+
+	req, err := http.NewRequest("GET", url+"/audio/live/news.mp2?title=News", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "audio/mpeg" {
+		t.Fatalf("got status %v, content type %q", resp.StatusCode, ct)
+	}
+	if name, metaint := resp.Header.Get("icy-name"), resp.Header.Get("icy-metaint"); name != "News" || metaint != "16000" {
+		t.Errorf("got icy-name %q, icy-metaint %q", name, metaint)
+	}
+
+	// the first metadata block follows the first 16000 bytes of MP2 frames,
+	// more than the cached second of audio
+	if _, err := pub.Write(testStream(t, 75)); err != nil {
+		t.Fatal(err)
+	}
+	got := readFull(t, resp.Body, icyMetaInt+1)
+	if got[0] != 0xff || got[1]&0xe0 != 0xe0 {
+		t.Errorf("got %x, not starting on an audio frame", got[:4])
+	}
+	if !bytes.Contains(audioOf(data), got[:1000]) {
+		t.Error("the audio differs from the one published")
+	}
+	blocks := int(got[icyMetaInt])
+	meta := string(readFull(t, resp.Body, blocks*16))
+	if !strings.HasPrefix(meta, "StreamTitle='News';") {
+		t.Errorf("got metadata %q", meta)
+	}
+}
@@ -0,0 +1,156 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+)
+
+var errBanned = errors.New("banned")
+
+// Ban keeps an address from publishing and playing.
+type Ban struct {
+	Addr      string     `json:"addr"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Until     *time.Time `json:"until,omitempty"`
+}
+
+// banList keeps the banned addresses in memory.
+type banList struct {
+	sync.RWMutex
+	bans map[string]Ban
+}
+
+func (l *banList) Add(b Ban) {
+	l.Lock()
+	defer l.Unlock()
+	l.bans[b.Addr] = b
+}
+
+// Remove lifts the ban of an address, false when it was not banned.
+func (l *banList) Remove(addr string) bool {
+	l.Lock()
+	defer l.Unlock()
+	_, ok := l.bans[addr]
+	delete(l.bans, addr)
+	return ok
+}
+
+// List returns the bans in effect ordered by address.
+func (l *banList) List() []Ban {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	list := []Ban{}
+	for addr, b := range l.bans {
+		if b.Until != nil && now.After(*b.Until) {
+			delete(l.bans, addr)
+			continue
+		}
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Addr < list[j].Addr })
+	return list
+}
+
+// Banned tells whether the address of a connection is banned.
+func (l *banList) Banned(remoteAddr string) bool {
+	l.RLock()
+	defer l.RUnlock()
+	b, ok := l.bans[remoteIP(remoteAddr)]
+	return ok && (b.Until == nil || time.Now().Before(*b.Until))
+}
+
+// to get the IP of a remote address like 10.0.0.1:51234
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// notBanned turns the banned addresses away.
+func (s *Server) notBanned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.bans.Banned(r.RemoteAddr) {
+			logging.Debugf("[http] refuse %v from banned %v", r.URL.Path, r.RemoteAddr)
+			http.Error(w, errBanned.Error(), http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) adminListBansHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.bans.List())
+}
+
+// adminAddBanHandler bans an address given as {"addr": "10.0.0.1",
+// "duration": "1h", "reason": "..."}, forever without duration, and
+// disconnects its publishers and viewers.
+func (s *Server) adminAddBanHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Addr     string `json:"addr"`
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ip := net.ParseIP(req.Addr)
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, errors.New("addr must be an IP address"))
+		return
+	}
+	// in the form of the remote addresses, like 2001:db8::1
+	b := Ban{Addr: ip.String(), Reason: req.Reason, CreatedAt: time.Now()}
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid duration: "+req.Duration))
+			return
+		}
+		until := b.CreatedAt.Add(d)
+		b.Until = &until
+	}
+	s.bans.Add(b)
+	logging.Infof("[admin] ban %v", b.Addr)
+
+	for _, stream := range s.registry.List() {
+		if remoteIP(stream.RemoteAddr) == b.Addr {
+			stream.Terminate()
+		}
+	}
+	for _, v := range s.registry.AllViewers() {
+		if remoteIP(v.RemoteAddr) == b.Addr {
+			v.Kick()
+		}
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (s *Server) adminRemoveBanHandler(w http.ResponseWriter, r *http.Request) {
+	addr := mux.Vars(r)["addr"]
+	if ip := net.ParseIP(addr); ip != nil {
+		addr = ip.String()
+	}
+	if !s.bans.Remove(addr) {
+		writeError(w, http.StatusNotFound, errors.New("not banned: "+addr))
+		return
+	}
+	logging.Infof("[admin] unban %v", addr)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/client"
+)
+
+func TestRemoteIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr, want string
+	}{
+		{"10.0.0.1:51234", "10.0.0.1"},
+		{"[2001:0db8::0001]:51234", "2001:db8::1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"@", "@"},
+	}
+	for _, tt := range tests {
+		if got := remoteIP(tt.remoteAddr); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestBanList(t *testing.T) {
+	l := &banList{bans: map[string]Ban{}}
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	l.Add(Ban{Addr: "10.0.0.2", Until: &future})
+	l.Add(Ban{Addr: "10.0.0.1"})
+	l.Add(Ban{Addr: "10.0.0.3", Until: &past})
+
+	for addr, want := range map[string]bool{"10.0.0.1:1234": true, "10.0.0.2:1234": true, "10.0.0.3:1234": false, "10.0.0.4:1234": false} {
+		if got := l.Banned(addr); got != want {
+			t.Errorf("%v: got banned %v", addr, got)
+		}
+	}
+	if list := l.List(); len(list) != 2 || list[0].Addr != "10.0.0.1" || list[1].Addr != "10.0.0.2" {
+		t.Errorf("got %+v", list)
+	}
+	if !l.Remove("10.0.0.1") || l.Remove("10.0.0.1") || l.Banned("10.0.0.1:1234") {
+		t.Error("the ban was not lifted once")
+	}
+}
+
+func TestBans(t *testing.T) {
+	s, url := newTestServer(t, Options{AdminToken: "s3cret"})
+	publishTest(t, url, "live", "news", testStream(t, 25))
+	player, err := client.Play(url, "live", "news", client.PlayerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	waitFor(t, "the viewer", func() bool { return len(s.registry.AllViewers()) == 1 })
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"addr": "127.0.0.1:1234"}`, http.StatusBadRequest},
+		{`{"addr": "127.0.0.1", "duration": "soon"}`, http.StatusBadRequest},
+		{`{"addr": "127.0.0.1", "duration": "-1h"}`, http.StatusBadRequest},
+		{`{"addr": `, http.StatusBadRequest},
+		{`{"addr": "127.0.0.1", "duration": "1h", "reason": "spam"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if status, _ := apiRequest(t, "POST", url+"/api/admin/bans", "s3cret", tt.body); status != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.body, status, tt.status)
+		}
+	}
+
+	// the publisher and the viewer from the address banned are gone
+	waitFor(t, "the publisher and the viewer", func() bool {
+		return s.registry.Get("live", "news") == nil && len(s.registry.AllViewers()) == 0
+	})
+	if status, _ := apiRequest(t, "GET", url+"/watch/live/news", "", ""); status != http.StatusForbidden {
+		t.Errorf("banned: got status %v", status)
+	}
+	status, body := apiRequest(t, "GET", url+"/api/admin/bans", "s3cret", "")
+	var bans []Ban
+	if err := json.Unmarshal(body, &bans); err != nil || status != http.StatusOK {
+		t.Fatalf("got status %v: %v", status, err)
+	}
+	if len(bans) != 1 || bans[0].Addr != "127.0.0.1" || bans[0].Reason != "spam" || bans[0].Until == nil {
+		t.Errorf("got %+v", bans)
+	}
+
+	if status, _ := apiRequest(t, "DELETE", url+"/api/admin/bans/127.0.0.1", "s3cret", ""); status != http.StatusNoContent {
+		t.Errorf("unban: got status %v", status)
+	}
+	if status, _ := apiRequest(t, "DELETE", url+"/api/admin/bans/127.0.0.1", "s3cret", ""); status != http.StatusNotFound {
+		t.Errorf("unban again: got status %v", status)
+	}
+	if status, _ := apiRequest(t, "GET", url+"/watch/live/news", "", ""); status != http.StatusOK {
+		t.Errorf("unbanned: got status %v", status)
+	}
+}
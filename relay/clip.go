@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/clip"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/record"
+)
+
+// clipHandler exports either the last seconds of a live stream from the
+// timeshift buffer (?last=60s) or a time range (?from=...&to=...) given as
+// RFC 3339 times or marker names, from the recordings or else the buffer.
+func (s *Server) clipHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName := vars["app_name"]
+	streamKey := vars["stream_key"]
+	topic := appName + "/" + streamKey
+	query := r.URL.Query()
+
+	p := &Play{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Protocol: "clip", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+
+	var c *clip.Clip
+	var err error
+	if last := query.Get("last"); last != "" {
+		d, perr := time.ParseDuration(last)
+		if perr != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid last %q", last), http.StatusBadRequest)
+			return
+		}
+		if s.dvr == nil || s.dvr.Get(topic) == nil {
+			http.Error(w, "stream is not live", http.StatusNotFound)
+			return
+		}
+		now := time.Now()
+		c, err = clip.Live(s.dvr.Get(topic), now.Add(-d), now)
+	} else {
+		from, ferr := s.clipBoundary(appName, streamKey, query.Get("from"))
+		to, terr := s.clipBoundary(appName, streamKey, query.Get("to"))
+		if ferr != nil || terr != nil || !to.After(from) {
+			http.Error(w, "expecting last, or from and to as RFC 3339 times or markers", http.StatusBadRequest)
+			return
+		}
+		c, err = clip.FromRecordings(s.streamRecordings(appName, streamKey), from, to)
+		if err == clip.ErrEmpty && s.dvr != nil && s.dvr.Get(topic) != nil {
+			c, err = clip.Live(s.dvr.Get(topic), from, to)
+		}
+	}
+	if err == clip.ErrEmpty {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Error("[clip] error: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("%v-%v-%v.ts", appName, streamKey, time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if n, err := c.WriteTo(w); err != nil {
+		logging.Errorf("[clip] %v: write error after %v bytes: %v", topic, n, err)
+	}
+}
+
+// streamRecordings returns the recordings of a stream, oldest first.
+func (s *Server) streamRecordings(appName, streamKey string) []record.Recording {
+	recs := []record.Recording{}
+	for _, rec := range s.scheduler.Recordings() {
+		if rec.App == appName && rec.Key == streamKey {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// clipBoundary parses a RFC 3339 time or resolves a marker of the stream.
+func (s *Server) clipBoundary(appName, streamKey, value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	marker, err := s.markers.Find(appName, streamKey, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return marker.At, nil
+}
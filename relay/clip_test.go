@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+func TestClip(t *testing.T) {
+	s, url := newTestServer(t, Options{Timeshift: time.Minute})
+	data := testStream(t, 50)
+	publishTest(t, url, "live", "news", data)
+	waitFor(t, "the buffer", func() bool {
+		b := s.dvr.Get("live/news")
+		return b != nil && len(b.Entries(time.Time{}, time.Now().Add(time.Hour))) > 0
+	})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/clip/live/news.ts?last=60s", http.StatusOK},
+		{"/clip/live/news.ts?last=soon", http.StatusBadRequest},
+		{"/clip/live/news.ts?last=-1s", http.StatusBadRequest},
+		{"/clip/live/other.ts?last=60s", http.StatusNotFound},
+		{"/clip/live/news.ts?from=kickoff&to=halftime", http.StatusBadRequest},
+		{"/clip/live/news.ts?from=2024-03-04T20:05:00Z&to=2024-03-04T20:00:00Z", http.StatusBadRequest},
+		{"/clip/live/news.ts?from=2024-03-04T20:00:00Z&to=2024-03-04T20:05:00Z", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(url + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		// the clip starts with the tables followed by a keyframe
+		if ct := resp.Header.Get("Content-Type"); ct != "video/mp2t" {
+			t.Errorf("%v: got content type %q", tt.path, ct)
+		}
+		packets := mpegts.Packets(body)
+		if len(packets) == 0 || packets[0].PID() != 0 {
+			t.Fatalf("%v: the clip does not start with a PAT", tt.path)
+		}
+		if k := keyframes(body); len(k) == 0 || k[0] != 2*mpegts.PacketSize {
+			t.Errorf("%v: got keyframes at %v", tt.path, k)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+// listStreamsHandler lists the public live streams, of an app given by the
+// app parameter.
+func (s *Server) listStreamsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.directory(r.URL.Query().Get("app")))
+}
+
+var directoryTemplate = template.Must(template.New("directory").Funcs(template.FuncMap{
+	"uptime": func(seconds float64) time.Duration {
+		return (time.Duration(seconds) * time.Second).Truncate(time.Second)
+	},
+	"kbps": func(bitrate int) int {
+		return bitrate / 1000
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<title>JSMpeg Relay Streams</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<style type="text/css">
+		html, body {
+			background-color: #111;
+			color: #ddd;
+			font-family: sans-serif;
+		}
+		.grid {
+			display: grid;
+			grid-template-columns: repeat(auto-fill, minmax(240px, 1fr));
+			gap: 16px;
+			margin: 16px;
+		}
+		a {
+			color: inherit;
+			text-decoration: none;
+		}
+		img {
+			width: 100%;
+			aspect-ratio: 4 / 3;
+			object-fit: contain;
+			background-color: #000;
+		}
+		.title {
+			font-weight: bold;
+		}
+		.meta {
+			font-size: small;
+			color: #888;
+		}
+		.degraded, .stalled {
+			color: #c60;
+		}
+	</style>
+</head>
+<body>
+	<h1>Streams{{if .App}} of {{.App}}{{end}}</h1>
+	{{if not .Streams}}<p>No stream is live.</p>{{end}}
+	<div class="grid">
+	{{range .Streams}}
+		<a href="/watch/{{.App}}/{{.Key}}">
+			<img class="thumbnail" data-src="/api/streams/{{.App}}/{{.Key}}/snapshot?format=jpeg" src="/api/streams/{{.App}}/{{.Key}}/snapshot?format=jpeg" alt="">
+			<div class="title">{{.App}}/{{.Key}}</div>
+			<div class="meta">
+				{{if .Width}}{{.Width}}x{{.Height}} {{printf "%.2f" .FrameRate}}fps, {{end}}{{kbps .Bitrate}} kbit/s,
+				{{.Viewers}} viewers, up {{uptime .Uptime}} over {{.Transport}}
+				{{if ne .State "ok"}}<span class="{{.State}}">{{.State}}</span>{{end}}
+			</div>
+		</a>
+	{{end}}
+	</div>
+	<script type="text/javascript">
+		// to refresh the thumbnails with the latest keyframes
+		setInterval(function () {
+			document.querySelectorAll('img.thumbnail').forEach(function (img) {
+				img.src = img.dataset.src + '&t=' + Date.now();
+			});
+		}, 10000);
+	</script>
+</body>
+</html>
+`))
+
+// directory lists the public live streams of an app or of all the apps,
+// but the ones of the apps with a play secret.
+func (s *Server) directory(app string) []streams.Summary {
+	list := []streams.Summary{}
+	for _, summary := range s.registry.Directory(app) {
+		if options, _ := s.app(summary.App); options.PlaySecret == "" {
+			list = append(list, summary)
+		}
+	}
+	return list
+}
+
+// directoryHandler shows the public live streams, of an app given by the
+// app parameter, as a grid of thumbnails linking to the player.
+func (s *Server) directoryHandler(w http.ResponseWriter, r *http.Request) {
+	app := r.URL.Query().Get("app")
+	data := struct {
+		App     string
+		Streams []streams.Summary
+	}{app, s.directory(app)}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := directoryTemplate.Execute(w, data); err != nil {
+		logging.Error("[http] directory error: ", err)
+	}
+}
@@ -0,0 +1,137 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/timeshift"
+	"github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+// viewer is the websocket connection of a player
+type viewer interface {
+	io.Writer
+	Closing() <-chan bool
+	ReadControl() (*websocket.Control, error)
+}
+
+// parseOffset parses a playback offset like "-30s", 0 meaning live.
+func parseOffset(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	offset, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q: %v", s, err)
+	}
+	if offset > 0 {
+		return 0, fmt.Errorf("invalid offset %q: must not be ahead of live", s)
+	}
+	return offset, nil
+}
+
+// controlOffset returns the offset a control message asks to move to.
+func (s *Server) controlOffset(ctl *websocket.Control, appName, streamKey string) (time.Duration, bool) {
+	switch ctl.Cmd {
+	case websocket.ControlLive:
+		return 0, true
+	case websocket.ControlSeek:
+		if ctl.Marker != "" {
+			marker, err := s.markers.Find(appName, streamKey, ctl.Marker)
+			if err != nil {
+				logging.Debugf("[ws] control error: marker %q: %v", ctl.Marker, err)
+				return 0, false
+			}
+			if offset := time.Until(marker.At); offset < 0 {
+				return offset, true
+			}
+			return 0, true
+		}
+		offset, err := parseOffset(ctl.Offset)
+		if err != nil {
+			logging.Debug("[ws] control error: ", err)
+			return 0, false
+		}
+		return offset, true
+	}
+	return 0, false
+}
+
+// readControls forwards the control messages of a viewer until done is
+// closed, the channel is closed once the connection can't be read anymore.
+func readControls(c viewer, done <-chan struct{}) <-chan *websocket.Control {
+	controls := make(chan *websocket.Control)
+	go func() {
+		defer close(controls)
+		for {
+			ctl, err := c.ReadControl()
+			if err != nil {
+				logging.Debug("[ws] read control error: ", err)
+				return
+			}
+			select {
+			case controls <- ctl:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return controls
+}
+
+// playTimeshift replays the buffer of the topic behind live by the given
+// offset, starting at a keyframe, until the viewer leaves or seeks again.
+func (s *Server) playTimeshift(c viewer, appName, streamKey string, offset time.Duration, controls <-chan *websocket.Control) (time.Duration, bool) {
+	topic := appName + "/" + streamKey
+	buf := s.dvr.Get(topic)
+	if buf == nil {
+		logging.Debugf("[timeshift] %v is not live, fallback to live", topic)
+		return 0, true
+	}
+
+	seq, ok := buf.Seek(time.Now().Add(offset))
+	if !ok {
+		logging.Debugf("[timeshift] no keyframe buffered for %v, fallback to live", topic)
+		return 0, true
+	}
+	logging.Debugf("[timeshift] play %v at %v", topic, offset)
+
+	for {
+		entry, wait, err := buf.Get(seq)
+		var due <-chan time.Time
+		switch {
+		case err == timeshift.ErrEvicted:
+			// the viewer fell out of the window, restart at the oldest keyframe
+			if seq, ok = buf.Seek(time.Time{}); !ok {
+				return 0, true
+			}
+			continue
+		case err != nil:
+			logging.Debugf("[timeshift] %v: %v", topic, err)
+			return 0, false
+		case entry != nil:
+			due = time.After(time.Until(entry.At.Add(-offset)))
+		}
+
+		select {
+		case <-c.Closing():
+			return 0, false
+		case ctl, ok := <-controls:
+			if !ok {
+				return 0, false
+			}
+			if next, ok := s.controlOffset(ctl, appName, streamKey); ok {
+				return next, true
+			}
+		case <-wait:
+		case <-due:
+			if _, err := c.Write(entry.Data); err != nil {
+				logging.Error("websockt write mesage error: ", err)
+				return 0, false
+			}
+			seq++
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/client"
+	"github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, true},
+		{"0s", 0, true},
+		{"-30s", -30 * time.Second, true},
+		{"-1m30s", -90 * time.Second, true},
+		{"30s", 0, false},
+		{"-30", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseOffset(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestPlayTimeshift(t *testing.T) {
+	s, url := newTestServer(t, Options{Timeshift: time.Minute})
+	data := testStream(t, 50)
+	publishTest(t, url, "live", "news", data)
+	waitFor(t, "the buffer", func() bool {
+		b := s.dvr.Get("live/news")
+		return b != nil && len(b.Entries(time.Time{}, time.Now().Add(time.Hour))) > 0
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	// behind live, the viewer starts at the latest keyframe received before
+	p, err := client.Play(url, "live", "news", client.PlayerOptions{Offset: -100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	key := keyframes(data)[1]
+	if got := readFull(t, p, 4096); !bytes.Equal(got, data[key:key+4096]) {
+		t.Fatal("the timeshift playback does not start at the keyframe")
+	}
+}
+
+func TestPlayOffsetAhead(t *testing.T) {
+	_, url := newTestServer(t, Options{Timeshift: time.Minute})
+	resp, err := http.Get(url + "/play/live/news?offset=30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %v", resp.StatusCode)
+	}
+}
+
+// controlViewer is a viewer sending seek controls as fast as they are read.
+type controlViewer struct {
+	closing chan bool
+}
+
+func (c *controlViewer) Write(b []byte) (int, error) { return len(b), nil }
+func (c *controlViewer) Closing() <-chan bool        { return c.closing }
+func (c *controlViewer) ReadControl() (*websocket.Control, error) {
+	return &websocket.Control{Cmd: websocket.ControlSeek, Offset: "-1s"}, nil
+}
+
+func TestReadControlsDone(t *testing.T) {
+	done := make(chan struct{})
+	controls := readControls(&controlViewer{closing: make(chan bool)}, done)
+	if ctl := <-controls; ctl == nil || ctl.Cmd != websocket.ControlSeek {
+		t.Fatalf("got control %+v", ctl)
+	}
+	close(done)
+	// a control may be pending, then the channel is closed
+	for deadline := time.After(5 * time.Second); ; {
+		select {
+		case _, ok := <-controls:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("the controls are still forwarded")
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/egress"
+)
+
+func (s *Server) listOutputsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.outputs.List())
+}
+
+// addOutputHandler starts an output described either by a config or by
+// a topic and an url like the -udp-out flag.
+func (s *Server) addOutputHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		egress.Config
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cfg := req.Config
+	if req.URL != "" {
+		var err error
+		if cfg, err = egress.ParseURL(req.Topic, req.URL); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	status, err := s.outputs.Add(cfg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *Server) removeOutputHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.outputs.Remove(mux.Vars(r)["id"]); err == egress.ErrNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
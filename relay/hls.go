@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/hls"
+)
+
+// hlsStream returns the HLS stream of a request once its viewer is
+// accepted, the play must be ended when the stream is not nil.
+func (s *Server) hlsStream(w http.ResponseWriter, r *http.Request) (*hls.Stream, *Play) {
+	vars := mux.Vars(r)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	p := &Play{App: vars["app_name"], Key: vars["stream_key"], RemoteAddr: r.RemoteAddr, Protocol: "hls", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return nil, nil
+	}
+	var stream *hls.Stream
+	if s.segmenter != nil {
+		stream = s.segmenter.Get(p.App + "/" + p.Key)
+	}
+	if stream == nil {
+		s.endPlay(p)
+		http.NotFound(w, r)
+	}
+	return stream, p
+}
+
+func (s *Server) hlsPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	stream, p := s.hlsStream(w, r)
+	if stream == nil {
+		return
+	}
+	defer s.endPlay(p)
+	playlist := stream.Playlist()
+	if playlist == nil {
+		http.Error(w, "no segment available yet", http.StatusNotFound)
+		return
+	}
+	if secret := r.URL.Query().Get("secret"); secret != "" {
+		playlist = withSecret(playlist, secret)
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(playlist)
+}
+
+// withSecret appends the secret of a viewer to the segment URIs of a
+// playlist, for the players to fetch them like the playlist.
+func withSecret(playlist []byte, secret string) []byte {
+	var b bytes.Buffer
+	for _, line := range bytes.SplitAfter(playlist, []byte("\n")) {
+		uri := bytes.TrimRight(line, "\r\n")
+		b.Write(uri)
+		if len(uri) > 0 && uri[0] != '#' {
+			b.WriteString("?secret=" + url.QueryEscape(secret))
+		}
+		b.Write(line[len(uri):])
+	}
+	return b.Bytes()
+}
+
+func (s *Server) hlsSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	stream, p := s.hlsStream(w, r)
+	if stream == nil {
+		return
+	}
+	defer s.endPlay(p)
+	seq, err := strconv.ParseUint(mux.Vars(r)["seq"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	seg, ok := stream.Segment(seq)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Write(seg.Data)
+}
@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+func TestWithSecret(t *testing.T) {
+	playlist := "#EXTM3U\n#EXTINF:2.000,\n0.ts\r\n#EXTINF:2.000,\n1.ts\n"
+	want := "#EXTM3U\n#EXTINF:2.000,\n0.ts?secret=a+b%26c\r\n#EXTINF:2.000,\n1.ts?secret=a+b%26c\n"
+	if got := string(withSecret([]byte(playlist), "a b&c")); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHLS(t *testing.T) {
+	_, url := newTestServer(t, Options{HLSDuration: 500 * time.Millisecond, HLSWindow: 3})
+	if status, _ := apiRequest(t, "GET", url+"/hls/live/news/index.m3u8", "", ""); status != http.StatusNotFound {
+		t.Errorf("got status %v before the stream is published", status)
+	}
+	publishTest(t, url, "live", "news", testStream(t, 75))
+
+	var playlist []byte
+	waitFor(t, "the playlist", func() bool {
+		status, body := apiRequest(t, "GET", url+"/hls/live/news/index.m3u8?secret=s3cret", "", "")
+		playlist = body
+		return status == http.StatusOK
+	})
+	if !bytes.Contains(playlist, []byte("\n0.ts?secret=s3cret\n")) {
+		t.Errorf("got playlist:\n%s", playlist)
+	}
+
+	status, seg := apiRequest(t, "GET", url+"/hls/live/news/0.ts", "", "")
+	if status != http.StatusOK {
+		t.Fatalf("got status %v for the first segment", status)
+	}
+	packets := mpegts.Packets(seg)
+	if len(packets) < 3 || packets[0].PID() != 0 || !mpegts.IsKeyframe(packets[2]) {
+		t.Error("the segment does not start with the tables and a keyframe")
+	}
+	if status, _ := apiRequest(t, "GET", url+"/hls/live/news/99.ts", "", ""); status != http.StatusNotFound {
+		t.Errorf("got status %v for a segment not cut yet", status)
+	}
+}
@@ -0,0 +1,193 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+// Hook observes the publishers and viewers of a server by implementing one
+// or more of the hook interfaces below. The hooks are called in the order of
+// the options, the first one returning an error vetoes the event.
+type Hook interface {
+	// Name names the hook in the logs.
+	Name() string
+}
+
+// checkHook returns an error when a hook implements none of the hook
+// interfaces, which would never be called.
+func checkHook(h Hook) error {
+	if h == nil {
+		return errors.New("nil hook")
+	}
+	switch h.(type) {
+	case PublishStartHook, PublishDataHook, PublishEndHook, PlayStartHook, PlayEndHook:
+		return nil
+	}
+	return fmt.Errorf("hook %v implements none of the hook interfaces", h.Name())
+}
+
+// PublishStartHook is called before a publisher is accepted.
+type PublishStartHook interface {
+	OnPublishStart(p *Publish) error
+}
+
+// PublishDataHook is called with the packets of a publisher before they are
+// relayed, an error stops the publisher.
+type PublishDataHook interface {
+	OnPublishData(p *Publish, data []byte) error
+}
+
+// PublishEndHook is called once a publisher is gone, with the error which
+// stopped it, nil when it ended the stream.
+type PublishEndHook interface {
+	OnPublishEnd(p *Publish, err error)
+}
+
+// PlayStartHook is called before a viewer is accepted, and before every
+// request of the viewers of HLS playlists and segments, clips, snapshots
+// and player pages.
+type PlayStartHook interface {
+	OnPlayStart(p *Play) error
+}
+
+// PlayEndHook is called once a viewer is gone.
+type PlayEndHook interface {
+	OnPlayEnd(p *Play)
+}
+
+// Publish describes a publisher to the hooks.
+type Publish struct {
+	App        string
+	Key        string
+	RemoteAddr string
+	Private    bool
+	Transport  string        // http, websocket or testsrc
+	Request    *http.Request // of the publisher, or of the admin for testsrc
+	StartedAt  time.Time
+}
+
+// Play describes a viewer to the hooks.
+type Play struct {
+	App        string
+	Key        string
+	RemoteAddr string
+	Protocol   string // websocket, http, audio, vod, hls, clip, snapshot or watch
+	Request    *http.Request
+	StartedAt  time.Time
+
+	// Viewer is the viewer in the registry once it plays a live topic, nil
+	// for the recordings, HLS, clips, snapshots and player pages.
+	Viewer *streams.Viewer
+}
+
+// HookError is an error of a hook telling the HTTP status to refuse with,
+// the other errors of the hooks refuse with 403 Forbidden.
+type HookError struct {
+	Status  int
+	Message string
+}
+
+func (e *HookError) Error() string {
+	return e.Message
+}
+
+// to get the HTTP status and the message to refuse with after a veto
+func vetoStatus(err error) (int, string) {
+	var he *HookError
+	if errors.As(err, &he) {
+		return he.Status, he.Message
+	}
+	return http.StatusForbidden, err.Error()
+}
+
+// refuse answers a request vetoed by a hook.
+func refuse(w http.ResponseWriter, err error) {
+	status, message := vetoStatus(err)
+	http.Error(w, message, status)
+}
+
+// startPublish checks a publisher against the options of its app, then asks
+// the hooks whether to accept it, and returns the error which refused it.
+func (s *Server) startPublish(p *Publish) error {
+	r := p.Request
+	if p.Transport == "testsrc" {
+		r = nil // the admin needs no secret of the app
+	}
+	if err := s.checkApp(p.App, r, true); err != nil {
+		logging.Infof("[stream] refuse publisher of %v / %v from %v: %v", p.App, p.Key, p.RemoteAddr, err)
+		return err
+	}
+	for _, h := range s.opts.Hooks {
+		if hook, ok := h.(PublishStartHook); ok {
+			if err := hook.OnPublishStart(p); err != nil {
+				logging.Infof("[stream] hook %v refuses publisher of %v / %v from %v: %v", h.Name(), p.App, p.Key, p.RemoteAddr, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) publishData(p *Publish, data []byte) error {
+	for _, h := range s.opts.Hooks {
+		if hook, ok := h.(PublishDataHook); ok {
+			if err := hook.OnPublishData(p, data); err != nil {
+				return &vetoError{h.Name(), err}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) endPublish(p *Publish, err error) {
+	for _, h := range s.opts.Hooks {
+		if h, ok := h.(PublishEndHook); ok {
+			h.OnPublishEnd(p, err)
+		}
+	}
+}
+
+// startPlay checks a viewer against the options of its app, then asks the
+// hooks whether to accept it, and returns the error which refused it.
+func (s *Server) startPlay(p *Play) error {
+	if err := s.checkApp(p.App, p.Request, false); err != nil {
+		logging.Infof("[stream] refuse viewer of %v / %v from %v: %v", p.App, p.Key, p.RemoteAddr, err)
+		return err
+	}
+	for _, h := range s.opts.Hooks {
+		if hook, ok := h.(PlayStartHook); ok {
+			if err := hook.OnPlayStart(p); err != nil {
+				logging.Infof("[stream] hook %v refuses viewer of %v / %v from %v: %v", h.Name(), p.App, p.Key, p.RemoteAddr, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) endPlay(p *Play) {
+	for _, h := range s.opts.Hooks {
+		if h, ok := h.(PlayEndHook); ok {
+			h.OnPlayEnd(p)
+		}
+	}
+}
+
+// vetoError is the error of a data hook which stopped a publisher.
+type vetoError struct {
+	hook string
+	err  error
+}
+
+func (e *vetoError) Error() string {
+	return fmt.Sprintf("vetoed by hook %v: %v", e.hook, e.err)
+}
+
+func (e *vetoError) Unwrap() error {
+	return e.err
+}
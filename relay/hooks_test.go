@@ -0,0 +1,98 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// namedHook implements none of the hook interfaces.
+type namedHook struct{}
+
+func (namedHook) Name() string {
+	return "named"
+}
+
+// publishHook refuses the publishers of a key, stops the others at their
+// first packets and keeps the errors they ended with.
+type publishHook struct {
+	sync.Mutex
+	refused string
+	ended   []error
+}
+
+func (h *publishHook) Name() string {
+	return "publish"
+}
+
+func (h *publishHook) OnPublishStart(p *Publish) error {
+	if p.Key == h.refused {
+		return &HookError{Status: http.StatusUnauthorized, Message: "invalid secret"}
+	}
+	return nil
+}
+
+func (h *publishHook) OnPublishData(p *Publish, data []byte) error {
+	return &HookError{Status: http.StatusTooManyRequests, Message: "quota exceeded"}
+}
+
+func (h *publishHook) OnPublishEnd(p *Publish, err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.ended = append(h.ended, err)
+}
+
+func TestCheckHook(t *testing.T) {
+	tests := []struct {
+		hooks []Hook
+		err   string
+	}{
+		{[]Hook{&publishHook{}, &playHook{}}, ""},
+		{[]Hook{&publishHook{}, namedHook{}}, "hook named implements none of the hook interfaces"},
+		{[]Hook{nil}, "nil hook"},
+	}
+	for _, tt := range tests {
+		_, err := New(Options{RecordDir: t.TempDir(), Hooks: tt.hooks})
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%v: got %v, want %q", tt.hooks, err, tt.err)
+		}
+	}
+}
+
+func TestPublishHooks(t *testing.T) {
+	hook := &publishHook{refused: "refused"}
+	_, url := newTestServer(t, Options{Hooks: []Hook{hook}})
+	data := testStream(t, 25)
+
+	tests := []struct {
+		key     string
+		status  int
+		message string
+	}{
+		{"refused", http.StatusUnauthorized, "invalid secret"},
+		{"news", http.StatusTooManyRequests, "quota exceeded"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(url+"/publish/live/"+tt.key, "video/mp2t", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || strings.TrimSpace(string(body)) != tt.message {
+			t.Errorf("%v: got status %v, %q", tt.key, resp.StatusCode, body)
+		}
+	}
+
+	// the publisher refused at its start does not end
+	hook.Lock()
+	defer hook.Unlock()
+	var he *HookError
+	if len(hook.ended) != 1 || !errors.As(hook.ended[0], &he) || hook.ended[0].Error() != "vetoed by hook publish: quota exceeded" {
+		t.Errorf("got ends %v", hook.ended)
+	}
+}
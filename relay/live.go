@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+)
+
+var errSubscriberClosed = errors.New("subscriber destroyed")
+
+// relayTopic writes the topic to out as it is published, starting with the
+// cached group of pictures, or its slate while it is not, until stop is
+// closed. Viewers too slow to keep up skip to the next keyframe as the
+// broker drops their messages.
+func (s *Server) relayTopic(out io.Writer, subscriber *pubsub.Subscriber, topic string, stop <-chan struct{}) error {
+	s.broker.Subscribe(subscriber, topic)
+	defer s.broker.Unsubscribe(subscriber, topic)
+	s.startSlate(topic)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-subscriber.Closing():
+			return errSubscriberClosed
+		case msg, ok := <-subscriber.GetMessages():
+			if !ok {
+				return errSubscriberClosed
+			}
+			if _, err := out.Write(msg.GetData()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// flushWriter flushes every write so that chunks reach the client at once.
+type flushWriter struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	fw.f.Flush()
+	return n, err
+}
+
+// liveTSHandler serves the topic as an endless chunked MPEG-TS response for
+// players like ffplay, vlc or curl.
+func (s *Server) liveTSHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName := vars["app_name"]
+	streamKey := vars["stream_key"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	p := &Play{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Protocol: "http", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+
+	subscriber, err := s.attach(appName)
+	if err != nil {
+		logging.Error("subscribe error: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer s.broker.Detach(subscriber)
+
+	logging.Infof("play stream %v / %v over http for %v", appName, streamKey, r.RemoteAddr)
+	client := s.registry.Join(appName, streamKey, r.RemoteAddr, "http", subscriber, s.kickHTTP(w, subscriber))
+	defer s.registry.Leave(client)
+	p.Viewer = client
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err = s.relayTopic(io.MultiWriter(flushWriter{w, flusher}, client), subscriber, appName+"/"+streamKey, r.Context().Done())
+	if err != nil {
+		logging.Debug("[http] play error: ", err)
+	}
+}
@@ -0,0 +1,40 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestLiveTS(t *testing.T) {
+	s, url := newTestServer(t, Options{})
+	data := testStream(t, 50)
+	pub := publishTest(t, url, "live", "news", data)
+	waitFor(t, "the cached pictures", func() bool {
+		topics := s.broker.Stats().Topics
+		return len(topics) > 0 && topics[0].GOPMessages > 0
+	})
+
+	resp, err := http.Get(url + "/live/live/news.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "video/mp2t" {
+		t.Fatalf("got status %v, content type %q", resp.StatusCode, ct)
+	}
+
+	// the cached group of pictures comes first, from its keyframe, then
+	// what is published
+	k := keyframes(data)
+	if got := readFull(t, resp.Body, len(data)-k[1]); !bytes.Equal(got, data[k[1]:]) {
+		t.Error("the cached pictures differ from the ones published")
+	}
+	more := testStream(t, 25)
+	if _, err := pub.Write(more); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFull(t, resp.Body, len(more)); !bytes.Equal(got, more) {
+		t.Error("the live pictures differ from the ones published")
+	}
+}
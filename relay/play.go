@@ -0,0 +1,121 @@
+package relay
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+func (s *Server) playHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName := vars["app_name"]
+	streamKey := vars["stream_key"]
+
+	logging.Infof("play stream %v / %v", appName, streamKey)
+
+	offset, err := parseOffset(r.URL.Query().Get("offset"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := &Play{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Protocol: "websocket", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+
+	// TODO: identify unique connection by the same peer
+	// addrStr := fmt.Sprintf("%p", &conn)
+	// keyWord := conn.RemoteAddr().String() + conn.RemoteAddr().Network() + addrStr
+
+	c, ok := websocket.TryUpgrade(w, r)
+	if ok != true {
+		logging.Error("[ws] upgrade failed")
+		return
+	}
+	// cleanup on server side
+	// defer c.Close()
+
+	subscriber, err := s.attach(appName)
+	if err != nil {
+		c.Close()
+		logging.Error("subscribe error: ", err)
+		return
+	}
+
+	// defer broker.Detach(subscriber)
+	defer func() {
+		logging.Debug("websocket closed: to unsubscribe")
+		s.broker.Detach(subscriber)
+		c.Close()
+	}()
+
+	logging.Info("client remote addr: ", c.RemoteAddr())
+	client := s.registry.Join(appName, streamKey, r.RemoteAddr, "websocket", subscriber, func() {
+		c.SetDeadline(time.Now())
+		s.broker.Detach(subscriber)
+	})
+	defer s.registry.Leave(client)
+	p.Viewer = client
+	counted := countedViewer{c, client}
+
+	done := make(chan struct{})
+	defer close(done)
+	controls := readControls(c, done)
+	for {
+		if offset < 0 && s.dvr != nil {
+			offset, ok = s.playTimeshift(counted, appName, streamKey, offset, controls)
+		} else {
+			offset, ok = s.playLive(counted, subscriber, appName, streamKey, controls)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// playLive relays the topic as it is published until the viewer leaves or
+// asks to seek back into the timeshift buffer.
+func (s *Server) playLive(c viewer, subscriber *pubsub.Subscriber, appName, streamKey string, controls <-chan *websocket.Control) (time.Duration, bool) {
+	seek := make(chan time.Duration, 1)
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(stop)
+		for {
+			select {
+			case <-finished:
+				return
+			case <-c.Closing():
+				logging.Debug("received closeing signal, to close the websocket")
+				return
+			case ctl, ok := <-controls:
+				if !ok {
+					return
+				}
+				if offset, ok := s.controlOffset(ctl, appName, streamKey); ok && offset < 0 {
+					seek <- offset
+					return
+				}
+			}
+		}
+	}()
+
+	err := s.relayTopic(c, subscriber, appName+"/"+streamKey, stop)
+	close(finished)
+	if err != nil {
+		logging.Error("websockt write mesage error: ", err)
+		return 0, false
+	}
+	select {
+	case offset := <-seek:
+		return offset, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,167 @@
+package relay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+	"github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+func (s *Server) publishHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName := vars["app_name"]
+	streamKey := vars["stream_key"]
+
+	// logging.Infof("publish stream %v / %v", app_name, stream_key)
+	if r.Body != nil {
+		logging.Debugf("publishing stream %v / %v from %v", appName, streamKey, r.RemoteAddr)
+		private, _ := strconv.ParseBool(r.URL.Query().Get("private"))
+		p := &Publish{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Private: private, Transport: "http", Request: r, StartedAt: time.Now()}
+		if err := s.startPublish(p); err != nil {
+			refuse(w, err)
+			return
+		}
+		stream, unpublish := s.publish(p)
+		defer unpublish()
+		go terminateOnRequest(w, r, stream)
+
+		if status, message := s.endIngest(p, stream, s.ingest(p, stream, r.Body)); status != 0 {
+			w.Header().Set("Connection", "close")
+			http.Error(w, message, status)
+		}
+		return
+	}
+	defer r.Body.Close()
+	w.WriteHeader(200)
+	flusher := w.(http.Flusher)
+	flusher.Flush()
+
+}
+
+// the close codes of the websocket publishers are this base plus the HTTP
+// status of the error, like 4410 when the stream is terminated
+const closeStatusBase = 4000
+
+// publishWebsocketHandler takes a stream published as binary messages over
+// a websocket, the relay closes it with closeStatusBase plus the status an
+// HTTP publisher would get.
+func (s *Server) publishWebsocketHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName := vars["app_name"]
+	streamKey := vars["stream_key"]
+
+	private, _ := strconv.ParseBool(r.URL.Query().Get("private"))
+	p := &Publish{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Private: private, Transport: "websocket", Request: r, StartedAt: time.Now()}
+	if err := s.startPublish(p); err != nil {
+		refuse(w, err)
+		return
+	}
+
+	c, ok := websocket.TryUpgrade(w, r)
+	if !ok {
+		logging.Error("[ws] upgrade failed")
+		return
+	}
+	defer c.Close()
+
+	logging.Debugf("publishing stream %v / %v from %v over websocket", appName, streamKey, r.RemoteAddr)
+	stream, unpublish := s.publish(p)
+	defer unpublish()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stream.Terminated():
+			c.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if status, message := s.endIngest(p, stream, s.ingest(p, stream, c)); status != 0 {
+		c.WriteClose(closeStatusBase+status, message)
+	}
+}
+
+var errTerminated = errors.New("terminated by an administrator")
+
+// endIngest logs why the publisher of a stream stopped and tells the hooks,
+// and returns the HTTP status and message to tell it, 0 when it went away.
+func (s *Server) endIngest(p *Publish, stream *streams.Stream, err error) (int, string) {
+	if err == io.EOF || websocket.IsNormalClose(err) {
+		s.endPublish(p, nil)
+	} else {
+		s.endPublish(p, err)
+	}
+
+	var v *streams.Violation
+	var veto *vetoError
+	switch {
+	case errors.As(err, &v):
+		logging.Warningf("[stream] reject %v / %v from %v: %v", stream.App, stream.Key, stream.RemoteAddr, v)
+		return v.Status, v.Message
+	case errors.As(err, &veto):
+		logging.Infof("[stream] stop %v / %v from %v: %v", stream.App, stream.Key, stream.RemoteAddr, veto)
+		return vetoStatus(veto.err)
+	case err == errTerminated:
+		logging.Infof("[stream] terminated %v / %v from %v", stream.App, stream.Key, stream.RemoteAddr)
+		return http.StatusGone, err.Error()
+	}
+	logging.Error("[stream][recv] error:", err)
+	return 0, ""
+}
+
+// ingest relays what a publisher sends until it fails, which is
+// errTerminated when the stream was terminated, a *streams.Violation when
+// the stream breaks the policy of its app and a *vetoError when a hook
+// stopped it.
+func (s *Server) ingest(p *Publish, stream *streams.Stream, body io.Reader) error {
+	topic := stream.Topic()
+	if s.dvr != nil {
+		defer s.dvr.End(topic)
+	}
+	if s.segmenter != nil {
+		defer s.segmenter.End(topic)
+	}
+	defer s.broker.Reset(topic)
+
+	aligner := &mpegts.Aligner{}
+	buf := make([]byte, 1024*1024)
+	for {
+		n, err := body.Read(buf)
+		if err != nil {
+			select {
+			case <-stream.Terminated():
+				return errTerminated
+			default:
+				return err
+			}
+		}
+		// the subscribers keep the packets after Broadcast returns
+		if data := aligner.Push(buf[:n]); len(data) > 0 {
+			if err := s.publishData(p, data); err != nil {
+				return err
+			}
+			now := time.Now()
+			stream.Write(now, data)
+			if v := stream.Check(now); v != nil {
+				return v
+			}
+			if s.dvr != nil {
+				s.dvr.Write(topic, data)
+			}
+			if s.segmenter != nil {
+				s.segmenter.Write(topic, data)
+			}
+			for _, chunk := range mpegts.SplitKeyframes(data) {
+				s.broker.BroadcastFrame(chunk.Data, chunk.Keyframe, topic)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+func TestPublishPolicy(t *testing.T) {
+	_, url := newTestServer(t, Options{Policies: map[string]streams.Policy{"small": {MaxWidth: 32}}})
+	data := testStream(t, 25)
+
+	tests := []struct {
+		app    string
+		status int
+	}{
+		{"small", http.StatusUnprocessableEntity},
+		{"live", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(url+"/publish/"+tt.app+"/news", "video/mp2t", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%v: got status %v, want %v: %s", tt.app, resp.StatusCode, tt.status, body)
+		}
+		if tt.status != http.StatusOK && !strings.Contains(string(body), "width 64 exceeds the limit of 32") {
+			t.Errorf("%v: got %q", tt.app, body)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/record"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Error("[api] write response error: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.Schedules())
+}
+
+func (s *Server) addScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var sched record.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sched, err := s.scheduler.AddSchedule(sched)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	logging.Infof("schedule %v added for %v", sched.ID, sched.Topic())
+	writeJSON(w, http.StatusCreated, sched)
+}
+
+func (s *Server) removeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := s.scheduler.RemoveSchedule(id); err == record.ErrNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listRecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.Recordings())
+}
+
+func (s *Server) listMarkersHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	list, err := s.markers.List(vars["app_name"], vars["stream_key"])
+	if errors.Is(err, record.ErrInvalidName) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// addMarkerHandler drops a marker at the current time, or retroactively
+// when the body has an "at" time.
+func (s *Server) addMarkerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var req struct {
+		Name string    `json:"name"`
+		At   time.Time `json:"at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.At.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, errors.New("a marker can't be in the future"))
+		return
+	}
+
+	marker, err := s.markers.Add(vars["app_name"], vars["stream_key"], req.Name, req.At)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, marker)
+}
+
+func (s *Server) removeMarkerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := s.markers.Remove(vars["app_name"], vars["stream_key"], vars["id"]); err == record.ErrNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if errors.Is(err, record.ErrInvalidName) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
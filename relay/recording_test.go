@@ -0,0 +1,58 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/record"
+)
+
+func TestMarkersAPI(t *testing.T) {
+	_, url := newTestServer(t, Options{AdminToken: "s3cret"})
+	markers := url + "/api/streams/live/news/markers"
+
+	tests := []struct {
+		method, url, token, body string
+		status                   int
+	}{
+		{"POST", markers, "", `{"name":"kickoff"}`, http.StatusUnauthorized},
+		{"POST", markers, "wrong", `{"name":"kickoff"}`, http.StatusUnauthorized},
+		{"POST", markers, "s3cret", `{"name":""}`, http.StatusBadRequest},
+		{"POST", markers, "s3cret", `{"name":"kickoff","at":"2999-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"POST", markers, "s3cret", `{"name":"kickoff"}`, http.StatusCreated},
+		{"GET", markers, "", "", http.StatusOK},
+		{"DELETE", markers + "/unknown", "", "", http.StatusUnauthorized},
+		{"DELETE", markers + "/unknown", "s3cret", "", http.StatusNotFound},
+		{"GET", url + "/api/recordings", "", "", http.StatusUnauthorized},
+		{"GET", url + "/api/recordings", "s3cret", "", http.StatusOK},
+		{"GET", url + "/api/events", "", "", http.StatusUnauthorized},
+		{"GET", url + "/api/events", "s3cret", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, body := apiRequest(t, tt.method, tt.url, tt.token, tt.body); status != tt.status {
+			t.Errorf("%v %v: got status %v, want %v: %s", tt.method, tt.url, status, tt.status, body)
+		}
+	}
+
+	// the marker added is listed, then removed
+	_, body := apiRequest(t, "GET", markers, "", "")
+	var list []record.Marker
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "kickoff" {
+		t.Fatalf("got %+v", list)
+	}
+	if status, _ := apiRequest(t, "DELETE", markers+"/"+list[0].ID, "s3cret", ""); status != http.StatusNoContent {
+		t.Errorf("got status %v on removal", status)
+	}
+}
+
+func TestMarkersAPIDisabled(t *testing.T) {
+	_, url := newTestServer(t, Options{})
+	status, _ := apiRequest(t, "POST", url+"/api/streams/live/news/markers", "s3cret", `{"name":"kickoff"}`)
+	if status != http.StatusForbidden {
+		t.Errorf("got status %v without an admin token", status)
+	}
+}
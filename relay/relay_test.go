@@ -0,0 +1,133 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/client"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+// newTestServer serves a relay with the options on a local port, its
+// recordings going to a temporary directory.
+func newTestServer(t *testing.T, opts Options) (*Server, string) {
+	t.Helper()
+	if opts.RecordDir == "" {
+		opts.RecordDir = t.TempDir()
+	}
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts.URL
+}
+
+// apiRequest sends a request with an admin token, when not empty, and
+// returns the status and the body of the response.
+func apiRequest(t *testing.T, method, url, token, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// testStream returns pictures of the test pattern with their audio, a group
+// of pictures lasting a second of 25 pictures.
+func testStream(t *testing.T, pictures int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < pictures; i++ {
+		if err := gen.WriteFrame(clock.Add(time.Duration(i) * gen.FrameDuration())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// keyframes returns the offsets of the keyframe packets of a stream.
+func keyframes(data []byte) []int {
+	var offsets []int
+	for i, p := range mpegts.Packets(data) {
+		if mpegts.IsKeyframe(p) {
+			offsets = append(offsets, i*mpegts.PacketSize)
+		}
+	}
+	return offsets
+}
+
+// publishTest publishes data to a topic over a websocket, the stream stays
+// live until the publisher is closed.
+func publishTest(t *testing.T, baseURL, app, key string, data []byte) *client.Publisher {
+	t.Helper()
+	p, err := client.NewPublisher(baseURL, app, key, client.PublisherOptions{Transport: client.WebSocket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// readFull reads n bytes from a player, failing after 5 seconds.
+func readFull(t *testing.T, r io.Reader, n int) []byte {
+	t.Helper()
+	type result struct {
+		b   []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		done <- result{b, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		return res.b
+	case <-time.After(5 * time.Second):
+		t.Fatalf("read less than %d bytes in 5s", n)
+	}
+	return nil
+}
+
+// waitFor polls a condition for up to 5 seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+	}
+}
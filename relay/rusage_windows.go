@@ -0,0 +1,10 @@
+package relay
+
+import (
+	"time"
+)
+
+// processCPUTime is not measured on windows.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,275 @@
+// Package relay is the jsmpeg-relay server, which can be embedded in other
+// programs: the streams published to a Server are relayed to its viewers
+// over websockets, HTTP and HLS, recorded and sent to UDP outputs.
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	gctx "github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/egress"
+	"github.com/numb3r3/jsmpeg-relay/hls"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+	"github.com/numb3r3/jsmpeg-relay/record"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+	"github.com/numb3r3/jsmpeg-relay/timeshift"
+)
+
+var errStarted = errors.New("relay: server already started")
+
+// Options describes a relay server, the zero durations and sizes disable
+// their feature: start from DefaultOptions.
+type Options struct {
+	// Addrs are the addresses the server listens on, none when the handler
+	// is served by the program embedding the relay.
+	Addrs  []string
+	Broker pubsub.Config
+
+	RecordDir   string        // the schedules, history and files of the recordings
+	Timeshift   time.Duration // of every live stream kept for timeshift playback
+	HLSDuration time.Duration // the target duration of the HLS segments
+	HLSWindow   int           // the number of segments in HLS playlists
+
+	Outputs  []egress.Config
+	Policies map[string]streams.Policy // by app, "*" for all apps
+
+	// AdminToken is the bearer token of the admin API, which is disabled
+	// without it. The publishers and viewers are authorized by hooks.
+	AdminToken string
+	Hooks      []Hook
+
+	// Apps are the settings of the apps by name, the undeclared apps are
+	// refused in strict mode.
+	Apps   map[string]AppOptions
+	Strict bool
+
+	// Debug serves the profiles of net/http/pprof under /debug/pprof.
+	Debug bool
+}
+
+// DefaultOptions are the options of the jsmpeg-relay command.
+var DefaultOptions = Options{
+	Addrs:       []string{"0.0.0.0:8080"},
+	Broker:      pubsub.DefaultConfig,
+	RecordDir:   "./recordings",
+	Timeshift:   time.Minute,
+	HLSDuration: 2 * time.Second,
+	HLSWindow:   6,
+	Debug:       true,
+}
+
+// Server relays the streams of its publishers to its viewers.
+type Server struct {
+	opts      Options
+	startedAt time.Time
+
+	broker    *pubsub.Broker
+	registry  *streams.Registry
+	dvr       *timeshift.Store // nil when disabled
+	segmenter *hls.Store       // nil when disabled
+	scheduler *record.Scheduler
+	markers   *record.Markers
+	outputs   *egress.Manager
+	bans      *banList
+	handler   http.Handler
+
+	slateLock sync.Mutex
+	slates    map[string]*slate // by topic
+
+	mu  sync.Mutex // of srv
+	srv *http.Server
+}
+
+// create a new server, which is idle until Start is called
+func New(opts Options) (*Server, error) {
+	for _, h := range opts.Hooks {
+		if err := checkHook(h); err != nil {
+			return nil, err
+		}
+	}
+	s := &Server{
+		opts:      opts,
+		startedAt: time.Now(),
+		broker:    pubsub.NewBrokerConfig(opts.Broker),
+		registry:  streams.NewRegistry(),
+		markers:   record.NewMarkers(opts.RecordDir),
+		bans:      &banList{bans: map[string]Ban{}},
+		slates:    map[string]*slate{},
+	}
+	if opts.Timeshift > 0 {
+		s.dvr = timeshift.NewStore(opts.Timeshift)
+	}
+	if opts.HLSWindow > 0 {
+		s.segmenter = hls.NewStore(opts.HLSDuration, opts.HLSWindow)
+	}
+	for app, policy := range opts.Policies {
+		s.registry.SetPolicy(app, policy)
+	}
+	s.registry.OnEvent(logEvent)
+
+	var err error
+	if s.scheduler, err = record.NewScheduler(s.broker, opts.RecordDir); err != nil {
+		return nil, err
+	}
+	s.outputs = egress.NewManager(s.broker)
+	s.handler = gctx.ClearHandler(s.router())
+	return s, nil
+}
+
+// to get the broker relaying the topics to the viewers
+func (s *Server) Broker() *pubsub.Broker {
+	return s.broker
+}
+
+// to get the registry of the streams and their viewers
+func (s *Server) Registry() *streams.Registry {
+	return s.registry
+}
+
+// Handler serves the routes of the relay, for the programs serving it on
+// their own listeners.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Start starts the recordings, the outputs and the health monitor of the
+// streams, then serves the handler on the addresses of the options.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return errStarted
+	}
+
+	var listeners []net.Listener
+	for _, addr := range s.opts.Addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	for _, cfg := range s.opts.Outputs {
+		if _, err := s.outputs.Add(cfg); err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			s.outputs.Close()
+			return fmt.Errorf("output %v to %v: %v", cfg.Topic, cfg.Addr, err)
+		}
+	}
+	s.scheduler.Run()
+	s.registry.Run()
+
+	s.srv = &http.Server{
+		// Good practice to set timeouts to avoid Slowloris attacks.
+		WriteTimeout: time.Second * 0,
+		ReadTimeout:  time.Second * 0,
+		IdleTimeout:  time.Second * 60,
+		Handler:      s.handler,
+	}
+	for _, l := range listeners {
+		logging.Infof("server listen @ %v", l.Addr())
+		go func(l net.Listener) {
+			if err := s.srv.Serve(l); err != http.ErrServerClosed {
+				logging.Error("server listen error:", err)
+			}
+		}(l)
+	}
+	return nil
+}
+
+// Shutdown stops listening and waits for the connections to finish until
+// the context is done, then stops the recordings, the outputs and the
+// health monitor.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv == nil {
+		return nil
+	}
+	err := s.srv.Shutdown(ctx)
+	s.slateLock.Lock()
+	topics := make([]string, 0, len(s.slates))
+	for topic := range s.slates {
+		topics = append(topics, topic)
+	}
+	s.slateLock.Unlock()
+	for _, topic := range topics {
+		s.stopSlate(topic)
+	}
+	s.scheduler.Close()
+	s.outputs.Close()
+	s.registry.Close()
+	return err
+}
+
+func (s *Server) router() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/publish/{app_name}/{stream_key}", s.notBanned(s.publishHandler)).Methods("POST")
+	r.HandleFunc("/publish/{app_name}/{stream_key}", s.notBanned(s.publishWebsocketHandler)).Methods("GET")
+	r.HandleFunc("/play/{app_name}/{stream_key}", s.notBanned(s.playHandler))
+	r.HandleFunc("/live/{app_name}/{stream_key}.ts", s.notBanned(s.liveTSHandler)).Methods("GET")
+	r.HandleFunc("/audio/{app_name}/{stream_key}.mp2", s.notBanned(s.audioHandler)).Methods("GET")
+	r.HandleFunc("/vod/{recording_id}", s.notBanned(s.vodHandler))
+	r.HandleFunc("/hls/{app_name}/{stream_key}/index.m3u8", s.notBanned(s.hlsPlaylistHandler)).Methods("GET")
+	r.HandleFunc("/hls/{app_name}/{stream_key}/{seq:[0-9]+}.ts", s.notBanned(s.hlsSegmentHandler)).Methods("GET")
+	r.HandleFunc("/clip/{app_name}/{stream_key}.ts", s.notBanned(s.clipHandler)).Methods("GET")
+	r.HandleFunc("/api/schedules", s.adminAuth(s.listSchedulesHandler)).Methods("GET")
+	r.HandleFunc("/api/schedules", s.adminAuth(s.addScheduleHandler)).Methods("POST")
+	r.HandleFunc("/api/schedules/{id}", s.adminAuth(s.removeScheduleHandler)).Methods("DELETE")
+	r.HandleFunc("/api/recordings", s.adminAuth(s.listRecordingsHandler)).Methods("GET")
+	r.HandleFunc("/api/outputs", s.adminAuth(s.listOutputsHandler)).Methods("GET")
+	r.HandleFunc("/api/outputs", s.adminAuth(s.addOutputHandler)).Methods("POST")
+	r.HandleFunc("/api/outputs/{id}", s.adminAuth(s.removeOutputHandler)).Methods("DELETE")
+	r.HandleFunc("/watch/{app_name}/{stream_key}", s.notBanned(s.watchHandler)).Methods("GET")
+	r.HandleFunc("/static/jsmpeg.min.js", jsmpegHandler).Methods("GET")
+	r.HandleFunc("/streams", s.directoryHandler).Methods("GET")
+	r.HandleFunc("/api/streams", s.listStreamsHandler).Methods("GET")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/info", s.notBanned(s.streamInfoHandler)).Methods("GET")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/health", s.notBanned(s.streamHealthHandler)).Methods("GET")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/alarms", s.notBanned(s.streamAlarmsHandler)).Methods("GET")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/snapshot", s.notBanned(s.streamSnapshotHandler)).Methods("GET")
+	r.HandleFunc("/api/events", s.adminAuth(s.listEventsHandler)).Methods("GET")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/markers", s.listMarkersHandler).Methods("GET")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/markers", s.adminAuth(s.addMarkerHandler)).Methods("POST")
+	r.HandleFunc("/api/streams/{app_name}/{stream_key}/markers/{id}", s.adminAuth(s.removeMarkerHandler)).Methods("DELETE")
+	r.HandleFunc("/api/admin/topics", s.adminAuth(s.adminTopicsHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/topics/{app_name}/{stream_key}/viewers", s.adminAuth(s.adminViewersHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/viewers", s.adminAuth(s.adminViewersHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/viewers/{id}", s.adminAuth(s.adminKickHandler)).Methods("DELETE")
+	r.HandleFunc("/api/admin/streams/{app_name}/{stream_key}", s.adminAuth(s.adminTerminateHandler)).Methods("DELETE")
+	r.HandleFunc("/api/admin/broker", s.adminAuth(s.adminBrokerHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/runtime", s.adminAuth(s.adminRuntimeHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/testsrc/{app_name}/{stream_key}", s.adminAuth(s.adminTestSourceHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/bans", s.adminAuth(s.adminListBansHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/bans", s.adminAuth(s.adminAddBanHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/bans/{addr}", s.adminAuth(s.adminRemoveBanHandler)).Methods("DELETE")
+	if !s.opts.Debug {
+		return r
+	}
+	r.HandleFunc("/debug/pprof/", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// Manually add support for paths linked to by index page at /debug/pprof/
+	r.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+	r.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+	r.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
+	r.Handle("/debug/pprof/block", pprof.Handler("block"))
+	return r
+}
@@ -0,0 +1,131 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+var errNotLive = errors.New("stream is not live")
+
+// liveStream returns the live stream of a request once the viewer passed
+// the secret and origin checks of its app, nil after writing the error.
+func (s *Server) liveStream(w http.ResponseWriter, r *http.Request) *streams.Stream {
+	vars := mux.Vars(r)
+	if err := s.checkApp(vars["app_name"], r, false); err != nil {
+		status, message := vetoStatus(err)
+		writeError(w, status, errors.New(message))
+		return nil
+	}
+	stream := s.registry.Get(vars["app_name"], vars["stream_key"])
+	if stream == nil {
+		writeError(w, http.StatusNotFound, errNotLive)
+	}
+	return stream
+}
+
+func (s *Server) streamInfoHandler(w http.ResponseWriter, r *http.Request) {
+	stream := s.liveStream(w, r)
+	if stream == nil {
+		return
+	}
+	status := stream.Status()
+	status.RemoteAddr = ""
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) streamHealthHandler(w http.ResponseWriter, r *http.Request) {
+	stream := s.liveStream(w, r)
+	if stream == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, stream.Health())
+}
+
+func (s *Server) streamAlarmsHandler(w http.ResponseWriter, r *http.Request) {
+	stream := s.liveStream(w, r)
+	if stream == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, stream.Alarms())
+}
+
+// streamSnapshotHandler returns the latest keyframe as an MPEG-1 elementary
+// stream, or as a JPEG image with format=jpeg.
+func (s *Server) streamSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName, streamKey := vars["app_name"], vars["stream_key"]
+	p := &Play{App: appName, Key: streamKey, RemoteAddr: r.RemoteAddr, Protocol: "snapshot", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+	stream := s.registry.Get(appName, streamKey)
+	if stream == nil {
+		writeError(w, http.StatusNotFound, errNotLive)
+		return
+	}
+
+	var data []byte
+	var at time.Time
+	var err error
+	contentType, ext := "video/mpeg", "mpg"
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "mpg":
+		var snapshot *streams.Snapshot
+		if snapshot, err = stream.Snapshot(); err == nil {
+			data, at = snapshot.Data, snapshot.At
+		}
+	case "jpeg", "jpg":
+		contentType, ext = "image/jpeg", "jpg"
+		data, at, err = stream.Thumbnail()
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q", format))
+		return
+	}
+	switch err {
+	case nil:
+	case streams.ErrNoKeyframe:
+		writeError(w, http.StatusNotFound, err)
+		return
+	default:
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", appName+"-"+streamKey+"."+ext))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Last-Modified", at.UTC().Format(http.TimeFormat))
+	w.Write(data)
+}
+
+// listEventsHandler lists the recent events, of an app or a stream given by
+// the app and key parameters.
+func (s *Server) listEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	writeJSON(w, http.StatusOK, s.registry.Events(query.Get("app"), query.Get("key")))
+}
+
+// logEvent reports the stream events in the log.
+func logEvent(e streams.Event) {
+	switch {
+	case e.Type == streams.EventAlarm && e.Alarm.End == nil:
+		logging.Warningf("[stream] %v / %v alarm %v since %v", e.App, e.Key, e.Alarm.Type, e.Alarm.Start.Format(time.RFC3339))
+	case e.Type == streams.EventAlarm:
+		logging.Infof("[stream] %v / %v alarm %v ended after %v", e.App, e.Key, e.Alarm.Type, e.Alarm.End.Sub(e.Alarm.Start).Truncate(time.Second))
+	case e.Type != streams.EventHealth:
+		logging.Infof("[stream] %v %v / %v", e.Type, e.App, e.Key)
+	case e.State == streams.StateOK:
+		logging.Infof("[stream] %v / %v is %v again", e.App, e.Key, e.State)
+	default:
+		logging.Warningf("[stream] %v / %v is %v: %v", e.App, e.Key, e.State, strings.Join(e.Reasons, ", "))
+	}
+}
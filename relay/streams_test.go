@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/streams"
+)
+
+func TestStreamInfo(t *testing.T) {
+	s, url := newTestServer(t, Options{Apps: map[string]AppOptions{"private": {PlaySecret: "view"}}})
+	publishTest(t, url, "live", "news", testStream(t, 50))
+	publishTest(t, url, "private", "news", testStream(t, 50))
+	waitFor(t, "the publishers", func() bool {
+		return len(s.registry.List()) == 2 && s.registry.Get("live", "news").Status().BytesIn > 0
+	})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/streams/live/news/info", http.StatusOK},
+		{"/api/streams/live/news/health", http.StatusOK},
+		{"/api/streams/live/news/alarms", http.StatusOK},
+		{"/api/streams/live/other/info", http.StatusNotFound},
+		{"/api/streams/private/news/info", http.StatusUnauthorized},
+		{"/api/streams/private/news/health", http.StatusUnauthorized},
+		{"/api/streams/private/news/alarms", http.StatusUnauthorized},
+		{"/api/streams/private/news/info?secret=view", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, body := apiRequest(t, "GET", url+tt.path, "", ""); status != tt.status {
+			t.Errorf("%v: got status %v, want %v: %s", tt.path, status, tt.status, body)
+		}
+	}
+
+	// the information of the stream doesn't give away its publisher
+	_, body := apiRequest(t, "GET", url+"/api/streams/live/news/info", "", "")
+	var status streams.Status
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.RemoteAddr != "" || status.App != "live" || status.Key != "news" || status.Info.Video == nil || status.Info.Video.Width != 64 {
+		t.Errorf("got %+v", status)
+	}
+}
+
+func TestStreamSnapshot(t *testing.T) {
+	s, url := newTestServer(t, Options{})
+	publishTest(t, url, "live", "news", testStream(t, 30))
+	waitFor(t, "the keyframe", func() bool {
+		stream := s.registry.Get("live", "news")
+		if stream == nil {
+			return false
+		}
+		_, err := stream.Snapshot()
+		return err == nil
+	})
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/api/streams/live/news/snapshot", http.StatusOK, "video/mpeg"},
+		{"/api/streams/live/news/snapshot?format=jpeg", http.StatusOK, "image/jpeg"},
+		{"/api/streams/live/news/snapshot?format=png", http.StatusBadRequest, "application/json"},
+		{"/api/streams/live/other/snapshot", http.StatusNotFound, "application/json"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(url + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); resp.StatusCode != tt.status || ct != tt.contentType {
+			t.Errorf("%v: got status %v, content type %q", tt.path, resp.StatusCode, ct)
+		}
+	}
+}
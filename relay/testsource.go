@@ -0,0 +1,91 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+// the remote address of the streams published by the relay itself
+const testSourceAddr = "testsrc"
+
+var errAlreadyLive = errors.New("stream is already live")
+
+// TestSource describes a test pattern published by the relay.
+type TestSource struct {
+	Topic    string          `json:"topic"`
+	Options  testsrc.Options `json:"options"`
+	Duration string          `json:"duration,omitempty"`
+}
+
+// adminTestSourceHandler publishes a test pattern to a topic, given the
+// testsrc options and a duration like {"width": 640, "height": 360,
+// "duration": "1m"}, until the stream is terminated without duration.
+func (s *Server) adminTestSourceHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appName, streamKey := vars["app_name"], vars["stream_key"]
+	var req struct {
+		testsrc.Options
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid duration: "+req.Duration))
+			return
+		}
+		duration = d
+	}
+	if s.registry.Get(appName, streamKey) != nil {
+		writeError(w, http.StatusConflict, errAlreadyLive)
+		return
+	}
+
+	pr, pw := io.Pipe()
+	gen, err := testsrc.New(pw, req.Options)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	p := &Publish{App: appName, Key: streamKey, RemoteAddr: testSourceAddr, Transport: "testsrc", Request: r, StartedAt: time.Now()}
+	if err := s.startPublish(p); err != nil {
+		status, _ := vetoStatus(err)
+		writeError(w, status, err)
+		return
+	}
+	stream, unpublish := s.publish(p)
+	logging.Infof("[admin] publish test pattern to %v", stream.Topic())
+	go func() {
+		pw.CloseWithError(gen.Run(stream.Terminated(), duration))
+	}()
+	go func() {
+		defer unpublish()
+		err := s.ingest(p, stream, pr)
+		// stops the generator when the stream is rejected
+		pr.CloseWithError(err)
+		if err == io.EOF {
+			s.endPublish(p, nil)
+		} else {
+			s.endPublish(p, err)
+		}
+		switch err {
+		case io.EOF:
+		case errTerminated:
+			logging.Infof("[stream] terminated test pattern %v", stream.Topic())
+		default:
+			logging.Warningf("[stream] test pattern %v stopped: %v", stream.Topic(), err)
+		}
+	}()
+	writeJSON(w, http.StatusCreated, TestSource{Topic: stream.Topic(), Options: gen.Options(), Duration: req.Duration})
+}
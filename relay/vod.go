@@ -0,0 +1,132 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+	"github.com/numb3r3/jsmpeg-relay/record"
+	"github.com/numb3r3/jsmpeg-relay/vod"
+	"github.com/numb3r3/jsmpeg-relay/websocket"
+)
+
+func (s *Server) vodHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["recording_id"]
+
+	rec, err := s.scheduler.Recording(id)
+	if err == record.ErrNotFound {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p := &Play{App: rec.App, Key: rec.Key, RemoteAddr: r.RemoteAddr, Protocol: "vod", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+
+	player, err := vod.Open(rec)
+	if err != nil {
+		logging.Error("[vod] open error: ", err)
+		http.Error(w, "recording unavailable", http.StatusInternalServerError)
+		return
+	}
+	defer player.Close()
+
+	c, ok := websocket.TryUpgrade(w, r)
+	if !ok {
+		logging.Error("[ws] upgrade failed")
+		return
+	}
+	defer c.Close()
+
+	logging.Infof("[vod] play recording %v (%v) for %v", id, player.Duration(), c.RemoteAddr())
+	done := make(chan struct{})
+	defer close(done)
+	if s.playRecording(c, rec, player, readControls(c, done)) {
+		// for the players to tell the end from a failure
+		c.WriteClose(closeNormal, "end of recording")
+	}
+}
+
+// the close code of a websocket whose stream ended
+const closeNormal = 1000
+
+// playRecording sends the recording at real-time pace, following the
+// seek, pause and resume controls of the viewer, until the viewer leaves
+// or the recording ends, which returns true.
+func (s *Server) playRecording(c viewer, rec record.Recording, player *vod.Player, controls <-chan *websocket.Control) bool {
+	paused := false
+	var chunk []byte
+	var delay time.Duration
+	for {
+		var due <-chan time.Time
+		if !paused {
+			if chunk == nil {
+				var err error
+				if chunk, delay, err = player.Next(); err == io.EOF {
+					logging.Debug("[vod] end of recording")
+					return true
+				} else if err != nil {
+					logging.Error("[vod] read error: ", err)
+					return false
+				}
+			}
+			due = time.After(delay)
+		}
+
+		select {
+		case <-c.Closing():
+			return false
+		case ctl, ok := <-controls:
+			if !ok {
+				return false
+			}
+			switch ctl.Cmd {
+			case websocket.ControlPause:
+				paused = true
+			case websocket.ControlResume:
+				if paused {
+					paused, delay = false, 0
+					player.Resume()
+				}
+			case websocket.ControlSeek:
+				if err := s.seekRecording(rec, player, ctl); err != nil {
+					logging.Error("[vod] seek error: ", err)
+					continue
+				}
+				chunk = nil
+			}
+		case <-due:
+			if _, err := c.Write(chunk); err != nil {
+				logging.Error("websockt write mesage error: ", err)
+				return false
+			}
+			chunk = nil
+		}
+	}
+}
+
+// seekRecording moves the player to the position or the marker of the control.
+func (s *Server) seekRecording(rec record.Recording, player *vod.Player, ctl *websocket.Control) error {
+	if ctl.Marker != "" {
+		marker, err := s.markers.Find(rec.App, rec.Key, ctl.Marker)
+		if err != nil {
+			return fmt.Errorf("marker %q: %v", ctl.Marker, err)
+		}
+		return player.SeekAt(marker.At)
+	}
+
+	position, err := time.ParseDuration(ctl.Position)
+	if err != nil {
+		return fmt.Errorf("invalid position %q", ctl.Position)
+	}
+	return player.Seek(position)
+}
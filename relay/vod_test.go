@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/client"
+)
+
+func TestPlayRecording(t *testing.T) {
+	s, url := newTestServer(t, Options{})
+	rec, err := s.scheduler.Record("live", "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := testStream(t, 30)
+	publishTest(t, url, "live", "news", data)
+	waitFor(t, "the recording", func() bool {
+		rec, _ = s.scheduler.Recording(rec.ID)
+		return rec.Bytes == int64(len(data))
+	})
+	if err := s.scheduler.Stop(rec.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := client.PlayRecording(url, rec.ID, client.PlayerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	got := readFull(t, p, len(data))
+	if !bytes.Equal(got, data) {
+		t.Fatal("the recording played differs from the stream published")
+	}
+	if _, err := p.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("got %v at the end of the recording", err)
+	}
+
+	resp, err := http.Get(url + "/vod/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("got status %v for a missing recording", resp.StatusCode)
+	}
+}
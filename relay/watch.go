@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/numb3r3/jsmpeg-relay/log"
+)
+
+// the jsmpeg bundle served to the players
+//
+//go:embed jsmpeg.min.js
+var jsmpegBundle []byte
+
+// the bundle is as old as the binary
+var bundleTime = time.Now()
+
+func jsmpegHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "jsmpeg.min.js", bundleTime, bytes.NewReader(jsmpegBundle))
+}
+
+var playerTemplate = template.Must(template.New("player").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<title>{{.App}}/{{.Key}}</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<style type="text/css">
+		html, body {
+			margin: 0;
+			height: 100%;
+			background-color: #111;
+		}
+		canvas {
+			display: block;
+			width: 100%;
+			height: 100%;
+			object-fit: contain;
+		}
+	</style>
+</head>
+<body>
+	<canvas id="video-canvas"></canvas>
+	<script type="text/javascript" src="/static/jsmpeg.min.js"></script>
+	<script type="text/javascript">
+		var scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+		var url = scheme + location.host + {{.Path}};
+		var player = new JSMpeg.Player(url, {
+			canvas: document.getElementById('video-canvas'),
+			pauseWhenHidden: false,
+			audio: {{.Audio}},
+			videoBufferSize: {{.VideoBufferSize}},
+			audioBufferSize: {{.AudioBufferSize}}
+		});
+		if ({{.Audio}}) {
+			function onTouchStart () {
+				player.audioOut.unlock(function () {
+					player.volume = 1;
+				});
+				document.removeEventListener('touchstart', onTouchStart);
+			}
+			// try to unlock immediately, then by touchstart event
+			player.audioOut.unlock(function () {
+				player.volume = 1;
+			});
+			document.addEventListener('touchstart', onTouchStart, false);
+		}
+	</script>
+</body>
+</html>
+`))
+
+// watchHandler serves a player of a topic to the viewers allowed to play
+// it. The parameters buffer and audio-buffer set the buffer sizes in KB,
+// audio=0 mutes it and offset starts it behind live; the secret is passed
+// on to the stream.
+func (s *Server) watchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	p := &Play{App: vars["app_name"], Key: vars["stream_key"], RemoteAddr: r.RemoteAddr, Protocol: "watch", Request: r, StartedAt: time.Now()}
+	if err := s.startPlay(p); err != nil {
+		refuse(w, err)
+		return
+	}
+	defer s.endPlay(p)
+
+	data := struct {
+		App             string
+		Key             string
+		Path            string
+		Audio           bool
+		VideoBufferSize int
+		AudioBufferSize int
+	}{
+		App:             vars["app_name"],
+		Key:             vars["stream_key"],
+		Path:            "/play/" + vars["app_name"] + "/" + vars["stream_key"],
+		Audio:           true,
+		VideoBufferSize: 512 * 1024,
+		AudioBufferSize: 128 * 1024,
+	}
+	params := url.Values{}
+	if offset := query.Get("offset"); offset != "" {
+		if _, err := parseOffset(offset); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.Set("offset", offset)
+	}
+	if secret := query.Get("secret"); secret != "" {
+		params.Set("secret", secret)
+	}
+	if len(params) > 0 {
+		data.Path += "?" + params.Encode()
+	}
+	if audio := query.Get("audio"); audio != "" {
+		on, err := strconv.ParseBool(audio)
+		if err != nil {
+			http.Error(w, "invalid audio: "+audio, http.StatusBadRequest)
+			return
+		}
+		data.Audio = on
+	}
+	for param, size := range map[string]*int{"buffer": &data.VideoBufferSize, "audio-buffer": &data.AudioBufferSize} {
+		if value := query.Get(param); value != "" {
+			kb, err := strconv.Atoi(value)
+			if err != nil || kb <= 0 {
+				http.Error(w, "invalid "+param+": "+value, http.StatusBadRequest)
+				return
+			}
+			*size = kb * 1024
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := playerTemplate.Execute(w, data); err != nil {
+		logging.Error("[http] player error: ", err)
+	}
+}
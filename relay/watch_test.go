@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// playHook refuses the viewers of a key and counts the others.
+type playHook struct {
+	sync.Mutex
+	refused string
+	started []string
+	ended   int
+}
+
+func (h *playHook) Name() string {
+	return "play"
+}
+
+func (h *playHook) OnPlayStart(p *Play) error {
+	h.Lock()
+	defer h.Unlock()
+	if p.Key == h.refused {
+		return errors.New("refused by the hook")
+	}
+	h.started = append(h.started, p.Protocol)
+	return nil
+}
+
+func (h *playHook) OnPlayEnd(p *Play) {
+	h.Lock()
+	defer h.Unlock()
+	h.ended++
+}
+
+func TestWatch(t *testing.T) {
+	hook := &playHook{refused: "refused"}
+	_, url := newTestServer(t, Options{
+		Apps:  map[string]AppOptions{"private": {PlaySecret: "s3cret"}},
+		Hooks: []Hook{hook},
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		wsPath string // as escaped in the script of the page
+	}{
+		{"/watch/live/news", http.StatusOK, `"/play/live/news"`},
+		{"/watch/live/news?offset=-10s&audio=0", http.StatusOK, `"/play/live/news?offset=-10s"`},
+		{"/watch/live/news?offset=soon", http.StatusBadRequest, ""},
+		{"/watch/live/refused", http.StatusForbidden, ""},
+		{"/watch/private/news", http.StatusUnauthorized, ""},
+		{"/watch/private/news?secret=other", http.StatusUnauthorized, ""},
+		{"/watch/private/news?secret=s3cret&offset=-10s", http.StatusOK, `"/play/private/news?offset=-10s\u0026secret=s3cret"`},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(url + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.wsPath != "" && !strings.Contains(string(body), "location.host + "+tt.wsPath) {
+			t.Errorf("%v: the page does not play %v", tt.path, tt.wsPath)
+		}
+	}
+
+	hook.Lock()
+	defer hook.Unlock()
+	// the pages with invalid parameters were accepted by the hook first
+	if len(hook.started) != 4 || hook.ended != 4 || hook.started[0] != "watch" {
+		t.Errorf("got %v pages started and %v ended", hook.started, hook.ended)
+	}
+}
@@ -0,0 +1,188 @@
+package streams
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// the types of the alarms on the content of a stream
+const (
+	AlarmFrozenVideo  = "frozen_video"
+	AlarmAudioSilence = "audio_silence"
+)
+
+// the number of the alarms kept by a stream
+const maxAlarms = 32
+
+// a P or B picture smaller than the last I picture by this ratio carries
+// almost nothing but skipped macroblocks
+const staticPictureRatio = 50
+
+// Alarm is a period during which the content of a stream looked wrong.
+type Alarm struct {
+	Type  string     `json:"type"`
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// detector raises an alarm once a condition holds for long enough.
+type detector struct {
+	kind  string
+	since time.Time // when the condition started to hold, zero when it does not
+	until time.Time // when it stopped holding
+	alarm *Alarm
+}
+
+func (d *detector) observe(holds bool, now time.Time) {
+	switch {
+	case holds && d.since.IsZero():
+		d.since = now
+	case !holds && !d.since.IsZero():
+		d.since, d.until = time.Time{}, now
+	}
+}
+
+// update starts or ends the alarm, returning it when it did.
+func (d *detector) update(now time.Time, duration time.Duration) *Alarm {
+	switch {
+	case d.alarm == nil && !d.since.IsZero() && now.Sub(d.since) >= duration:
+		d.alarm = &Alarm{Type: d.kind, Start: d.since}
+		return d.alarm
+	case d.alarm != nil && d.since.IsZero():
+		alarm := d.alarm
+		end := d.until
+		alarm.End = &end
+		d.alarm = nil
+		return alarm
+	}
+	return nil
+}
+
+// contentMonitor looks for frozen video and silent audio in the elementary
+// streams.
+type contentMonitor struct {
+	demuxer   *mpegts.Demuxer
+	videoPID  int
+	audioPID  int
+	lastISize int
+	lastIHash uint64
+	frozen    detector
+	silence   detector
+	alarms    []*Alarm
+	keyframes keyframes
+}
+
+func newContentMonitor() *contentMonitor {
+	return &contentMonitor{
+		demuxer:  mpegts.NewDemuxer(),
+		videoPID: -1,
+		audioPID: -1,
+		frozen:   detector{kind: AlarmFrozenVideo},
+		silence:  detector{kind: AlarmAudioSilence},
+	}
+}
+
+func (m *contentMonitor) push(p mpegts.Packet, now time.Time, level float64) {
+	for _, pes := range m.demuxer.Push(p) {
+		// only the first video and audio streams are watched
+		switch {
+		case pes.Header.IsVideo() && (m.videoPID < 0 || m.videoPID == int(pes.PID)):
+			m.videoPID = int(pes.PID)
+			pictures := mpegts.Pictures(pes.Data)
+			for _, pic := range pictures {
+				m.frozen.observe(m.static(pic), now)
+			}
+			m.keyframes.push(pes.Data, pictures, now)
+		case pes.Header.IsAudio() && (m.audioPID < 0 || m.audioPID == int(pes.PID)):
+			m.audioPID = int(pes.PID)
+			m.listen(pes.Data, now, level)
+		}
+	}
+}
+
+// static tells whether a picture repeats the previous one.
+func (m *contentMonitor) static(pic mpegts.Picture) bool {
+	switch pic.Type {
+	case mpegts.PictureI:
+		h := fnv.New64a()
+		h.Write(pic.Slices())
+		sum := h.Sum64()
+		static := m.lastISize > 0 && sum == m.lastIHash
+		m.lastISize, m.lastIHash = len(pic.Data), sum
+		return static
+	case mpegts.PictureP, mpegts.PictureB:
+		return m.lastISize > 0 && len(pic.Data)*staticPictureRatio < m.lastISize
+	}
+	return false
+}
+
+// listen checks the level of the audio frames of the data.
+func (m *contentMonitor) listen(es []byte, now time.Time, level float64) {
+	for len(es) >= 4 {
+		h, offset, ok := mpegts.ParseAudioHeader(es)
+		if !ok || h.FrameSize == 0 {
+			return
+		}
+		es = es[offset:]
+		if peak, ok := mpegts.ScalefactorPeak(es); ok {
+			m.silence.observe(peak < level, now)
+		}
+		if h.FrameSize > len(es) {
+			return
+		}
+		es = es[h.FrameSize:]
+	}
+}
+
+// update starts and ends the alarms, returning the ones that did.
+func (m *contentMonitor) update(now time.Time, th Thresholds) []*Alarm {
+	var changed []*Alarm
+	for _, d := range []*detector{&m.frozen, &m.silence} {
+		duration := th.FreezeDuration
+		if d == &m.silence {
+			duration = th.SilenceDuration
+		}
+		if duration <= 0 {
+			continue
+		}
+		alarm := d.update(now, duration)
+		if alarm == nil {
+			continue
+		}
+		changed = append(changed, alarm)
+		if alarm.End == nil {
+			if len(m.alarms) >= maxAlarms {
+				m.alarms = append(m.alarms[:0], m.alarms[1:]...)
+			}
+			m.alarms = append(m.alarms, alarm)
+		}
+	}
+	return changed
+}
+
+// end ends the active alarms when the stream is gone, no new one is
+// raised by a later update.
+func (m *contentMonitor) end(now time.Time) []*Alarm {
+	var ended []*Alarm
+	for _, d := range []*detector{&m.frozen, &m.silence} {
+		d.since = time.Time{}
+		if d.alarm != nil {
+			end := now
+			d.alarm.End = &end
+			ended = append(ended, d.alarm)
+			d.alarm = nil
+		}
+	}
+	return ended
+}
+
+// to get a copy of the alarms, oldest first
+func (m *contentMonitor) list() []Alarm {
+	alarms := make([]Alarm, len(m.alarms))
+	for i, a := range m.alarms {
+		alarms[i] = *a
+	}
+	return alarms
+}
@@ -0,0 +1,123 @@
+package streams
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+// iPicture returns an I picture whose slices are filled with a byte.
+func iPicture(fill byte) []byte {
+	es := []byte{0, 0, 1, mpegts.StartCodePicture, 0, mpegts.PictureI << 3, 0xff, 0xf8, 0, 0, 1, 0x01}
+	return append(es, bytes.Repeat([]byte{fill}, 1000)...)
+}
+
+func TestFrozenVideo(t *testing.T) {
+	r := NewRegistry()
+	s := r.Publish("live", "news", "10.0.0.1:1234", "websocket", false)
+	var buf bytes.Buffer
+	m := mpegts.NewMuxer(&buf, mpegts.ElementaryStream{PID: 0x100, StreamType: mpegts.StreamTypeMPEG1Video})
+	start := time.Now()
+	write := func(at time.Time, es []byte) {
+		buf.Reset()
+		if err := m.WritePES(0x100, 0xe0, -1, -1, es); err != nil {
+			t.Fatal(err)
+		}
+		s.Write(at, buf.Bytes())
+	}
+
+	// the same picture for 6 seconds
+	var events []Event
+	for i := 0; i <= 30; i++ {
+		at := start.Add(time.Duration(i) * 200 * time.Millisecond)
+		write(at, iPicture(0xaa))
+		events = append(events, s.update(at)...)
+	}
+	alarms := s.Alarms()
+	if len(alarms) != 1 || alarms[0].Type != AlarmFrozenVideo || alarms[0].End != nil {
+		t.Fatalf("got alarms %+v", alarms)
+	}
+	if h := s.Health(); h.State != StateDegraded {
+		t.Errorf("got %+v with frozen video", h)
+	}
+
+	// a new picture ends the alarm, once the one after it is received
+	end := start.Add(7 * time.Second)
+	write(end, iPicture(0x55))
+	write(end.Add(200*time.Millisecond), iPicture(0x5a))
+	events = append(events, s.update(end.Add(200*time.Millisecond))...)
+	var states []string
+	for _, e := range events {
+		if e.Type == EventAlarm {
+			states = append(states, e.State)
+		}
+	}
+	if len(states) != 2 || states[0] != "active" || states[1] != "ended" {
+		t.Errorf("got alarm events %v", states)
+	}
+	if alarms := s.Alarms(); len(alarms) != 1 || alarms[0].End == nil {
+		t.Errorf("got alarms %+v after the end", alarms)
+	}
+}
+
+func TestAudioSilence(t *testing.T) {
+	tests := []struct {
+		mute  bool
+		alarm bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tt := range tests {
+		r := NewRegistry()
+		s := r.Publish("live", "news", "10.0.0.1:1234", "websocket", false)
+		var buf bytes.Buffer
+		gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48, Mute: tt.mute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		for i := 0; i < 7*25; i++ {
+			at := start.Add(time.Duration(i) * gen.FrameDuration())
+			buf.Reset()
+			if err := gen.WriteFrame(at); err != nil {
+				t.Fatal(err)
+			}
+			s.Write(at, buf.Bytes())
+			s.update(at)
+		}
+
+		var types []string
+		for _, a := range s.Alarms() {
+			types = append(types, a.Type)
+		}
+		if tt.alarm != (len(types) == 1 && types[0] == AlarmAudioSilence) || (!tt.alarm && len(types) > 0) {
+			t.Errorf("mute %v: got alarms %v", tt.mute, types)
+		}
+	}
+}
+
+func TestAlarmsEnd(t *testing.T) {
+	m := newContentMonitor()
+	start := time.Now()
+	m.silence.observe(true, start)
+	if alarms := m.update(start.Add(time.Second), DefaultThresholds); len(alarms) != 0 {
+		t.Errorf("got %+v before the duration", alarms)
+	}
+	if alarms := m.update(start.Add(5*time.Second), DefaultThresholds); len(alarms) != 1 {
+		t.Fatalf("got %+v after the duration", alarms)
+	}
+
+	// a stream gone ends its alarms
+	end := start.Add(6 * time.Second)
+	ended := m.end(end)
+	if len(ended) != 1 || ended[0].End == nil || !ended[0].End.Equal(end) {
+		t.Errorf("got %+v", ended)
+	}
+	if alarms := m.update(end, DefaultThresholds); len(alarms) != 0 {
+		t.Errorf("got %+v once ended", alarms)
+	}
+}
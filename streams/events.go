@@ -0,0 +1,60 @@
+package streams
+
+import (
+	"time"
+)
+
+// the types of the stream events
+const (
+	EventPublish   = "publish"
+	EventUnpublish = "unpublish"
+	EventHealth    = "health"
+	EventAlarm     = "alarm"
+)
+
+// the number of the recent events kept by the registry
+const maxEvents = 256
+
+// Event is a change in the life of a stream.
+type Event struct {
+	Type     string    `json:"type"`
+	App      string    `json:"app"`
+	Key      string    `json:"key"`
+	At       time.Time `json:"at"`
+	State    string    `json:"state,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+	Reasons  []string  `json:"reasons,omitempty"`
+	Alarm    *Alarm    `json:"alarm,omitempty"`
+}
+
+// OnEvent registers fn to be called with every event, it must not block.
+func (r *Registry) OnEvent(fn func(Event)) {
+	r.Lock()
+	defer r.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Events returns the recent events of a stream, or of all the streams when
+// app is empty, oldest first.
+func (r *Registry) Events(app, key string) []Event {
+	r.RLock()
+	defer r.RUnlock()
+	events := []Event{}
+	for _, e := range r.events {
+		if app == "" || (e.App == app && (key == "" || e.Key == key)) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// emit must be called with the lock held
+func (r *Registry) emit(e Event) {
+	if len(r.events) >= maxEvents {
+		r.events = append(r.events[:0], r.events[1:]...)
+	}
+	r.events = append(r.events, e)
+	for _, fn := range r.listeners {
+		fn(e)
+	}
+}
@@ -0,0 +1,172 @@
+package streams
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// the health states of a stream
+const (
+	StateOK       = "ok"
+	StateDegraded = "degraded"
+	StateStalled  = "stalled"
+)
+
+// Thresholds decide when a stream is degraded or stalled and when its
+// content raises alarms.
+type Thresholds struct {
+	StallTimeout    time.Duration `json:"stall_timeout"`    // without data
+	KeyframeTimeout time.Duration `json:"keyframe_timeout"` // without keyframe
+	MaxPCRJitter    time.Duration `json:"max_pcr_jitter"`   // between PCR and wall clock
+	ErrorWindow     time.Duration `json:"error_window"`     // a continuity or transport error degrades for
+	FreezeDuration  time.Duration `json:"freeze_duration"`  // of frozen video before an alarm, 0 to disable
+	SilenceDuration time.Duration `json:"silence_duration"` // of silent audio before an alarm, 0 to disable
+	SilenceLevel    float64       `json:"silence_level"`    // dBFS, the peak level below which audio is silent
+}
+
+var DefaultThresholds = Thresholds{
+	StallTimeout:    5 * time.Second,
+	KeyframeTimeout: 10 * time.Second,
+	MaxPCRJitter:    200 * time.Millisecond,
+	ErrorWindow:     10 * time.Second,
+	FreezeDuration:  5 * time.Second,
+	SilenceDuration: 5 * time.Second,
+	SilenceLevel:    -60,
+}
+
+// Health describes the transport of a stream.
+type Health struct {
+	State            string            `json:"state"`
+	Reasons          []string          `json:"reasons,omitempty"`
+	ContinuityErrors map[uint16]uint64 `json:"continuity_errors"`
+	TransportErrors  uint64            `json:"transport_errors"`
+	PCRJitter        float64           `json:"pcr_jitter_ms"`
+	PCRDrift         float64           `json:"pcr_drift_ppm"`
+	SinceKeyframe    float64           `json:"since_keyframe"`
+	SinceData        float64           `json:"since_data"`
+}
+
+// healthMonitor checks the packets of a stream as they are received.
+type healthMonitor struct {
+	continuity  mpegts.ContinuityChecker
+	ccErrors    map[uint16]uint64
+	tei         uint64
+	lastErrorAt time.Time
+
+	pcrPID     uint16
+	hasPCR     bool
+	pcrBase    int64
+	lastPCR    int64
+	wallBase   time.Time
+	lastOffset time.Duration
+	jitter     float64 // ms, smoothed
+	drift      float64 // ppm
+
+	startedAt    time.Time
+	lastKeyframe time.Time
+	lastData     time.Time
+}
+
+func newHealthMonitor(now time.Time) *healthMonitor {
+	return &healthMonitor{
+		ccErrors:  map[uint16]uint64{},
+		startedAt: now,
+		lastData:  now,
+	}
+}
+
+func (m *healthMonitor) push(p mpegts.Packet, now time.Time) {
+	// the clocks are compared again after a gap in the reception
+	if now.Sub(m.lastData) > time.Second {
+		m.hasPCR = false
+	}
+	m.lastData = now
+	pid := p.PID()
+
+	if p.TransportError() {
+		m.tei++
+		m.lastErrorAt = now
+	}
+	if mpegts.IsKeyframe(p) {
+		m.lastKeyframe = now
+	}
+
+	if m.continuity.Check(p) {
+		m.ccErrors[pid]++
+		m.lastErrorAt = now
+	}
+
+	if pcr, ok := p.PCR(); ok && (!m.hasPCR || pid == m.pcrPID) {
+		m.pushPCR(pid, pcr, now, p.Discontinuity())
+	}
+}
+
+// pushPCR compares the PCR with the wall clock since the first PCR.
+func (m *healthMonitor) pushPCR(pid uint16, pcr int64, now time.Time, discontinuity bool) {
+	if !m.hasPCR || discontinuity || pcr < m.lastPCR || pcr-m.lastPCR > 2*mpegts.PCRFrequency {
+		m.pcrPID, m.hasPCR = pid, true
+		m.pcrBase, m.lastPCR, m.wallBase = pcr, pcr, now
+		m.lastOffset = 0
+		return
+	}
+	m.lastPCR = pcr
+
+	wall := now.Sub(m.wallBase)
+	offset := wall - mpegts.PCRDuration(pcr-m.pcrBase)
+	delta := math.Abs(float64(offset-m.lastOffset) / float64(time.Millisecond))
+	m.jitter += (delta - m.jitter) / 16
+	m.lastOffset = offset
+	if wall > 10*time.Second {
+		m.drift = float64(offset) / float64(wall) * 1e6
+	}
+}
+
+// evaluate returns the state at now and the reasons it is not ok.
+func (m *healthMonitor) evaluate(now time.Time, th Thresholds) (string, []string) {
+	if since := now.Sub(m.lastData); since > th.StallTimeout {
+		return StateStalled, []string{fmt.Sprintf("no data for %v", since.Truncate(time.Second))}
+	}
+
+	reasons := []string{}
+	if !m.lastErrorAt.IsZero() && now.Sub(m.lastErrorAt) < th.ErrorWindow {
+		reasons = append(reasons, fmt.Sprintf("continuity or transport errors in the last %v", th.ErrorWindow))
+	}
+	lastKeyframe := m.lastKeyframe
+	if lastKeyframe.IsZero() {
+		lastKeyframe = m.startedAt
+	}
+	if since := now.Sub(lastKeyframe); since > th.KeyframeTimeout {
+		reasons = append(reasons, fmt.Sprintf("no keyframe for %v", since.Truncate(time.Second)))
+	}
+	if jitter := time.Duration(m.jitter * float64(time.Millisecond)); th.MaxPCRJitter > 0 && jitter > th.MaxPCRJitter {
+		reasons = append(reasons, fmt.Sprintf("pcr jitter of %v", jitter.Truncate(time.Millisecond)))
+	}
+	if len(reasons) > 0 {
+		return StateDegraded, reasons
+	}
+	return StateOK, nil
+}
+
+func (m *healthMonitor) health(now time.Time, th Thresholds) Health {
+	state, reasons := m.evaluate(now, th)
+	h := Health{
+		State:            state,
+		Reasons:          reasons,
+		ContinuityErrors: map[uint16]uint64{},
+		TransportErrors:  m.tei,
+		PCRJitter:        m.jitter,
+		PCRDrift:         m.drift,
+		SinceData:        now.Sub(m.lastData).Seconds(),
+		SinceKeyframe:    -1,
+	}
+	for pid, n := range m.ccErrors {
+		h.ContinuityErrors[pid] = n
+	}
+	if !m.lastKeyframe.IsZero() {
+		h.SinceKeyframe = now.Sub(m.lastKeyframe).Seconds()
+	}
+	return h
+}
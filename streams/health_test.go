@@ -0,0 +1,109 @@
+package streams
+
+import (
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// packet returns a packet of a PID with a continuity counter, carrying a
+// PCR when pcr is not negative.
+func packet(pid uint16, cc uint8, pcr int64) mpegts.Packet {
+	p := make(mpegts.Packet, mpegts.PacketSize)
+	p[0], p[1], p[2], p[3] = mpegts.SyncByte, byte(pid>>8)&0x1f, byte(pid), 0x10|cc&0x0f
+	if pcr >= 0 {
+		base := pcr / 300
+		p[3] |= 0x20
+		p[4], p[5] = 7, 0x10
+		p[6], p[7], p[8], p[9] = byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1)
+		p[10], p[11] = byte(base<<7)|0x7e, 0
+	}
+	return p
+}
+
+func TestHealth(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	th := DefaultThresholds
+	th.KeyframeTimeout = time.Hour
+
+	// the PCR follows the wall clock
+	m := newHealthMonitor(start)
+	for i := 0; i < 20; i++ {
+		m.push(packet(0x100, uint8(i), int64(i)*mpegts.PCRFrequency/10), at(i*100))
+	}
+	h := m.health(at(1900), th)
+	if h.State != StateOK || h.PCRJitter > 1 || len(h.ContinuityErrors) != 0 {
+		t.Errorf("got %+v", h)
+	}
+
+	// a lost packet degrades the stream for the error window
+	m.push(packet(0x100, 22, -1), at(2000))
+	if h := m.health(at(2000), th); h.State != StateDegraded || h.ContinuityErrors[0x100] != 1 {
+		t.Errorf("got %+v after a lost packet", h)
+	}
+	m.push(packet(0x100, 23, -1), at(2000).Add(th.ErrorWindow))
+	if state, _ := m.evaluate(at(2000).Add(th.ErrorWindow), th); state != StateOK {
+		t.Errorf("got %v after the error window", state)
+	}
+
+	// without data, it is stalled
+	if state, reasons := m.evaluate(at(2000).Add(th.ErrorWindow+th.StallTimeout+time.Second), th); state != StateStalled || len(reasons) != 1 {
+		t.Errorf("got %v %v without data", state, reasons)
+	}
+}
+
+func TestHealthJitter(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	m := newHealthMonitor(start)
+	th := DefaultThresholds
+	th.KeyframeTimeout = time.Hour
+
+	// every other PCR arrives 300ms late
+	for i := 0; i < 100; i++ {
+		now := start.Add(time.Duration(i*100+i%2*300) * time.Millisecond)
+		m.push(packet(0x100, uint8(i), int64(i)*mpegts.PCRFrequency/10), now)
+	}
+	state, reasons := m.evaluate(start.Add(10*time.Second), th)
+	if state != StateDegraded || len(reasons) != 1 {
+		t.Errorf("got %v %v", state, reasons)
+	}
+}
+
+func TestHealthKeyframe(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	m := newHealthMonitor(start)
+	th := DefaultThresholds
+	m.push(packet(0x100, 0, -1), start.Add(th.KeyframeTimeout))
+	h := m.health(start.Add(th.KeyframeTimeout+time.Second), th)
+	if h.State != StateDegraded || h.SinceKeyframe != -1 {
+		t.Errorf("got %+v without keyframe", h)
+	}
+}
+
+func TestHealthEvents(t *testing.T) {
+	r := NewRegistry()
+	th := DefaultThresholds
+	th.KeyframeTimeout = time.Hour
+	r.SetThresholds(th)
+	s := r.Publish("live", "news", "10.0.0.1:1234", "websocket", false)
+	now := time.Now()
+	s.Write(now, append(packet(0x100, 0, -1), packet(0x100, 2, -1)...))
+
+	events := s.update(now)
+	if len(events) != 1 || events[0].Type != EventHealth || events[0].State != StateDegraded || events[0].Previous != StateOK {
+		t.Fatalf("got %+v after a lost packet", events)
+	}
+	if events := s.update(now); len(events) != 0 {
+		t.Errorf("got %+v without a change", events)
+	}
+
+	later := now.Add(th.ErrorWindow)
+	s.Write(later, packet(0x100, 3, -1))
+	if events := s.update(later); len(events) != 1 || events[0].State != StateOK {
+		t.Errorf("got %+v after the error window", events)
+	}
+}
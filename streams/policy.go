@@ -0,0 +1,137 @@
+package streams
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// what to do with streams jsmpeg can't decode
+const (
+	CodecsIgnore = ""       // relay them anyway
+	CodecsFlag   = "flag"   // relay them with a warning on the stream
+	CodecsReject = "reject" // close the publisher
+)
+
+// the codecs jsmpeg decodes
+var playableCodecs = map[string]bool{"mpeg1video": true, "mp2": true}
+
+// Policy restricts what the publishers of an app may send, zero limits
+// are unlimited.
+type Policy struct {
+	Codecs       string  `json:"codecs"`
+	MaxWidth     int     `json:"max_width"`
+	MaxHeight    int     `json:"max_height"`
+	MaxFrameRate float64 `json:"max_frame_rate"`
+	MaxBitrate   int     `json:"max_bitrate"`
+}
+
+// Violation is a breach of a policy closing the publisher.
+type Violation struct {
+	Status  int
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// ParsePolicy parses a policy like
+// "live:codecs=reject,max-width=1280,max-height=720,max-fps=30,max-bitrate=2M",
+// "*" as app name applies to every app without its own policy.
+func ParsePolicy(value string) (string, Policy, error) {
+	p := Policy{}
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", p, fmt.Errorf("expecting app:key=value,..., got %q", value)
+	}
+
+	for _, opt := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return "", p, fmt.Errorf("invalid policy option %q", opt)
+		}
+		var err error
+		switch kv[0] {
+		case "codecs":
+			if kv[1] != CodecsFlag && kv[1] != CodecsReject && kv[1] != "ignore" {
+				return "", p, fmt.Errorf("invalid codecs policy %q, expecting ignore, flag or reject", kv[1])
+			}
+			if p.Codecs = kv[1]; kv[1] == "ignore" {
+				p.Codecs = CodecsIgnore
+			}
+		case "max-width":
+			p.MaxWidth, err = strconv.Atoi(kv[1])
+		case "max-height":
+			p.MaxHeight, err = strconv.Atoi(kv[1])
+		case "max-fps":
+			p.MaxFrameRate, err = strconv.ParseFloat(kv[1], 64)
+		case "max-bitrate":
+			p.MaxBitrate, err = ParseBitrate(kv[1])
+		default:
+			return "", p, fmt.Errorf("unknown policy option %q", kv[0])
+		}
+		if err != nil {
+			return "", p, fmt.Errorf("invalid policy option %q: %v", opt, err)
+		}
+	}
+	return parts[0], p, nil
+}
+
+// ParseBitrate parses bits/s with an optional k or M suffix.
+func ParseBitrate(s string) (int, error) {
+	unit := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		unit, s = 1000, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "M"):
+		unit, s = 1000000, strings.TrimSuffix(s, "M")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return int(v * float64(unit)), err
+}
+
+// unplayable lists the elementary streams of the PMT jsmpeg can't decode,
+// nothing is reported until the codecs are known.
+func unplayable(info mpegts.Info) []string {
+	problems := []string{}
+	for _, program := range info.Programs {
+		for _, es := range program.Streams {
+			if !playableCodecs[es.Codec] && es.Codec != "unknown" && es.Codec != "private" {
+				problems = append(problems, fmt.Sprintf("codec %v of pid %v is not supported by jsmpeg, expecting mpeg1video and mp2", es.Codec, es.PID))
+			}
+		}
+	}
+	return problems
+}
+
+// check returns the first violation of the policy, along with the
+// codec problems to flag the stream with.
+func (p *Policy) check(info mpegts.Info) (*Violation, []string) {
+	problems := unplayable(info)
+	if p.Codecs == CodecsReject && len(problems) > 0 {
+		return &Violation{http.StatusUnsupportedMediaType, problems[0]}, problems
+	}
+	if p.Codecs == CodecsIgnore {
+		problems = nil
+	}
+
+	if v := info.Video; v != nil {
+		if p.MaxWidth > 0 && v.Width > p.MaxWidth {
+			return &Violation{http.StatusUnprocessableEntity, fmt.Sprintf("width %v exceeds the limit of %v", v.Width, p.MaxWidth)}, problems
+		}
+		if p.MaxHeight > 0 && v.Height > p.MaxHeight {
+			return &Violation{http.StatusUnprocessableEntity, fmt.Sprintf("height %v exceeds the limit of %v", v.Height, p.MaxHeight)}, problems
+		}
+		if p.MaxFrameRate > 0 && v.FrameRate > p.MaxFrameRate {
+			return &Violation{http.StatusUnprocessableEntity, fmt.Sprintf("frame rate %.2f exceeds the limit of %v", v.FrameRate, p.MaxFrameRate)}, problems
+		}
+	}
+	if p.MaxBitrate > 0 && info.Bitrate > p.MaxBitrate {
+		return &Violation{http.StatusUnprocessableEntity, fmt.Sprintf("bitrate %v bits/s exceeds the limit of %v bits/s", info.Bitrate, p.MaxBitrate)}, problems
+	}
+	return nil, problems
+}
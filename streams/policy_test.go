@@ -0,0 +1,76 @@
+package streams
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		value string
+		app   string
+		want  Policy
+		ok    bool
+	}{
+		{"live:codecs=reject,max-width=1280,max-height=720,max-fps=30,max-bitrate=2M", "live", Policy{Codecs: CodecsReject, MaxWidth: 1280, MaxHeight: 720, MaxFrameRate: 30, MaxBitrate: 2000000}, true},
+		{"*:codecs=flag,max-bitrate=1.5k", "*", Policy{Codecs: CodecsFlag, MaxBitrate: 1500}, true},
+		{"live:codecs=ignore", "live", Policy{Codecs: CodecsIgnore}, true},
+		{"codecs=reject", "", Policy{}, false},
+		{":codecs=reject", "", Policy{}, false},
+		{"live:codecs=drop", "", Policy{}, false},
+		{"live:max-width", "", Policy{}, false},
+		{"live:max-width=wide", "", Policy{}, false},
+		{"live:max-depth=8", "", Policy{}, false},
+	}
+	for _, tt := range tests {
+		app, got, err := ParsePolicy(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: got error %v", tt.value, err)
+			continue
+		}
+		if tt.ok && (app != tt.app || got != tt.want) {
+			t.Errorf("%v: got %v %+v, want %v %+v", tt.value, app, got, tt.app, tt.want)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	playable := mpegts.Info{
+		Programs: []mpegts.ProgramInfo{{Streams: []mpegts.StreamInfo{{PID: 0x100, Codec: "mpeg1video"}, {PID: 0x101, Codec: "mp2"}}}},
+		Video:    &mpegts.VideoInfo{Width: 1920, Height: 1080, FrameRate: 50},
+		Bitrate:  4000000,
+	}
+	h264 := mpegts.Info{
+		Programs: []mpegts.ProgramInfo{{Streams: []mpegts.StreamInfo{{PID: 0x100, Codec: "h264"}, {PID: 0x101, Codec: "unknown"}}}},
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		info     mpegts.Info
+		status   int // of the violation, 0 for none
+		warnings int
+	}{
+		{"no policy", Policy{}, h264, 0, 0},
+		{"flagged", Policy{Codecs: CodecsFlag}, h264, 0, 1},
+		{"rejected", Policy{Codecs: CodecsReject}, h264, http.StatusUnsupportedMediaType, 1},
+		{"playable", Policy{Codecs: CodecsReject}, playable, 0, 0},
+		{"width", Policy{MaxWidth: 1280}, playable, http.StatusUnprocessableEntity, 0},
+		{"height", Policy{MaxHeight: 720}, playable, http.StatusUnprocessableEntity, 0},
+		{"frame rate", Policy{MaxFrameRate: 30}, playable, http.StatusUnprocessableEntity, 0},
+		{"bitrate", Policy{MaxBitrate: 2000000}, playable, http.StatusUnprocessableEntity, 0},
+		{"within the limits", Policy{MaxWidth: 1920, MaxHeight: 1080, MaxFrameRate: 50, MaxBitrate: 4000000}, playable, 0, 0},
+	}
+	for _, tt := range tests {
+		v, warnings := tt.policy.check(tt.info)
+		status := 0
+		if v != nil {
+			status = v.Status
+		}
+		if status != tt.status || len(warnings) != tt.warnings {
+			t.Errorf("%v: got %v, %v, want status %v and %v warnings", tt.name, v, warnings, tt.status, tt.warnings)
+		}
+	}
+}
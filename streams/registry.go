@@ -0,0 +1,325 @@
+package streams
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/utils"
+)
+
+// Stream is a topic being published.
+type Stream struct {
+	sync.RWMutex
+	App        string
+	Key        string
+	RemoteAddr string
+	Transport  string // of the publisher, http, websocket or testsrc
+	StartedAt  time.Time
+	Private    bool // hidden from the directory
+
+	bytesIn   uint64
+	analyzer  *mpegts.Analyzer
+	policy    Policy
+	checkedAt time.Time
+	warnings  []string
+
+	monitor    *healthMonitor
+	content    *contentMonitor
+	thresholds Thresholds
+	state      string
+	terminated chan struct{}
+}
+
+// the period of the policy checks
+const checkInterval = time.Second
+
+// to get the broker topic of the stream
+func (s *Stream) Topic() string {
+	return s.App + "/" + s.Key
+}
+
+// Write inspects aligned packets received at now.
+func (s *Stream) Write(now time.Time, data []byte) {
+	s.Lock()
+	defer s.Unlock()
+	s.bytesIn += uint64(len(data))
+	for _, pkt := range mpegts.Packets(data) {
+		s.analyzer.Push(pkt, now)
+		s.monitor.push(pkt, now)
+		s.content.push(pkt, now, s.thresholds.SilenceLevel)
+	}
+}
+
+// Check enforces the policy of the app on what was received so far.
+func (s *Stream) Check(now time.Time) *Violation {
+	s.Lock()
+	defer s.Unlock()
+	if now.Sub(s.checkedAt) < checkInterval {
+		return nil
+	}
+	s.checkedAt = now
+
+	violation, warnings := s.policy.check(s.analyzer.Info(now))
+	s.warnings = warnings
+	return violation
+}
+
+// Status describes a live stream.
+type Status struct {
+	App        string      `json:"app"`
+	Key        string      `json:"key"`
+	RemoteAddr string      `json:"remote_addr,omitempty"` // in the admin API only
+	Transport  string      `json:"transport"`
+	StartedAt  time.Time   `json:"started_at"`
+	Private    bool        `json:"private"`
+	BytesIn    uint64      `json:"bytes_in"`
+	Info       mpegts.Info `json:"info"`
+	Health     Health      `json:"health"`
+	Alarms     []Alarm     `json:"alarms"`
+	Warnings   []string    `json:"warnings,omitempty"`
+}
+
+// Status returns the description of the stream.
+func (s *Stream) Status() Status {
+	s.RLock()
+	defer s.RUnlock()
+	now := time.Now()
+	return Status{
+		App:        s.App,
+		Key:        s.Key,
+		RemoteAddr: s.RemoteAddr,
+		Transport:  s.Transport,
+		StartedAt:  s.StartedAt,
+		Private:    s.Private,
+		BytesIn:    s.bytesIn,
+		Info:       s.analyzer.Info(now),
+		Health:     s.health(now),
+		Alarms:     s.content.list(),
+		Warnings:   s.warnings,
+	}
+}
+
+// Terminate asks the publisher of the stream to stop.
+func (s *Stream) Terminate() {
+	s.Lock()
+	defer s.Unlock()
+	select {
+	case <-s.terminated:
+	default:
+		close(s.terminated)
+	}
+}
+
+// to get a channel closed when the publisher is asked to stop
+func (s *Stream) Terminated() <-chan struct{} {
+	return s.terminated
+}
+
+// Health returns the health of the stream.
+func (s *Stream) Health() Health {
+	s.RLock()
+	defer s.RUnlock()
+	return s.health(time.Now())
+}
+
+// Alarms returns the recent alarms of the stream, oldest first.
+func (s *Stream) Alarms() []Alarm {
+	s.RLock()
+	defer s.RUnlock()
+	return s.content.list()
+}
+
+// the transport health, degraded by the active alarms
+func (s *Stream) health(now time.Time) Health {
+	h := s.monitor.health(now, s.thresholds)
+	h.State, h.Reasons = s.evaluate(now)
+	return h
+}
+
+func (s *Stream) evaluate(now time.Time) (string, []string) {
+	state, reasons := s.monitor.evaluate(now, s.thresholds)
+	if state != StateOK && state != StateDegraded {
+		return state, reasons
+	}
+	for _, d := range []*detector{&s.content.frozen, &s.content.silence} {
+		if d.alarm != nil {
+			state = StateDegraded
+			reasons = append(reasons, fmt.Sprintf("%v since %v", d.kind, d.alarm.Start.Format(time.RFC3339)))
+		}
+	}
+	return state, reasons
+}
+
+// update reevaluates the alarms and the state of the stream, returning the
+// events of the changes.
+func (s *Stream) update(now time.Time) []Event {
+	s.Lock()
+	defer s.Unlock()
+	var events []Event
+	for _, alarm := range s.content.update(now, s.thresholds) {
+		events = append(events, s.alarmEvent(alarm, now))
+	}
+
+	state, reasons := s.evaluate(now)
+	if state != s.state {
+		events = append(events, Event{
+			Type:     EventHealth,
+			App:      s.App,
+			Key:      s.Key,
+			At:       now,
+			State:    state,
+			Previous: s.state,
+			Reasons:  reasons,
+		})
+		s.state = state
+	}
+	return events
+}
+
+// end ends the active alarms of a stream whose publisher is gone.
+func (s *Stream) end(now time.Time) []Event {
+	s.Lock()
+	defer s.Unlock()
+	var events []Event
+	for _, alarm := range s.content.end(now) {
+		events = append(events, s.alarmEvent(alarm, now))
+	}
+	return events
+}
+
+func (s *Stream) alarmEvent(alarm *Alarm, now time.Time) Event {
+	a := *alarm
+	state := "active"
+	if a.End != nil {
+		state = "ended"
+	}
+	return Event{Type: EventAlarm, App: s.App, Key: s.Key, At: now, State: state, Alarm: &a}
+}
+
+// Registry keeps the streams being published.
+type Registry struct {
+	sync.RWMutex
+	streams    map[string]*Stream
+	policies   map[string]Policy
+	thresholds Thresholds
+	listeners  []func(Event)
+	events     []Event
+	viewers    map[string]map[*Viewer]bool // by topic
+	closing    chan bool
+}
+
+// create a new registry
+func NewRegistry() *Registry {
+	return &Registry{
+		streams:    map[string]*Stream{},
+		policies:   map[string]Policy{},
+		thresholds: DefaultThresholds,
+		viewers:    map[string]map[*Viewer]bool{},
+		closing:    make(chan bool, 1),
+	}
+}
+
+// Run starts monitoring the health of the streams until Close is called.
+func (r *Registry) Run() {
+	utils.Repeat(r.monitor, checkInterval, r.closing)
+}
+
+// Close stops monitoring.
+func (r *Registry) Close() {
+	r.closing <- true
+}
+
+func (r *Registry) monitor() {
+	now := time.Now()
+	for _, s := range r.List() {
+		events := s.update(now)
+		r.Lock()
+		for _, e := range events {
+			r.emit(e)
+		}
+		r.Unlock()
+	}
+}
+
+// SetThresholds sets the thresholds of the health of the streams published
+// from now on.
+func (r *Registry) SetThresholds(th Thresholds) {
+	r.Lock()
+	defer r.Unlock()
+	r.thresholds = th
+}
+
+// SetPolicy sets the policy of the publishers of an app, "*" for the apps
+// without their own.
+func (r *Registry) SetPolicy(app string, p Policy) {
+	r.Lock()
+	defer r.Unlock()
+	r.policies[app] = p
+}
+
+// Publish registers a new publisher of a topic connected over a transport,
+// replacing the previous one. A private stream is hidden from the directory.
+func (r *Registry) Publish(app, key, remoteAddr, transport string, private bool) *Stream {
+	now := time.Now()
+	s := &Stream{
+		App:        app,
+		Key:        key,
+		RemoteAddr: remoteAddr,
+		Transport:  transport,
+		StartedAt:  now,
+		Private:    private,
+		analyzer:   mpegts.NewAnalyzer(),
+		monitor:    newHealthMonitor(now),
+		content:    newContentMonitor(),
+		state:      StateOK,
+		terminated: make(chan struct{}),
+	}
+	r.Lock()
+	defer r.Unlock()
+	policy, ok := r.policies[app]
+	if !ok {
+		policy = r.policies["*"]
+	}
+	s.policy = policy
+	s.thresholds = r.thresholds
+	r.streams[s.Topic()] = s
+	r.emit(Event{Type: EventPublish, App: app, Key: key, At: now, State: s.state})
+	return s
+}
+
+// Unpublish removes a stream whose publisher is gone.
+func (r *Registry) Unpublish(s *Stream) {
+	now := time.Now()
+	events := s.end(now)
+	r.Lock()
+	defer r.Unlock()
+	for _, e := range events {
+		r.emit(e)
+	}
+	if r.streams[s.Topic()] == s {
+		delete(r.streams, s.Topic())
+		r.emit(Event{Type: EventUnpublish, App: s.App, Key: s.Key, At: now})
+	}
+}
+
+// to get the stream of a topic, nil when it is not live
+func (r *Registry) Get(app, key string) *Stream {
+	r.RLock()
+	defer r.RUnlock()
+	return r.streams[app+"/"+key]
+}
+
+// List returns the live streams ordered by topic.
+func (r *Registry) List() []*Stream {
+	r.RLock()
+	defer r.RUnlock()
+	list := make([]*Stream, 0, len(r.streams))
+	for _, s := range r.streams {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Topic() < list[j].Topic() })
+	return list
+}
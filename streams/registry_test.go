@@ -0,0 +1,67 @@
+package streams
+
+import (
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	var heard []string
+	r.OnEvent(func(e Event) { heard = append(heard, e.Type+" "+e.App+"/"+e.Key) })
+
+	news := r.Publish("live", "news", "10.0.0.1:1234", "websocket", false)
+	r.Publish("live", "sports", "10.0.0.2:1234", "websocket", true)
+	if got := r.Get("live", "news"); got != news {
+		t.Errorf("got %v for live/news", got)
+	}
+	if r.Get("live", "other") != nil {
+		t.Error("got a stream not published")
+	}
+	if list := r.List(); len(list) != 2 || list[0].Topic() != "live/news" || list[1].Topic() != "live/sports" {
+		t.Errorf("got %v", list)
+	}
+
+	// a new publisher replaces the previous one, which leaves it in place
+	again := r.Publish("live", "news", "10.0.0.3:1234", "websocket", false)
+	r.Unpublish(news)
+	if r.Get("live", "news") != again {
+		t.Error("the previous publisher removed the new one")
+	}
+	r.Unpublish(again)
+	if r.Get("live", "news") != nil {
+		t.Error("the stream unpublished is live")
+	}
+
+	want := []string{"publish live/news", "publish live/sports", "publish live/news", "unpublish live/news"}
+	if len(heard) != len(want) {
+		t.Fatalf("got events %v, want %v", heard, want)
+	}
+	for i := range want {
+		if heard[i] != want[i] {
+			t.Errorf("event %v: got %v, want %v", i, heard[i], want[i])
+		}
+	}
+	if events := r.Events("live", "sports"); len(events) != 1 || events[0].Type != EventPublish {
+		t.Errorf("got events %+v of live/sports", events)
+	}
+	if events := r.Events("", ""); len(events) != len(want) {
+		t.Errorf("got %v events", len(events))
+	}
+}
+
+func TestStatus(t *testing.T) {
+	r := NewRegistry()
+	s := r.Publish("live", "news", "10.0.0.1:1234", "websocket", true)
+	status := s.Status()
+	if status.App != "live" || status.Key != "news" || status.RemoteAddr != "10.0.0.1:1234" || !status.Private || status.BytesIn != 0 {
+		t.Errorf("got %+v", status)
+	}
+	select {
+	case <-s.Terminated():
+		t.Fatal("terminated before Terminate")
+	default:
+	}
+	s.Terminate()
+	s.Terminate()
+	<-s.Terminated()
+}
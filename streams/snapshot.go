@@ -0,0 +1,100 @@
+package streams
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpeg1"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+var ErrNoKeyframe = errors.New("no keyframe received yet")
+
+// the quality of the JPEG renderings of the keyframes
+const thumbnailQuality = 80
+
+var sequenceEnd = []byte{0, 0, 1, mpegts.StartCodeSeqEnd}
+
+// the GOP header before the picture of a snapshot, a closed GOP at time
+// code 0 which holds only the marker bit
+var gopHeader = []byte{0, 0, 1, mpegts.StartCodeGOP, 0x00, 0x08, 0x00, 0x40}
+
+// Snapshot is the latest keyframe of a stream, an I picture with its
+// sequence and GOP headers as a standalone elementary stream.
+type Snapshot struct {
+	Data []byte
+	At   time.Time
+}
+
+// keyframes keeps the latest complete keyframe of the video.
+type keyframes struct {
+	sequence  []byte
+	snapshot  *Snapshot
+	thumbnail []byte // of snapshot
+}
+
+func (k *keyframes) push(es []byte, pictures []mpegts.Picture, now time.Time) {
+	if seq, ok := mpegts.SequenceHeaderData(es); ok {
+		k.sequence = append(k.sequence[:0], seq...)
+	}
+	for _, pic := range pictures {
+		if pic.Type != mpegts.PictureI || k.sequence == nil {
+			continue
+		}
+		data := make([]byte, 0, len(k.sequence)+len(gopHeader)+len(pic.Data)+len(sequenceEnd))
+		data = append(data, k.sequence...)
+		data = append(data, gopHeader...)
+		picture := len(data)
+		data = append(data, pic.Data...)
+		data = append(data, sequenceEnd...)
+		if len(pic.Data) > 5 {
+			// the first picture of the GOP, its temporal reference is 0
+			data[picture+4] = 0
+			data[picture+5] &= 0x3f
+		}
+		k.snapshot = &Snapshot{Data: data, At: now}
+		k.thumbnail = nil
+	}
+}
+
+// Snapshot returns the latest keyframe of the stream.
+func (s *Stream) Snapshot() (*Snapshot, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.content.keyframes.snapshot == nil {
+		return nil, ErrNoKeyframe
+	}
+	return s.content.keyframes.snapshot, nil
+}
+
+// Thumbnail returns the latest keyframe of the stream rendered as JPEG.
+func (s *Stream) Thumbnail() ([]byte, time.Time, error) {
+	s.RLock()
+	k := &s.content.keyframes
+	snapshot, thumbnail := k.snapshot, k.thumbnail
+	s.RUnlock()
+	if snapshot == nil {
+		return nil, time.Time{}, ErrNoKeyframe
+	}
+	if thumbnail != nil {
+		return thumbnail, snapshot.At, nil
+	}
+
+	img, err := mpeg1.DecodeIntra(snapshot.Data)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	s.Lock()
+	if k.snapshot == snapshot {
+		k.thumbnail = buf.Bytes()
+	}
+	s.Unlock()
+	return buf.Bytes(), snapshot.At, nil
+}
@@ -0,0 +1,71 @@
+package streams
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+func TestSnapshot(t *testing.T) {
+	r := NewRegistry()
+	s := r.Publish("live", "news", "10.0.0.1:1234", "websocket", false)
+	if _, err := s.Snapshot(); err != ErrNoKeyframe {
+		t.Errorf("got %v before any keyframe", err)
+	}
+	if _, _, err := s.Thumbnail(); err != ErrNoKeyframe {
+		t.Errorf("got %v before any keyframe", err)
+	}
+
+	var buf bytes.Buffer
+	gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		at := start.Add(time.Duration(i) * gen.FrameDuration())
+		buf.Reset()
+		if err := gen.WriteFrame(at); err != nil {
+			t.Fatal(err)
+		}
+		s.Write(at, buf.Bytes())
+	}
+
+	// the keyframe of the second GOP is complete once the next picture started
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(25 * gen.FrameDuration()); !snapshot.At.Equal(want) {
+		t.Errorf("got a snapshot at %v, want %v", snapshot.At, want)
+	}
+	if _, ok := mpegts.ParseSequenceHeader(snapshot.Data); !ok || !bytes.HasPrefix(snapshot.Data, []byte{0, 0, 1, mpegts.StartCodeSequence}) {
+		t.Error("the snapshot does not start with a sequence header")
+	}
+	if !bytes.Contains(snapshot.Data, gopHeader) || !bytes.HasSuffix(snapshot.Data, sequenceEnd) {
+		t.Error("the snapshot has no GOP header or sequence end")
+	}
+	pictures := mpegts.Pictures(snapshot.Data)
+	if len(pictures) != 1 || pictures[0].Type != mpegts.PictureI {
+		t.Errorf("got %d pictures", len(pictures))
+	}
+
+	data, at, err := s.Thumbnail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 48 || !at.Equal(snapshot.At) {
+		t.Errorf("got a thumbnail of %v at %v", b, at)
+	}
+	if again, _, _ := s.Thumbnail(); !bytes.Equal(again, data) {
+		t.Error("the thumbnail was rendered again")
+	}
+}
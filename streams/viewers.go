@@ -0,0 +1,188 @@
+package streams
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/pubsub"
+)
+
+// Viewer is a client playing a topic.
+type Viewer struct {
+	App         string
+	Key         string
+	RemoteAddr  string
+	Protocol    string
+	ConnectedAt time.Time
+
+	sent       uint64 // atomic
+	subscriber *pubsub.Subscriber
+	kick       func()
+}
+
+// Join registers a viewer of a topic, live or not yet, reading from
+// subscriber. kick disconnects it.
+func (r *Registry) Join(app, key, remoteAddr, protocol string, subscriber *pubsub.Subscriber, kick func()) *Viewer {
+	v := &Viewer{
+		App:         app,
+		Key:         key,
+		RemoteAddr:  remoteAddr,
+		Protocol:    protocol,
+		ConnectedAt: time.Now(),
+		subscriber:  subscriber,
+		kick:        kick,
+	}
+	r.Lock()
+	defer r.Unlock()
+	topic := app + "/" + key
+	if r.viewers[topic] == nil {
+		r.viewers[topic] = map[*Viewer]bool{}
+	}
+	r.viewers[topic][v] = true
+	return v
+}
+
+// Leave removes a viewer which is gone.
+func (r *Registry) Leave(v *Viewer) {
+	r.Lock()
+	defer r.Unlock()
+	topic := v.App + "/" + v.Key
+	delete(r.viewers[topic], v)
+	if len(r.viewers[topic]) == 0 {
+		delete(r.viewers, topic)
+	}
+}
+
+// Viewers returns the viewers of a topic by connection time.
+func (r *Registry) Viewers(app, key string) []*Viewer {
+	r.RLock()
+	defer r.RUnlock()
+	list := []*Viewer{}
+	for v := range r.viewers[app+"/"+key] {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ConnectedAt.Before(list[j].ConnectedAt) })
+	return list
+}
+
+// to get the id of the viewer, the one of its subscriber
+func (v *Viewer) ID() string {
+	return v.subscriber.GetID()
+}
+
+// Write counts the bytes sent to the viewer.
+func (v *Viewer) Write(b []byte) (int, error) {
+	atomic.AddUint64(&v.sent, uint64(len(b)))
+	return len(b), nil
+}
+
+// Kick disconnects the viewer.
+func (v *Viewer) Kick() {
+	v.kick()
+}
+
+// ViewerStatus describes a viewer.
+type ViewerStatus struct {
+	ID          string    `json:"id"`
+	App         string    `json:"app"`
+	Key         string    `json:"key"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Protocol    string    `json:"protocol"`
+	ConnectedAt time.Time `json:"connected_at"`
+	BytesSent   uint64    `json:"bytes_sent"`
+	QueueDepth  int       `json:"queue_depth"`
+	Dropped     uint64    `json:"dropped"`
+}
+
+// Status returns the description of the viewer.
+func (v *Viewer) Status() ViewerStatus {
+	return ViewerStatus{
+		ID:          v.ID(),
+		App:         v.App,
+		Key:         v.Key,
+		RemoteAddr:  v.RemoteAddr,
+		Protocol:    v.Protocol,
+		ConnectedAt: v.ConnectedAt,
+		BytesSent:   atomic.LoadUint64(&v.sent),
+		QueueDepth:  v.subscriber.QueueDepth(),
+		Dropped:     v.subscriber.Dropped(),
+	}
+}
+
+// AllViewers returns the viewers of all the topics by connection time.
+func (r *Registry) AllViewers() []*Viewer {
+	r.RLock()
+	defer r.RUnlock()
+	list := []*Viewer{}
+	for _, viewers := range r.viewers {
+		for v := range viewers {
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ConnectedAt.Before(list[j].ConnectedAt) })
+	return list
+}
+
+// to get a viewer by its id, nil when there is none
+func (r *Registry) Viewer(id string) *Viewer {
+	r.RLock()
+	defer r.RUnlock()
+	for _, viewers := range r.viewers {
+		for v := range viewers {
+			if v.ID() == id {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// Summary is the entry of a live stream in the directory, it tells how the
+// publisher is connected and since when but not who it is.
+type Summary struct {
+	App       string    `json:"app"`
+	Key       string    `json:"key"`
+	Transport string    `json:"transport"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    float64   `json:"uptime"`
+	Viewers   int       `json:"viewers"`
+	Bitrate   int       `json:"bitrate"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	FrameRate float64   `json:"frame_rate,omitempty"`
+	State     string    `json:"state"`
+}
+
+// Directory lists the live streams which are not private, of an app or of
+// all the apps when app is empty.
+func (r *Registry) Directory(app string) []Summary {
+	now := time.Now()
+	list := []Summary{}
+	for _, s := range r.List() {
+		if s.Private || (app != "" && s.App != app) {
+			continue
+		}
+		s.RLock()
+		info := s.analyzer.Info(now)
+		summary := Summary{
+			App:       s.App,
+			Key:       s.Key,
+			Transport: s.Transport,
+			StartedAt: s.StartedAt,
+			Uptime:    now.Sub(s.StartedAt).Seconds(),
+			Bitrate:   info.Bitrate,
+			State:     s.state,
+		}
+		if info.Video != nil {
+			summary.Width, summary.Height, summary.FrameRate = info.Video.Width, info.Video.Height, info.Video.FrameRate
+		}
+		s.RUnlock()
+
+		r.RLock()
+		summary.Viewers = len(r.viewers[s.Topic()])
+		r.RUnlock()
+		list = append(list, summary)
+	}
+	return list
+}
@@ -0,0 +1,49 @@
+package streams
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDirectory(t *testing.T) {
+	r := NewRegistry()
+	news := r.Publish("live", "news", "10.0.0.1:1234", "websocket", false)
+	r.Publish("live", "private", "10.0.0.2:1234", "http", true)
+	r.Publish("sports", "match", "10.0.0.3:1234", "http", false)
+	r.Join("live", "news", "10.0.0.4:1234", "websocket", nil, func() {})
+
+	tests := []struct {
+		app  string
+		want []string
+	}{
+		{"", []string{"live/news", "sports/match"}},
+		{"live", []string{"live/news"}},
+		{"other", nil},
+	}
+	for _, tt := range tests {
+		list := r.Directory(tt.app)
+		if len(list) != len(tt.want) {
+			t.Errorf("%q: got %+v, want %v", tt.app, list, tt.want)
+			continue
+		}
+		for i, s := range list {
+			if s.App+"/"+s.Key != tt.want[i] {
+				t.Errorf("%q: got %v, want %v", tt.app, s.App+"/"+s.Key, tt.want[i])
+			}
+		}
+	}
+
+	summary := r.Directory("live")[0]
+	if summary.Transport != "websocket" || !summary.StartedAt.Equal(news.StartedAt) || summary.Viewers != 1 || summary.State != StateOK {
+		t.Errorf("got %+v", summary)
+	}
+	// the publisher is not identified
+	b, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "10.0.0.1") {
+		t.Errorf("got %s", b)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+// testsrcCommand runs the testsrc subcommand, which publishes a test pattern
+// to a relay or writes it to a file.
+func testsrcCommand(args []string) int {
+	fs := flag.NewFlagSet("testsrc", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsmpeg-relay testsrc [--url http://relay/publish/app/key] [-o output.ts] [-d DURATION] [-size 320x240] [-fps 25] [-tone 1000] [-mute]")
+		fs.PrintDefaults()
+	}
+	url := fs.String("url", "", "the publish URL of the topic")
+	output := fs.String("o", "", "the MPEG-TS file to write, at once without URL")
+	duration := fs.Duration("d", 0, "the duration of the stream, 0 until interrupted")
+	size := fs.String("size", "320x240", "the size of the picture")
+	opts := testsrc.DefaultOptions
+	fs.Float64Var(&opts.FrameRate, "fps", opts.FrameRate, "the frame rate, from 23.976 to 60")
+	fs.IntVar(&opts.Quantizer, "q", opts.Quantizer, "the video quantizer, from 1 (best) to 31")
+	fs.Float64Var(&opts.Tone, "tone", opts.Tone, "the frequency of the tone in Hz")
+	fs.Float64Var(&opts.Level, "level", opts.Level, "the level of the tone in dBFS")
+	fs.BoolVar(&opts.Mute, "mute", false, "silence instead of the tone")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *url == "" && *output == "" {
+		fs.Usage()
+		return 2
+	}
+	if _, err := fmt.Sscanf(*size, "%dx%d", &opts.Width, &opts.Height); err != nil {
+		fmt.Fprintln(os.Stderr, "error: invalid size:", *size)
+		return 2
+	}
+
+	var writers []io.Writer
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		defer f.Close()
+		out := bufio.NewWriter(f)
+		defer out.Flush()
+		writers = append(writers, out)
+	}
+
+	// a file alone is written at once
+	if *url == "" && *duration > 0 {
+		gen, err := testsrc.New(io.MultiWriter(writers...), opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 2
+		}
+		start := time.Now()
+		for i := 0; time.Duration(i)*gen.FrameDuration() < *duration; i++ {
+			if err := gen.WriteFrame(start.Add(time.Duration(i) * gen.FrameDuration())); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+		}
+		return 0
+	}
+
+	pr, pw := io.Pipe()
+	if *url != "" {
+		writers = append(writers, pw)
+	}
+	gen, err := testsrc.New(io.MultiWriter(writers...), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+	stop := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+	if *url == "" {
+		if err := gen.Run(stop, *duration); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		return 0
+	}
+
+	go func() {
+		pw.CloseWithError(gen.Run(stop, *duration))
+	}()
+	resp, err := http.Post(*url, "video/mp2t", pr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		fmt.Fprintf(os.Stderr, "error: %v: %v\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package testsrc
+
+import (
+	"image"
+	"image/color"
+)
+
+// the 75% color bars, from left to right
+var bars = []color.RGBA{
+	{191, 191, 191, 255}, // white
+	{191, 191, 0, 255},   // yellow
+	{0, 191, 191, 255},   // cyan
+	{0, 191, 0, 255},     // green
+	{191, 0, 191, 255},   // magenta
+	{191, 0, 0, 255},     // red
+	{0, 0, 191, 255},     // blue
+}
+
+// the castellations under the bars, the reverse of the blue bars
+var castellations = []color.RGBA{
+	{0, 0, 191, 255},
+	{19, 19, 19, 255},
+	{191, 0, 191, 255},
+	{19, 19, 19, 255},
+	{0, 191, 191, 255},
+	{19, 19, 19, 255},
+	{191, 191, 191, 255},
+}
+
+var (
+	black = color.RGBA{0, 0, 0, 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+// the glyphs of the clock and the counter, 5x7 pixels, a row by byte with
+// the leftmost pixel as the bit 4
+var font = map[rune][7]uint8{
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	' ': {},
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// fill paints a rectangle with a color, the rectangle should start on even
+// coordinates for the chroma to line up.
+func fill(img *image.YCbCr, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Rect)
+	y, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			img.Y[img.YOffset(px, py)] = y
+		}
+	}
+	for py := r.Min.Y; py < r.Max.Y; py += 2 {
+		for px := r.Min.X; px < r.Max.X; px += 2 {
+			i := img.COffset(px, py)
+			img.Cb[i], img.Cr[i] = cb, cr
+		}
+	}
+}
+
+// drawText paints a white line of text on a black background, centered on
+// a point, with the pixels of the glyphs scaled up.
+func drawText(img *image.YCbCr, text string, cx, cy, scale int) {
+	advance := (glyphWidth + 1) * scale
+	width := len(text)*advance - scale
+	x0, y0 := cx-width/2, cy-glyphHeight*scale/2
+	x0, y0 = x0&^1, y0&^1
+	fill(img, image.Rect(x0-2*scale, y0-2*scale, x0+width+2*scale, y0+(glyphHeight+2)*scale), black)
+
+	y, _, _ := color.RGBToYCbCr(white.R, white.G, white.B)
+	for i, ch := range text {
+		glyph := font[ch]
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if glyph[row]>>uint(glyphWidth-1-col)&1 == 0 {
+					continue
+				}
+				px, py := x0+i*advance+col*scale, y0+row*scale
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						if p := image.Pt(px+dx, py+dy); p.In(img.Rect) {
+							img.Y[img.YOffset(p.X, p.Y)] = y
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package testsrc generates a test stream without external tools: MPEG-1
+// video of color bars with a moving box and a burned-in clock and frame
+// counter, and an MP2 tone, muxed as a transport stream jsmpeg plays.
+package testsrc
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mp2"
+	"github.com/numb3r3/jsmpeg-relay/mpeg1"
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// the PIDs of the generated stream
+const (
+	VideoPID = 0x100
+	AudioPID = 0x101
+)
+
+// the delay of the PTS after the PCR, for the decoders to buffer
+const ptsDelay = 90000 / 10
+
+// Options describes the generated stream, zero values take the defaults.
+type Options struct {
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	FrameRate    float64 `json:"frame_rate"`
+	Quantizer    int     `json:"quantizer"`
+	Tone         float64 `json:"tone"`  // in Hz
+	Level        float64 `json:"level"` // of the tone in dBFS
+	Mute         bool    `json:"mute"`  // silence instead of the tone
+	SampleRate   int     `json:"sample_rate"`
+	AudioBitrate int     `json:"audio_bitrate"`
+}
+
+// DefaultOptions are the options of a small stream, a keyframe per second
+// and a 1kHz tone at -18dBFS.
+var DefaultOptions = Options{
+	Width:        320,
+	Height:       240,
+	FrameRate:    25,
+	Quantizer:    8,
+	Tone:         1000,
+	Level:        -18,
+	SampleRate:   48000,
+	AudioBitrate: 64000,
+}
+
+func (o Options) withDefaults() Options {
+	d := DefaultOptions
+	if o.Width == 0 {
+		o.Width = d.Width
+	}
+	if o.Height == 0 {
+		o.Height = d.Height
+	}
+	if o.FrameRate == 0 {
+		o.FrameRate = d.FrameRate
+	}
+	if o.Quantizer == 0 {
+		o.Quantizer = d.Quantizer
+	}
+	if o.Tone == 0 {
+		o.Tone = d.Tone
+	}
+	if o.Level == 0 {
+		o.Level = d.Level
+	}
+	if o.SampleRate == 0 {
+		o.SampleRate = d.SampleRate
+	}
+	if o.AudioBitrate == 0 {
+		o.AudioBitrate = d.AudioBitrate
+	}
+	return o
+}
+
+// Generator writes the test stream.
+type Generator struct {
+	opts  Options
+	mux   *mpegts.Muxer
+	video *mpeg1.Encoder
+	audio *mp2.Encoder
+	gop   int
+	img   *image.YCbCr
+
+	frames      int64 // the pictures written
+	audioFrames int64 // the audio frames written
+	phase       float64
+	pcm         []float64
+}
+
+// create a generator writing to w, the options are completed with the
+// defaults
+func New(w io.Writer, opts Options) (*Generator, error) {
+	opts = opts.withDefaults()
+	if opts.Width%2 != 0 || opts.Height%2 != 0 || opts.Width < 64 || opts.Height < 48 {
+		return nil, fmt.Errorf("invalid picture size %dx%d, even and at least 64x48", opts.Width, opts.Height)
+	}
+	gop := int(math.Round(opts.FrameRate))
+	video, err := mpeg1.NewEncoder(opts.Width, opts.Height, opts.FrameRate, opts.Quantizer, gop)
+	if err != nil {
+		return nil, err
+	}
+	audio, err := mp2.NewEncoder(opts.SampleRate, opts.AudioBitrate)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		opts:  opts,
+		video: video,
+		audio: audio,
+		gop:   gop,
+		img:   image.NewYCbCr(image.Rect(0, 0, opts.Width, opts.Height), image.YCbCrSubsampleRatio420),
+		pcm:   make([]float64, mp2.SamplesPerFrame),
+	}
+	g.mux = mpegts.NewMuxer(w,
+		mpegts.ElementaryStream{PID: VideoPID, StreamType: mpegts.StreamTypeMPEG1Video},
+		mpegts.ElementaryStream{PID: AudioPID, StreamType: mpegts.StreamTypeMPEG1Audio})
+	return g, nil
+}
+
+// Options returns the options of the generator, with the defaults.
+func (g *Generator) Options() Options {
+	return g.opts
+}
+
+// FrameDuration returns the duration of a picture.
+func (g *Generator) FrameDuration() time.Duration {
+	return time.Duration(float64(time.Second) / g.opts.FrameRate)
+}
+
+// Frames returns the number of pictures written.
+func (g *Generator) Frames() int64 {
+	return g.frames
+}
+
+// WriteFrame writes the next picture, with a clock showing a time, and the
+// audio until the next picture.
+func (g *Generator) WriteFrame(clock time.Time) error {
+	if g.frames%int64(g.gop) == 0 {
+		if err := g.mux.WriteTables(); err != nil {
+			return err
+		}
+	}
+
+	g.draw(clock)
+	pcr := int64(float64(g.frames) * 27000000 / g.opts.FrameRate)
+	if err := g.mux.WritePES(VideoPID, mpegts.StreamIDVideoFirst, pcr/300+ptsDelay, pcr, g.video.Encode(g.img)); err != nil {
+		return err
+	}
+	g.frames++
+
+	// the audio frames which start before the next picture
+	end := float64(g.frames) / g.opts.FrameRate
+	rate := float64(g.opts.SampleRate)
+	for float64(g.audioFrames*mp2.SamplesPerFrame)/rate < end {
+		pts := g.audioFrames * mp2.SamplesPerFrame * 90000 / int64(g.opts.SampleRate)
+		if err := g.mux.WritePES(AudioPID, mpegts.StreamIDAudioFirst, pts+ptsDelay, -1, g.audio.Encode(g.tone())); err != nil {
+			return err
+		}
+		g.audioFrames++
+	}
+	return nil
+}
+
+// Run writes the stream in real time until stop is closed, or for a
+// duration when it is positive.
+func (g *Generator) Run(stop <-chan struct{}, duration time.Duration) error {
+	ticker := time.NewTicker(g.FrameDuration())
+	defer ticker.Stop()
+	frames := int64(duration / g.FrameDuration())
+	for {
+		if err := g.WriteFrame(time.Now()); err != nil {
+			return err
+		}
+		if duration > 0 && g.frames >= frames {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw paints the picture of the next frame.
+func (g *Generator) draw(clock time.Time) {
+	w, h := g.opts.Width, g.opts.Height
+	barsHeight := h * 2 / 3 &^ 1
+	castellationsHeight := h*3/4&^1 - barsHeight
+	for i := range bars {
+		x0, x1 := w*i/len(bars)&^1, w*(i+1)/len(bars)&^1
+		fill(g.img, image.Rect(x0, 0, x1, barsHeight), bars[i])
+		fill(g.img, image.Rect(x0, barsHeight, x1, barsHeight+castellationsHeight), castellations[i])
+	}
+	fill(g.img, image.Rect(0, barsHeight+castellationsHeight, w, h), black)
+
+	// the box bounces across the bars in 4 seconds
+	size := h / 8 &^ 1
+	period := int64(4 * g.opts.FrameRate)
+	t := g.frames % period
+	if t > period/2 {
+		t = period - t
+	}
+	x := int(int64(w-size)*t*2/period) &^ 1
+	y := (barsHeight - size) / 2 &^ 1
+	fill(g.img, image.Rect(x, y, x+size, y+size), white)
+
+	// the clock and the counter, scaled to the space below the castellations
+	space := h - barsHeight - castellationsHeight
+	scale := max(1, min(space/(2*glyphHeight+6), w/(12*(glyphWidth+1))))
+	top := barsHeight + castellationsHeight
+	drawText(g.img, clock.Format("15:04:05.00"), w/2, top+space/4, scale)
+	drawText(g.img, fmt.Sprintf("%08d", g.frames), w/2, top+space*3/4, scale)
+}
+
+// tone returns the samples of the next audio frame.
+func (g *Generator) tone() []float64 {
+	if g.opts.Mute {
+		for i := range g.pcm {
+			g.pcm[i] = 0
+		}
+		return g.pcm
+	}
+	amplitude := math.Pow(10, g.opts.Level/20)
+	step := 2 * math.Pi * g.opts.Tone / float64(g.opts.SampleRate)
+	for i := range g.pcm {
+		g.pcm[i] = amplitude * math.Sin(g.phase)
+		g.phase += step
+	}
+	g.phase = math.Mod(g.phase, 2*math.Pi)
+	return g.pcm
+}
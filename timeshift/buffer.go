@@ -0,0 +1,166 @@
+package timeshift
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+var (
+	ErrEvicted = errors.New("timeshift: entry evicted from the buffer")
+	ErrClosed  = errors.New("timeshift: stream ended")
+)
+
+// Entry is a run of packets received at the same time, an entry starting
+// with a keyframe is a point where playback can begin.
+type Entry struct {
+	Seq      uint64
+	At       time.Time
+	Data     []byte
+	Keyframe bool
+}
+
+// Buffer keeps the packets of a topic received during the last window.
+type Buffer struct {
+	sync.RWMutex
+	window  time.Duration
+	entries []*Entry // oldest first
+	next    uint64
+	notify  chan struct{}
+	closed  bool
+	tables  mpegts.Tables
+}
+
+// create a new buffer holding the given duration of stream
+func NewBuffer(window time.Duration) *Buffer {
+	return &Buffer{
+		window: window,
+		notify: make(chan struct{}),
+	}
+}
+
+// Write appends aligned packets received at now, splitting them so that
+// every keyframe starts its own entry, and evicts what fell out of the window.
+func (b *Buffer) Write(now time.Time, data []byte) {
+	b.Lock()
+	defer b.Unlock()
+	if b.closed {
+		return
+	}
+
+	for _, pkt := range mpegts.Packets(data) {
+		b.tables.Update(pkt)
+	}
+	for _, chunk := range mpegts.SplitKeyframes(data) {
+		b.entries = append(b.entries, &Entry{
+			Seq:      b.next,
+			At:       now,
+			Data:     chunk.Data,
+			Keyframe: chunk.Keyframe,
+		})
+		b.next++
+	}
+
+	evict := 0
+	for evict < len(b.entries) && now.Sub(b.entries[evict].At) > b.window {
+		evict++
+	}
+	b.entries = b.entries[evict:]
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Close marks the end of the stream, readers drain the buffer and stop.
+func (b *Buffer) Close() {
+	b.Lock()
+	defer b.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.notify)
+	}
+}
+
+// Seek returns the sequence of the latest keyframe entry received at or
+// before at, falling back to the oldest keyframe kept.
+func (b *Buffer) Seek(at time.Time) (uint64, bool) {
+	b.RLock()
+	defer b.RUnlock()
+
+	var first, last *Entry
+	for _, e := range b.entries {
+		if !e.Keyframe {
+			continue
+		}
+		if first == nil {
+			first = e
+		}
+		if e.At.After(at) {
+			break
+		}
+		last = e
+	}
+	if last == nil {
+		last = first
+	}
+	if last == nil {
+		return 0, false
+	}
+	return last.Seq, true
+}
+
+// Get returns the entry with the given sequence. When it has not been
+// received yet, a nil entry is returned with a channel closed on the next
+// write.
+func (b *Buffer) Get(seq uint64) (*Entry, <-chan struct{}, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	if len(b.entries) > 0 && seq < b.entries[0].Seq {
+		return nil, nil, ErrEvicted
+	}
+	if seq >= b.next {
+		if b.closed {
+			return nil, nil, ErrClosed
+		}
+		return nil, b.notify, nil
+	}
+	return b.entries[seq-b.entries[0].Seq], nil, nil
+}
+
+// Entries returns the entries from the keyframe at or before from up to
+// the first keyframe received at or after to.
+func (b *Buffer) Entries(from, to time.Time) []*Entry {
+	seq, ok := b.Seek(from)
+	if !ok {
+		return nil
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+	list := []*Entry{}
+	for _, e := range b.entries {
+		if e.Seq < seq {
+			continue
+		}
+		if e.Keyframe && !e.At.Before(to) {
+			break
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// Tables returns the latest PAT and PMT packets, nil until both were seen.
+func (b *Buffer) Tables() []byte {
+	b.RLock()
+	defer b.RUnlock()
+	return b.tables.Packets()
+}
+
+// Window returns the time span of the buffer.
+func (b *Buffer) Window() time.Duration {
+	return b.window
+}
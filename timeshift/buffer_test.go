@@ -0,0 +1,127 @@
+package timeshift
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+)
+
+// frame returns the packets of a video picture of a coding type.
+func frame(t *testing.T, m *mpegts.Muxer, buf *bytes.Buffer, typ int) []byte {
+	t.Helper()
+	buf.Reset()
+	es := []byte{0, 0, 1, mpegts.StartCodePicture, 0, byte(typ << 3), 0xff, 0xf8}
+	if err := m.WritePES(0x100, 0xe0, 0, -1, es); err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{}, buf.Bytes()...)
+}
+
+func TestBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	m := mpegts.NewMuxer(&buf, mpegts.ElementaryStream{PID: 0x100, StreamType: mpegts.StreamTypeMPEG1Video})
+	if err := m.WriteTables(); err != nil {
+		t.Fatal(err)
+	}
+	tables := append([]byte{}, buf.Bytes()...)
+	key, delta := frame(t, m, &buf, mpegts.PictureI), frame(t, m, &buf, mpegts.PictureP)
+
+	start := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time {
+		return start.Add(time.Duration(s) * time.Second)
+	}
+	b := NewBuffer(10 * time.Second)
+	if _, ok := b.Seek(start); ok {
+		t.Fatal("seeked an empty buffer")
+	}
+	b.Write(at(0), delta) // before the first keyframe
+	b.Write(at(1), append(append([]byte{}, tables...), key...))
+	b.Write(at(2), delta)
+	b.Write(at(5), append(append([]byte{}, key...), delta...))
+	b.Write(at(6), delta)
+
+	if got := b.Tables(); !bytes.Equal(got, tables) {
+		t.Fatalf("got tables %x", got)
+	}
+
+	// the sequences are 0 for the first delta, 1 and 2 for the tables and
+	// the keyframe, then one per write
+	seeks := []struct {
+		at   time.Time
+		want uint64
+	}{
+		{at(0), 2}, // before the first keyframe
+		{at(1), 2},
+		{at(4), 2},
+		{at(5), 4},
+		{at(30), 4},
+	}
+	for _, tt := range seeks {
+		if got, ok := b.Seek(tt.at); !ok || got != tt.want {
+			t.Errorf("seek at %v: got %v, %v, want %v", tt.at.Sub(start), got, ok, tt.want)
+		}
+	}
+
+	entries := b.Entries(at(1), at(5))
+	if len(entries) != 2 || !entries[0].Keyframe || entries[1].Keyframe {
+		t.Fatalf("got %d entries from 1s to 5s", len(entries))
+	}
+
+	// the entries of the first 2 seconds fall out of the window
+	b.Write(at(13), delta)
+	if _, _, err := b.Get(2); err != ErrEvicted {
+		t.Fatalf("got %v for an evicted entry", err)
+	}
+	if e, _, err := b.Get(4); err != nil || !e.Keyframe || !e.At.Equal(at(5)) {
+		t.Fatalf("got %+v, %v", e, err)
+	}
+	if got, ok := b.Seek(at(1)); !ok || got != 4 {
+		t.Fatalf("seek after eviction: got %v, %v", got, ok)
+	}
+
+	// a reader waits for the next entry until the buffer is closed
+	e, notify, err := b.Get(7)
+	if e != nil || notify == nil || err != nil {
+		t.Fatalf("got %+v, %v for the next entry", e, err)
+	}
+	b.Write(at(14), delta)
+	select {
+	case <-notify:
+	default:
+		t.Fatal("the write did not notify")
+	}
+	if e, _, err := b.Get(7); err != nil || e == nil {
+		t.Fatalf("got %+v, %v after the write", e, err)
+	}
+	_, notify, _ = b.Get(8)
+	b.Close()
+	select {
+	case <-notify:
+	default:
+		t.Fatal("closing did not notify")
+	}
+	if _, _, err := b.Get(8); err != ErrClosed {
+		t.Fatalf("got %v after closing", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(time.Minute)
+	if s.Get("live/news") != nil {
+		t.Fatal("a buffer before any write")
+	}
+	s.Write("live/news", make([]byte, mpegts.PacketSize))
+	b := s.Get("live/news")
+	if b == nil || b.Window() != time.Minute {
+		t.Fatal("no buffer after a write")
+	}
+	s.End("live/news")
+	if s.Get("live/news") != nil {
+		t.Fatal("the buffer was kept after the end")
+	}
+	if _, _, err := b.Get(1); err != ErrClosed {
+		t.Fatalf("got %v from an ended buffer", err)
+	}
+}
@@ -0,0 +1,51 @@
+package timeshift
+
+import (
+	"sync"
+	"time"
+)
+
+// Store holds a rolling buffer for every live topic.
+type Store struct {
+	sync.RWMutex
+	window  time.Duration
+	buffers map[string]*Buffer
+}
+
+// create a new store whose buffers keep the given duration of stream
+func NewStore(window time.Duration) *Store {
+	return &Store{
+		window:  window,
+		buffers: map[string]*Buffer{},
+	}
+}
+
+// Write appends aligned packets to the buffer of the topic.
+func (s *Store) Write(topic string, data []byte) {
+	s.Lock()
+	b := s.buffers[topic]
+	if b == nil {
+		b = NewBuffer(s.window)
+		s.buffers[topic] = b
+	}
+	s.Unlock()
+	b.Write(time.Now(), data)
+}
+
+// End closes and forgets the buffer of a topic whose publisher is gone.
+func (s *Store) End(topic string) {
+	s.Lock()
+	b := s.buffers[topic]
+	delete(s.buffers, topic)
+	s.Unlock()
+	if b != nil {
+		b.Close()
+	}
+}
+
+// to get the buffer of the topic, nil when the topic is not live
+func (s *Store) Get(topic string) *Buffer {
+	s.RLock()
+	defer s.RUnlock()
+	return s.buffers[topic]
+}
@@ -0,0 +1,123 @@
+package vod
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/record"
+)
+
+// the largest chunk sent at once
+const maxChunkSize = 64 * 1024
+
+var ErrNoIndex = errors.New("vod: the recording has no keyframe to seek to")
+
+// Player reads a recording in chunks timed by its program clock reference.
+type Player struct {
+	file    *os.File
+	reader  *bufio.Reader
+	index   record.Index
+	pacer   mpegts.Pacer
+	pending mpegts.Packet // a PCR packet starting the next chunk
+}
+
+// Open opens a recording for playback from its start.
+func Open(rec record.Recording) (*Player, error) {
+	index, err := record.LoadIndex(rec)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(rec.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &Player{
+		file:   file,
+		reader: bufio.NewReaderSize(file, maxChunkSize),
+		index:  index,
+	}, nil
+}
+
+// Next returns the next chunk of packets and how long to wait before
+// sending it. A chunk runs from a PCR packet to the next one, io.EOF is
+// returned at the end of the recording.
+func (p *Player) Next() ([]byte, time.Duration, error) {
+	var chunk []byte
+	var delay time.Duration
+	if p.pending != nil {
+		chunk = append(chunk, p.pending...)
+		delay = p.pacer.Delay(p.pending, time.Now())
+		p.pending = nil
+	}
+
+	for len(chunk) < maxChunkSize {
+		pkt := make(mpegts.Packet, mpegts.PacketSize)
+		if _, err := io.ReadFull(p.reader, pkt); err != nil {
+			if len(chunk) > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				return chunk, delay, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return nil, 0, err
+		}
+		if _, ok := pkt.PCR(); ok && len(chunk) > 0 {
+			p.pending = pkt
+			break
+		}
+		if len(chunk) == 0 {
+			delay = p.pacer.Delay(pkt, time.Now())
+		}
+		chunk = append(chunk, pkt...)
+	}
+	return chunk, delay, nil
+}
+
+// Seek moves to the keyframe at or before the position from the start.
+func (p *Player) Seek(position time.Duration) error {
+	if len(p.index) == 0 {
+		return ErrNoIndex
+	}
+	return p.SeekAt(p.index[0].At.Add(position))
+}
+
+// SeekAt moves to the keyframe at or before the given time of the recording.
+func (p *Player) SeekAt(at time.Time) error {
+	entry, ok := p.index.Seek(at)
+	if !ok {
+		return ErrNoIndex
+	}
+	return p.seekOffset(entry.Offset)
+}
+
+func (p *Player) seekOffset(offset int64) error {
+	if _, err := p.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	p.reader.Reset(p.file)
+	p.pending = nil
+	p.pacer.Reset()
+	return nil
+}
+
+// Resume restarts the pacing after a pause.
+func (p *Player) Resume() {
+	p.pacer.Reset()
+}
+
+// Duration returns the time span between the first and the last keyframe.
+func (p *Player) Duration() time.Duration {
+	if len(p.index) == 0 {
+		return 0
+	}
+	return p.index[len(p.index)-1].At.Sub(p.index[0].At)
+}
+
+// Close closes the recording file.
+func (p *Player) Close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,117 @@
+package vod
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/numb3r3/jsmpeg-relay/mpegts"
+	"github.com/numb3r3/jsmpeg-relay/record"
+	"github.com/numb3r3/jsmpeg-relay/testsrc"
+)
+
+// recording writes seconds of the test pattern as a recording without an
+// index, which is rebuilt from the PCR.
+func recording(t *testing.T, seconds int) (record.Recording, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	gen, err := testsrc.New(&buf, testsrc.Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < seconds*25; i++ {
+		if err := gen.WriteFrame(start.Add(time.Duration(i) * gen.FrameDuration())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := record.Recording{ID: "rec", App: "live", Key: "news", Path: filepath.Join(t.TempDir(), "rec.ts"), StartedAt: start}
+	if err := os.WriteFile(rec.Path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rec, buf.Bytes()
+}
+
+func TestPlayer(t *testing.T) {
+	rec, data := recording(t, 3)
+	p, err := Open(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if d := p.Duration(); d != 2*time.Second {
+		t.Fatalf("got duration %v", d)
+	}
+
+	// every chunk starts on a PCR and is due by the clock of the stream
+	var got []byte
+	var last time.Duration
+	for {
+		chunk, delay, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) > 0 {
+			if _, ok := mpegts.Packet(chunk).PCR(); !ok {
+				t.Fatalf("the chunk at %d does not start on a PCR", len(got))
+			}
+		}
+		if delay < last-50*time.Millisecond {
+			t.Fatalf("the chunk at %d is due at %v, before %v", len(got), delay, last)
+		}
+		last = delay
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(data))
+	}
+	if last < 2800*time.Millisecond || last > 3*time.Second {
+		t.Fatalf("the last chunk is due at %v", last)
+	}
+}
+
+func TestPlayerSeek(t *testing.T) {
+	rec, data := recording(t, 3)
+	p, err := Open(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var keyframes []int
+	for i, pkt := range mpegts.Packets(data) {
+		if mpegts.IsKeyframe(pkt) {
+			keyframes = append(keyframes, i*mpegts.PacketSize)
+		}
+	}
+	tests := []struct {
+		position time.Duration
+		keyframe int
+	}{
+		{0, 0},
+		{1500 * time.Millisecond, 1},
+		{time.Minute, 2},
+		{-time.Minute, 0},
+	}
+	for _, tt := range tests {
+		if err := p.Seek(tt.position); err != nil {
+			t.Fatal(err)
+		}
+		chunk, delay, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset := keyframes[tt.keyframe]; !bytes.HasPrefix(data[offset:], chunk) {
+			t.Errorf("at %v: the chunk does not start at keyframe %d", tt.position, tt.keyframe)
+		}
+		if delay != 0 {
+			t.Errorf("at %v: the first chunk is due in %v", tt.position, delay)
+		}
+	}
+}
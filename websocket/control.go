@@ -0,0 +1,20 @@
+package websocket
+
+// the commands a viewer can send
+const (
+	ControlLive   = "live"   // jump back to the live edge
+	ControlSeek   = "seek"   // move to the given offset or position
+	ControlPause  = "pause"  // stop sending until resumed
+	ControlResume = "resume" // continue after a pause
+)
+
+// Control is a JSON text message a viewer sends to steer its playback,
+// e.g. {"cmd":"seek","offset":"-10s"} or {"cmd":"live"} on a live stream
+// and {"cmd":"seek","position":"1m30s"} or {"cmd":"pause"} on a recording.
+// Both can seek to a marker of the stream with {"cmd":"seek","marker":"goal"}.
+type Control struct {
+	Cmd      string `json:"cmd"`
+	Offset   string `json:"offset,omitempty"`
+	Position string `json:"position,omitempty"`
+	Marker   string `json:"marker,omitempty"`
+}
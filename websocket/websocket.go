@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
@@ -160,6 +161,12 @@ func (c *websocketTransport) Write(b []byte) (n int, err error) {
 	return
 }
 
+// WriteClose sends a close message with a status code and a reason, the
+// connection is still to be closed.
+func (c *websocketTransport) WriteClose(code int, reason string) error {
+	return c.socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+}
+
 func (c *websocketTransport) Closing() <-chan bool {
 	return c.closing
 }
@@ -207,3 +214,30 @@ func (c *websocketTransport) SetReadDeadline(t time.Time) error {
 func (c *websocketTransport) SetWriteDeadline(t time.Time) error {
 	return c.socket.SetWriteDeadline(t)
 }
+
+// ReadControl reads the next control message sent by the peer, binary
+// messages and malformed text messages are skipped.
+func (c *websocketTransport) ReadControl() (*Control, error) {
+	for {
+		opCode, r, err := c.socket.NextReader()
+		if err != nil {
+			return nil, err
+		}
+		if opCode != websocket.TextMessage {
+			continue
+		}
+
+		ctl := &Control{}
+		if err := json.NewDecoder(r).Decode(ctl); err != nil {
+			logging.Debug("invalid control message: ", err)
+			continue
+		}
+		return ctl, nil
+	}
+}
+
+// IsNormalClose tells whether a read error is the peer closing the
+// connection normally or going away.
+func IsNormalClose(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+}